@@ -3,15 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/httpapi"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state/filedb"
 	"github.com/danielmbirochi/trustwallet-assignment/internal/txparser"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/abi"
 )
 
 const (
@@ -37,14 +44,54 @@ func run() error {
 	defer cancel()
 
 	initialBlock := flag.Int("block", DefaultInitialBlock, "block number to start scanning from")
+	abiDir := flag.String("abi", "", "directory of JSON ABI files used to decode calldata")
+	httpAddr := flag.String("http", "", "address to serve the REST API on, such as :8080, instead of the interactive CLI")
+	traces := flag.Bool("traces", true, "index internal transfers from block traces, if the endpoint exposes debug_traceBlockByNumber")
+	storeFile := flag.String("store", "", "file holding the subscriptions, histories and checkpoint, shared by the copies of the parser; kept in memory if empty")
+	lockFile := flag.String("lockfile", "", "file holding the leader lease shared by the copies of the parser; enables leader election and needs -store")
+	node := flag.String("node", defaultNode(), "name of this copy in the leader election")
+	lease := flag.Duration("lease", txparser.DefaultLeaderLeaseTTL, "time after which a standby takes over from a leader which stopped renewing its lease")
 	flag.Parse()
 
-	service := txparser.New(ctx, Endpoint, *initialBlock)
-	service.StartScan(ScanInterval)
+	abis := abi.NewRegistry()
+	if *abiDir != "" {
+		n, err := abis.LoadDir(*abiDir)
+		if err != nil {
+			return fmt.Errorf("loading abi directory: %w", err)
+		}
+		fmt.Printf("Loaded %d methods from %s\n", n, *abiDir)
+	}
+
+	opts := []txparser.Option{txparser.WithABIRegistry(abis), txparser.WithInternalTransfers(*traces)}
+	if *lockFile != "" {
+		// Standbys serve the data indexed by the leader and resume from
+		// its checkpoint, so the copies must share their store.
+		if *storeFile == "" {
+			return errors.New("-lockfile needs -store, shared by the copies of the parser")
+		}
+		opts = append(opts, txparser.WithLeaderElection(*node, *lease), txparser.WithLeaseStore(filedb.New(*lockFile)))
+		fmt.Printf("Leader election as %s through %s\n", *node, *lockFile)
+	}
+	var root *txparser.Service
+	if *storeFile != "" {
+		root = txparser.NewWithStore(ctx, filedb.New(*storeFile), Endpoint, *initialBlock, opts...)
+		fmt.Printf("State kept in %s\n", *storeFile)
+	} else {
+		root = txparser.New(ctx, Endpoint, *initialBlock, opts...)
+	}
+	root.StartScan(ScanInterval)
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	if *httpAddr != "" {
+		return serve(ctx, cancel, *httpAddr, root, shutdown)
+	}
+
+	// service is the parser of the tenant selected with "tenant use",
+	// the default tenant at start.
+	service := root
+
 	// ========================================
 	// Initialize the CLI and start the main loop
 	{
@@ -85,6 +132,43 @@ func run() error {
 
 				if operation == "stats" {
 					fmt.Println("Current block:", service.GetCurrentBlock())
+					if len(args) > 1 {
+						printStats(args[1], service.GetStats(args[1]))
+					}
+					fmt.Println()
+					continue
+				}
+
+				if operation == "subscriptions" {
+					filter, err := subscriptionFilter(args[1:])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Println("Subscriptions:")
+					for _, sub := range service.ListSubscriptions(filter) {
+						printSubscription(sub)
+					}
+					fmt.Println()
+					continue
+				}
+
+				if operation == "tenants" {
+					fmt.Println("Tenants:")
+					for _, t := range root.ListTenants() {
+						printTenant(t)
+					}
+					fmt.Println()
+					continue
+				}
+
+				if operation == "dedupe" {
+					removed, err := service.DedupeTxs()
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Printf("Removed %d duplicated transactions\n", removed)
 					fmt.Println()
 					continue
 				}
@@ -95,20 +179,173 @@ func run() error {
 				}
 
 				switch operation {
+				case "tenant":
+					scope, err := tenantCommand(root, args[1:])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					if scope != nil {
+						service = scope
+					}
+					fmt.Println()
+				case "watchlist":
+					if err := watchlistCommand(service, args[1:]); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Println()
+				case "export":
+					n, err := export(root, args[1])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Printf("Exported %d keys to %s\n", n, args[1])
+					fmt.Println()
+				case "import":
+					n, err := restore(root, args[1])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Printf("Imported %d keys from %s, resuming at block %d\n", n, args[1], root.GetCurrentBlock())
+					fmt.Println()
 				case "subscribe":
 					address := args[1]
-					if ok := service.Subscribe(address); !ok {
+					sub, err := subscription(address, args[2:])
+					if err != nil {
 						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					if ok := service.SubscribeWith(sub); !ok {
+						fmt.Fprintf(os.Stderr, "Address [%s] could not be subscribed\n", address)
+						continue
 					}
 					fmt.Printf("Address [%s] subscribed successfully\n", address)
 					fmt.Println()
+				case "subscription":
+					sub, ok := service.GetSubscription(args[1])
+					if !ok {
+						fmt.Fprintf(os.Stderr, "Address [%s] is not subscribed\n", args[1])
+						continue
+					}
+					printSubscription(sub)
+					fmt.Println()
+				case "unsubscribe":
+					address := args[1]
+					opts, err := retention(args[2:])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					if ok := service.Unsubscribe(address, opts); !ok {
+						fmt.Fprintf(os.Stderr, "Address [%s] could not be unsubscribed\n", address)
+						continue
+					}
+					fmt.Printf("Address [%s] unsubscribed successfully\n", address)
+					fmt.Println()
 				case "transactions":
 					address := args[1]
-					txs := service.GetTransactions(address)
+					positional, options := splitOptions(args[2:])
+					opts, err := rangeFilters(positional)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					filters, err := queryOptions(options)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					opts = append(opts, filters...)
+					page, err := service.V2().ListTransactions(context.Background(), address, opts...)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
 					fmt.Println("Transactions:")
-					for _, tx := range txs {
-						fmt.Printf("%+v\n", tx)
+					for _, tx := range page.Transactions {
+						printTx(tx)
+					}
+					if page.NextCursor != "" {
+						fmt.Printf("Next page: cursor=%s\n", page.NextCursor)
+					}
+					fmt.Println()
+				case "transaction":
+					lookup, ok := service.GetTransaction(args[1])
+					if !ok {
+						fmt.Fprintf(os.Stderr, "Transaction [%s] not found\n", args[1])
+						continue
+					}
+					printTx(lookup.Transaction)
+					fmt.Printf("  subscribed addresses: %s\n", strings.Join(lookup.Addresses, ", "))
+					fmt.Println()
+				case "rollups":
+					if len(args) < 4 {
+						help()
+						continue
+					}
+					from, err := parseTime(args[3])
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					to := time.Now()
+					if len(args) > 4 {
+						if to, err = parseTime(args[4]); err != nil {
+							fmt.Fprintln(os.Stderr, err)
+							continue
+						}
+					}
+					bucket := svc.Bucket(args[2])
+					var rollups []svc.Rollup
+					if args[1] == "all" {
+						rollups, err = service.V2().GetTotalRollups(context.Background(), bucket, from, to)
+					} else {
+						rollups, err = service.V2().GetRollups(context.Background(), args[1], bucket, from, to)
+					}
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					fmt.Printf("Activity of [%s] per %s:\n", args[1], bucket)
+					for _, r := range rollups {
+						if r.Count > 0 {
+							fmt.Printf("  %s: %d entries, in %s wei, out %s wei, fees %s wei\n", r.Start.Format(time.RFC3339), r.Count, r.ValueIn, r.ValueOut, r.Fees)
+						}
+					}
+					fmt.Println()
+				case "balance":
+					address := args[1]
+					fmt.Printf("Balance of [%s]: %s wei\n", address, service.GetBalance(address))
+					for _, m := range service.GetBalanceMismatches(address) {
+						fmt.Printf("  mismatch at block %d: indexed %s, on-chain %s\n", m.Block, m.Expected, m.Actual)
+					}
+					fmt.Println()
+				case "nonces":
+					address := args[1]
+					status := service.GetNonceStatus(address)
+					fmt.Printf("Nonces of [%s]: highest indexed %v, on-chain count %d at block %d\n", address, status.Highest, status.TransactionCount, status.CheckedAt)
+					for _, gap := range status.Gaps {
+						fmt.Printf("  missing nonce %d (block %d)\n", gap.Nonce, gap.Block)
+					}
+					fmt.Println()
+				case "fees":
+					address := args[1]
+					positional, options := splitOptions(args[2:])
+					opts, err := rangeFilters(positional)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					filters, err := queryOptions(options)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
 					}
+					opts = append(opts, filters...)
+					fmt.Printf("Fees paid by [%s]: %s wei\n", address, service.GetFees(address, opts...))
 					fmt.Println()
 				}
 			}
@@ -122,12 +359,528 @@ func run() error {
 	return nil
 }
 
+// serve runs the REST API until a shutdown signal is received. The server
+// shares the context of the scanner, so both stop together and requests
+// in flight are given time to complete.
+func serve(ctx context.Context, cancel context.CancelFunc, addr string, service *txparser.Service, shutdown <-chan os.Signal) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpapi.ListenAndServe(ctx, addr, httpapi.NewHandler(service.V2(), service))
+	}()
+	fmt.Printf("Serving the REST API on %s\n", addr)
+
+	select {
+	case sig := <-shutdown:
+		fmt.Println("shutdown started - received signal: ", sig)
+		cancel()
+	case err := <-errs:
+		cancel()
+		return err
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+	fmt.Println("shutdown completed")
+	return nil
+}
+
+// defaultNode names the copy in the leader election after its host and
+// process.
+func defaultNode() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "txparser"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func printStats(address string, stats svc.Stats) {
+	fmt.Printf("Statistics of [%s]:\n", address)
+	fmt.Printf("  transactions: %d (%d in, %d out)\n", stats.Transactions, stats.Incoming, stats.Outgoing)
+	fmt.Printf("  value in: %v wei, value out: %v wei, fees: %v wei\n", stats.ValueIn, stats.ValueOut, stats.Fees)
+	fmt.Printf("  blocks: %d to %d\n", stats.FirstBlock, stats.LastBlock)
+	fmt.Printf("  counterparties: %d\n", stats.Counterparties)
+}
+
+func printTx(tx svc.Transaction) {
+	call, withdrawal, auth, receipt := tx.Call, tx.Withdrawal, tx.Authorization, tx.Receipt
+	tx.Call, tx.Withdrawal, tx.Authorization, tx.Receipt = nil, nil, nil, nil
+	fmt.Printf("[%s] %+v\n", tx.Time().Format(time.RFC1123), tx)
+	if receipt != nil {
+		fmt.Printf("  receipt: %+v\n", *receipt)
+	}
+	if call != nil {
+		fmt.Printf("  call: %s\n", call)
+	}
+	if withdrawal != nil {
+		fmt.Printf("  withdrawal: %+v\n", *withdrawal)
+	}
+	if auth != nil {
+		fmt.Printf("  authorization: %s delegates its code to %s\n", auth.Authority, auth.Address)
+	}
+}
+
+// subscription parses the optional key=value details of the subscribe
+// command: label (repeatable), owner, source, expires (a time or a
+// duration from now) and meta.<key>.
+func subscription(address string, args []string) (svc.Subscription, error) {
+	sub := svc.Subscription{Address: address, Source: "cli"}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return sub, fmt.Errorf("invalid detail %q: expected key=value", arg)
+		}
+		switch {
+		case key == "label":
+			sub.Labels = append(sub.Labels, value)
+		case key == "owner":
+			sub.Owner = value
+		case key == "source":
+			sub.Source = value
+		case key == "expires":
+			expires, err := parseExpiry(value)
+			if err != nil {
+				return sub, err
+			}
+			sub.ExpiresAt = &expires
+		case strings.HasPrefix(key, "meta."):
+			if sub.Metadata == nil {
+				sub.Metadata = make(map[string]string)
+			}
+			sub.Metadata[strings.TrimPrefix(key, "meta.")] = value
+		default:
+			return sub, fmt.Errorf("unknown detail %q", key)
+		}
+	}
+	return sub, nil
+}
+
+// subscriptionFilter parses the arguments of the subscriptions command:
+// owner, source, label and meta.<key> filters as key=value, "all" to
+// include expired subscriptions, and free text.
+func subscriptionFilter(args []string) (svc.SubscriptionFilter, error) {
+	var filter svc.SubscriptionFilter
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		if arg == "all" {
+			filter.IncludeExpired = true
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		switch {
+		case !ok:
+			filter.Text = arg
+		case key == "owner":
+			filter.Owner = value
+		case key == "source":
+			filter.Source = value
+		case key == "label":
+			filter.Labels = append(filter.Labels, value)
+		case strings.HasPrefix(key, "meta."):
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			filter.Metadata[strings.TrimPrefix(key, "meta.")] = value
+		default:
+			return filter, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	return filter, nil
+}
+
+func parseExpiry(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d).UTC(), nil
+	}
+	return parseTime(s)
+}
+
+func printSubscription(sub svc.Subscription) {
+	fmt.Printf("%s  created %s at block %d", sub.Address, sub.CreatedAt.Format(time.RFC1123), sub.StartBlock)
+	if sub.Source != "" {
+		fmt.Printf("  source=%s", sub.Source)
+	}
+	if sub.Owner != "" {
+		fmt.Printf("  owner=%s", sub.Owner)
+	}
+	if len(sub.Labels) > 0 {
+		fmt.Printf("  labels=%s", strings.Join(sub.Labels, ","))
+	}
+	for k, v := range sub.Metadata {
+		fmt.Printf("  meta.%s=%s", k, v)
+	}
+	if sub.ExpiresAt != nil {
+		fmt.Printf("  expires %s", sub.ExpiresAt.Format(time.RFC1123))
+	}
+	fmt.Println()
+}
+
+// export writes a snapshot of the parser state to the file. The snapshot
+// is written to a temporary file first so an interrupted export never
+// leaves a truncated snapshot behind.
+func export(service *txparser.Service, path string) (int, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("creating snapshot: %w", err)
+	}
+	n, err := service.Export(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("exporting snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("exporting snapshot: %w", err)
+	}
+	return n, nil
+}
+
+// restore replaces the parser state with the snapshot file.
+func restore(service *txparser.Service, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer f.Close()
+
+	n, err := service.Import(f)
+	if err != nil {
+		return 0, fmt.Errorf("importing snapshot: %w", err)
+	}
+	return n, nil
+}
+
+// tenantCommand runs the create, use and delete subcommands of the tenant
+// command. It returns the parser to switch to for the use subcommand.
+func tenantCommand(root *txparser.Service, args []string) (*txparser.Service, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("usage: tenant create|use|delete <id>")
+	}
+	id := args[1]
+	switch args[0] {
+	case "create":
+		t, err := tenant(id, args[2:])
+		if err != nil {
+			return nil, err
+		}
+		if !root.CreateTenant(t) {
+			return nil, fmt.Errorf("tenant [%s] could not be created", id)
+		}
+		fmt.Printf("Tenant [%s] saved successfully\n", id)
+	case "use":
+		if id == "default" {
+			fmt.Println("Using the default tenant")
+			return root, nil
+		}
+		scope, ok := root.Tenant(id)
+		if !ok {
+			return nil, fmt.Errorf("tenant [%s] does not exist", id)
+		}
+		fmt.Printf("Using tenant [%s]\n", id)
+		return scope, nil
+	case "delete":
+		if !root.DeleteTenant(id) {
+			return nil, fmt.Errorf("tenant [%s] could not be deleted", id)
+		}
+		fmt.Printf("Tenant [%s] deleted successfully\n", id)
+	default:
+		return nil, fmt.Errorf("unknown tenant command %q", args[0])
+	}
+	return nil, nil
+}
+
+// watchlistCommand subscribes the addresses of a watchlist file, reporting
+// the entries which could not be subscribed, or writes the active
+// subscriptions to a watchlist file.
+func watchlistCommand(service *txparser.Service, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: watchlist import|export <file>")
+	}
+	path := args[1]
+	switch args[0] {
+	case "import":
+		entries, errs, err := readWatchlist(path)
+		if err != nil {
+			return err
+		}
+		subs := make([]svc.Subscription, len(entries))
+		for i, e := range entries {
+			subs[i] = e.sub
+		}
+		subscribed := 0
+		for i, result := range service.SubscribeMany(subs) {
+			if result.Err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entries[i].where, result.Err))
+				continue
+			}
+			subscribed++
+		}
+		fmt.Printf("Subscribed %d addresses from %s\n", subscribed, path)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  rejected %v\n", err)
+		}
+	case "export":
+		subs := service.ListSubscriptions(svc.SubscriptionFilter{})
+		if err := writeWatchlist(path, subs); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d subscriptions to %s\n", len(subs), path)
+	default:
+		return fmt.Errorf("unknown watchlist command %q", args[0])
+	}
+	return nil
+}
+
+// tenant parses the optional key=value details of the tenant create
+// command: name, minvalue in wei, kind (repeatable) and webhook
+// (repeatable).
+func tenant(id string, args []string) (svc.Tenant, error) {
+	t := svc.Tenant{ID: id}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return t, fmt.Errorf("invalid detail %q: expected key=value", arg)
+		}
+		switch key {
+		case "name":
+			t.Name = value
+		case "minvalue":
+			min, ok := new(big.Int).SetString(value, 10)
+			if !ok {
+				return t, fmt.Errorf("invalid minimum value %q", value)
+			}
+			t.Filters.MinValue = min
+		case "kind":
+			t.Filters.Kinds = append(t.Filters.Kinds, value)
+		case "webhook":
+			t.DeliveryTargets = append(t.DeliveryTargets, value)
+		default:
+			return t, fmt.Errorf("unknown detail %q", key)
+		}
+	}
+	return t, nil
+}
+
+func printTenant(t svc.Tenant) {
+	fmt.Printf("%s  created %s", t.ID, t.CreatedAt.Format(time.RFC1123))
+	if t.Name != "" {
+		fmt.Printf("  name=%s", t.Name)
+	}
+	if t.Filters.MinValue != nil {
+		fmt.Printf("  minvalue=%s", t.Filters.MinValue)
+	}
+	if len(t.Filters.Kinds) > 0 {
+		fmt.Printf("  kinds=%s", strings.Join(t.Filters.Kinds, ","))
+	}
+	for _, target := range t.DeliveryTargets {
+		fmt.Printf("  webhook=%s", target)
+	}
+	fmt.Println()
+}
+
+// retention parses the optional retention argument of the unsubscribe
+// command: keep (default), purge, or a grace period such as 72h.
+func retention(args []string) (svc.UnsubscribeOptions, error) {
+	if len(args) == 0 || args[0] == "keep" {
+		return svc.UnsubscribeOptions{Retention: svc.KeepHistory}, nil
+	}
+	if args[0] == "purge" {
+		return svc.UnsubscribeOptions{Retention: svc.PurgeHistory}, nil
+	}
+	grace, err := time.ParseDuration(args[0])
+	if err != nil {
+		return svc.UnsubscribeOptions{}, fmt.Errorf("invalid retention %q: expected keep, purge or a grace period", args[0])
+	}
+	return svc.UnsubscribeOptions{Retention: svc.ExpireHistory, GracePeriod: grace}, nil
+}
+
+// splitOptions separates the positional arguments of a command from its
+// key=value options.
+func splitOptions(args []string) (positional, options []string) {
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			options = append(options, arg)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return positional, options
+}
+
+// queryOptions parses the key=value options of the transactions and fees
+// commands: direction (in or out), counterparty, min and max values, kind
+// (repeatable), status (success or failed), method (selector or name),
+// balance (true to set the running balance after each entry), and the
+// limit, order (asc or desc) and cursor of the page.
+func queryOptions(args []string) ([]svc.QueryOption, error) {
+	var opts []svc.QueryOption
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "direction":
+			switch value {
+			case "in":
+				opts = append(opts, svc.WithDirection(svc.Incoming))
+			case "out":
+				opts = append(opts, svc.WithDirection(svc.Outgoing))
+			default:
+				return nil, fmt.Errorf("invalid direction %q: expected in or out", value)
+			}
+		case "counterparty":
+			opts = append(opts, svc.WithCounterparty(value))
+		case "min", "max":
+			v, err := parseWei(value)
+			if err != nil {
+				return nil, err
+			}
+			if key == "min" {
+				opts = append(opts, svc.MinValue(v))
+			} else {
+				opts = append(opts, svc.MaxValue(v))
+			}
+		case "kind":
+			opts = append(opts, svc.WithKinds(value))
+		case "status":
+			switch value {
+			case "success":
+				opts = append(opts, svc.WithStatus(svc.StatusSuccess))
+			case "failed":
+				opts = append(opts, svc.WithStatus(svc.StatusFailed))
+			default:
+				return nil, fmt.Errorf("invalid status %q: expected success or failed", value)
+			}
+		case "method":
+			opts = append(opts, svc.WithMethod(value))
+		case "balance":
+			withBalance, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid balance %q: expected true or false", value)
+			}
+			if withBalance {
+				opts = append(opts, svc.WithBalance())
+			}
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid limit %q", value)
+			}
+			opts = append(opts, svc.WithLimit(n))
+		case "order":
+			switch value {
+			case "asc":
+				opts = append(opts, svc.WithOrder(svc.Ascending))
+			case "desc":
+				opts = append(opts, svc.WithOrder(svc.Descending))
+			default:
+				return nil, fmt.Errorf("invalid order %q: expected asc or desc", value)
+			}
+		case "cursor":
+			opts = append(opts, svc.WithCursor(value))
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// rangeFilters parses the optional lower and upper bound arguments of the
+// transactions and fees commands. Bounds are block numbers, RFC 3339
+// timestamps or dates.
+func rangeFilters(args []string) ([]svc.QueryOption, error) {
+	var opts []svc.QueryOption
+	for i, arg := range args {
+		if i > 1 {
+			break
+		}
+		if arg == "" || arg == "-" {
+			continue
+		}
+		if block, err := strconv.ParseUint(arg, 10, 64); err == nil {
+			if i == 0 {
+				opts = append(opts, svc.FromBlock(block))
+			} else {
+				opts = append(opts, svc.ToBlock(block))
+			}
+			continue
+		}
+		t, err := parseTime(arg)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			opts = append(opts, svc.Since(t))
+		} else {
+			opts = append(opts, svc.Until(t))
+		}
+	}
+	return opts, nil
+}
+
+// parseWei parses a value in wei, or in gwei or ether with the gwei and
+// eth suffixes, such as 1.5eth.
+func parseWei(s string) (*big.Int, error) {
+	unit := big.NewRat(1, 1)
+	number := s
+	switch {
+	case strings.HasSuffix(s, "gwei"):
+		unit.SetInt64(1e9)
+		number = strings.TrimSuffix(s, "gwei")
+	case strings.HasSuffix(s, "eth"):
+		unit.SetInt64(1e18)
+		number = strings.TrimSuffix(s, "eth")
+	}
+	v, ok := new(big.Rat).SetString(number)
+	if !ok || v.Sign() < 0 {
+		return nil, fmt.Errorf("invalid value %q: expected wei, or a gwei or eth amount", s)
+	}
+	v.Mul(v, unit)
+	if !v.IsInt() {
+		return nil, fmt.Errorf("invalid value %q: below one wei", s)
+	}
+	return new(big.Int).Set(v.Num()), nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
 func help() {
 	fmt.Println("Usage: <operation> <input>")
+	fmt.Println("Ranges are block numbers, RFC 3339 times or YYYY-MM-DD dates.")
+	fmt.Println("Filters are direction=in|out, counterparty=<address>, min=<value>, max=<value>, kind=<kind>,")
+	fmt.Println("status=success|failed and method=<selector|name>. Values are in wei, or gwei or eth with a suffix.")
 	fmt.Println("Available commands:")
-	fmt.Println("  subscribe <address>")
-	fmt.Println("  transactions <address>")
-	fmt.Println("  stats")
+	fmt.Println("  subscribe <address> [label=<label>] [owner=<owner>] [source=<source>] [expires=<time|duration>] [meta.<key>=<value>]")
+	fmt.Println("  subscription <address>")
+	fmt.Println("  subscriptions [all] [owner=<owner>] [source=<source>] [label=<label>] [meta.<key>=<value>] [text]")
+	fmt.Println("  unsubscribe <address> [keep|purge|<grace period>]")
+	fmt.Println("  watchlist import|export <file.txt|file.csv|file.json>")
+	fmt.Println("  transactions <address> [from|-] [to] [filters] [balance=true] [limit=<n>] [order=asc|desc] [cursor=<cursor>]")
+	fmt.Println("  fees <address> [from|-] [to] [filters]")
+	fmt.Println("  transaction <hash>")
+	fmt.Println("  rollups <address|all> hour|day <from> [to]")
+	fmt.Println("  balance <address>")
+	fmt.Println("  nonces <address>")
+	fmt.Println("  tenants")
+	fmt.Println("  tenant create <id> [name=<name>] [minvalue=<wei>] [kind=<kind>] [webhook=<url>]")
+	fmt.Println("  tenant use <id|default>")
+	fmt.Println("  tenant delete <id>")
+	fmt.Println("  export <file>")
+	fmt.Println("  import <file>")
+	fmt.Println("  stats [address]")
+	fmt.Println("  dedupe")
 	fmt.Println("  exit")
 	fmt.Println("  help")
 	fmt.Println()
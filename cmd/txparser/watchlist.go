@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// watchlistEntry is a subscription read from a watchlist file, with the
+// place it was read from for error reports.
+type watchlistEntry struct {
+	where string
+	sub   svc.Subscription
+}
+
+// readWatchlist reads the subscriptions of a watchlist file. The format
+// follows the extension: .json for an array of subscriptions, .csv for a
+// table with an address column, anything else for one address per line
+// optionally followed by the details of the subscribe command. Entries
+// which can't be parsed are returned as errors, the others are still read.
+func readWatchlist(path string) ([]watchlistEntry, []error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening watchlist: %w", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readWatchlistJSON(f)
+	case ".csv":
+		return readWatchlistCSV(f)
+	default:
+		return readWatchlistLines(f)
+	}
+}
+
+// readWatchlistJSON reads an array of subscriptions. Each element is
+// decoded on its own, so an invalid one is reported without dropping the
+// others.
+func readWatchlistJSON(r io.Reader) ([]watchlistEntry, []error, error) {
+	var raws []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raws); err != nil {
+		return nil, nil, fmt.Errorf("reading watchlist: %w", err)
+	}
+	var (
+		entries []watchlistEntry
+		errs    []error
+	)
+	for i, raw := range raws {
+		where := fmt.Sprintf("entry %d", i+1)
+		var sub svc.Subscription
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			continue
+		}
+		if sub.Source == "" {
+			sub.Source = "import"
+		}
+		entries = append(entries, watchlistEntry{where: where, sub: sub})
+	}
+	return entries, errs, nil
+}
+
+// readWatchlistCSV reads a table whose first row names the columns:
+// address, labels (separated by semicolons), owner, source, expires and
+// meta.<key>.
+func readWatchlistCSV(r io.Reader) ([]watchlistEntry, []error, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading watchlist header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "address", name == "labels", name == "owner", name == "source", name == "expires", strings.HasPrefix(name, "meta."):
+			columns[name] = i
+		default:
+			return nil, nil, fmt.Errorf("reading watchlist header: unknown column %q", name)
+		}
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, nil, errors.New("reading watchlist header: missing address column")
+	}
+
+	var (
+		entries []watchlistEntry
+		errs    []error
+	)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		where := fmt.Sprintf("line %d", line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		sub := svc.Subscription{Address: field("address"), Owner: field("owner"), Source: field("source")}
+		if sub.Source == "" {
+			sub.Source = "import"
+		}
+		for _, label := range strings.Split(field("labels"), ";") {
+			if label = strings.TrimSpace(label); label != "" {
+				sub.Labels = append(sub.Labels, label)
+			}
+		}
+		for name := range columns {
+			if value := field(name); strings.HasPrefix(name, "meta.") && value != "" {
+				if sub.Metadata == nil {
+					sub.Metadata = make(map[string]string)
+				}
+				sub.Metadata[strings.TrimPrefix(name, "meta.")] = value
+			}
+		}
+		if expires := field("expires"); expires != "" {
+			t, err := parseExpiry(expires)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", where, err))
+				continue
+			}
+			sub.ExpiresAt = &t
+		}
+		entries = append(entries, watchlistEntry{where: where, sub: sub})
+	}
+	return entries, errs, nil
+}
+
+// readWatchlistLines reads one address per line. Blank lines and lines
+// starting with # are skipped.
+func readWatchlistLines(r io.Reader) ([]watchlistEntry, []error, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading watchlist: %w", err)
+	}
+	var (
+		entries []watchlistEntry
+		errs    []error
+	)
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		where := fmt.Sprintf("line %d", i+1)
+		sub, err := subscription(fields[0], fields[1:])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			continue
+		}
+		if sub.Source == "cli" {
+			sub.Source = "import"
+		}
+		entries = append(entries, watchlistEntry{where: where, sub: sub})
+	}
+	return entries, errs, nil
+}
+
+// writeWatchlist writes the subscriptions to a watchlist file, in the
+// format given by the extension as in readWatchlist. Only the addresses
+// are written in the line format.
+func writeWatchlist(path string, subs []svc.Subscription) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating watchlist: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(subs)
+	case ".csv":
+		err = writeWatchlistCSV(f, subs)
+	default:
+		for _, sub := range subs {
+			if _, err = fmt.Fprintln(f, sub.Address); err != nil {
+				break
+			}
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing watchlist: %w", err)
+	}
+	return nil
+}
+
+func writeWatchlistCSV(w io.Writer, subs []svc.Subscription) error {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, sub := range subs {
+		for k := range sub.Metadata {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	header := []string{"address", "labels", "owner", "source", "expires"}
+	for _, k := range keys {
+		header = append(header, "meta."+k)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		expires := ""
+		if sub.ExpiresAt != nil {
+			expires = sub.ExpiresAt.Format(time.RFC3339)
+		}
+		record := []string{sub.Address, strings.Join(sub.Labels, ";"), sub.Owner, sub.Source, expires}
+		for _, k := range keys {
+			record = append(record, sub.Metadata[k])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
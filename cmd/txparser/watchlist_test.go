@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+const (
+	alice = "0x388C818CA8B9251b393131C08a736A67ccB19297"
+	bob   = "0x95222290DD7278Aa3Ddd389Cc1E1d165CC4BAfe5"
+)
+
+func TestWatchlist(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		testID := 0
+		expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		tt := []struct {
+			name    string
+			file    string
+			content string
+			entries []watchlistEntry
+			errs    []string
+			fails   bool
+		}{
+			{
+				name: "lines",
+				file: "watchlist.txt",
+				content: "# hot wallets\n" +
+					alice + " label=hot owner=ops meta.desk=otc\n" +
+					"\n" +
+					"0x1234 source=cli\n" +
+					bob + " colour=red\n" +
+					bob + " source=cli expires=2030-01-02T03:04:05Z\n",
+				entries: []watchlistEntry{
+					{where: "line 2", sub: svc.Subscription{Address: alice, Source: "import", Owner: "ops", Labels: []string{"hot"}, Metadata: map[string]string{"desk": "otc"}}},
+					{where: "line 4", sub: svc.Subscription{Address: "0x1234", Source: "import"}},
+					{where: "line 6", sub: svc.Subscription{Address: bob, Source: "import", ExpiresAt: &expires}},
+				},
+				errs: []string{"line 5: unknown detail"},
+			},
+			{
+				name: "csv",
+				file: "watchlist.CSV",
+				content: "address, labels, owner, source, expires, meta.desk\n" +
+					alice + ",hot; cold,ops,,,otc\n" +
+					bob + ",,,crm,not a time,\n" +
+					bob + ",\"unterminated\n",
+				entries: []watchlistEntry{
+					{where: "line 2", sub: svc.Subscription{Address: alice, Source: "import", Owner: "ops", Labels: []string{"hot", "cold"}, Metadata: map[string]string{"desk": "otc"}}},
+				},
+				errs: []string{"line 3: ", "line 4: "},
+			},
+			{
+				name:    "csv without address column",
+				file:    "watchlist.csv",
+				content: "labels,owner\nhot,ops\n",
+				fails:   true,
+			},
+			{
+				name:    "csv with unknown column",
+				file:    "watchlist.csv",
+				content: "address,colour\n" + alice + ",red\n",
+				fails:   true,
+			},
+			{
+				name: "json",
+				file: "watchlist.json",
+				content: `[
+					{"address": "` + alice + `", "labels": ["hot"], "owner": "ops"},
+					{"address": 42},
+					{"address": "` + bob + `", "source": "crm", "expiresAt": "2030-01-02T03:04:05Z"},
+					"` + bob + `"
+				]`,
+				entries: []watchlistEntry{
+					{where: "entry 1", sub: svc.Subscription{Address: alice, Source: "import", Owner: "ops", Labels: []string{"hot"}}},
+					{where: "entry 3", sub: svc.Subscription{Address: bob, Source: "crm", ExpiresAt: &expires}},
+				},
+				errs: []string{"entry 2: ", "entry 4: "},
+			},
+			{
+				name:    "json which is not an array",
+				file:    "watchlist.json",
+				content: `{"address": "` + alice + `"}`,
+				fails:   true,
+			},
+		}
+
+		for _, tc := range tt {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould write the %s watchlist : %v", Failed, testID, tc.name, err)
+			}
+
+			entries, errs, err := readWatchlist(path)
+			if tc.fails {
+				if err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould reject the %s watchlist : Got %+v", Failed, testID, tc.name, entries)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould read the %s watchlist : %v", Failed, testID, tc.name, err)
+			}
+			if !reflect.DeepEqual(entries, tc.entries) {
+				t.Fatalf("\t%s\tTest %d:\tShould read the entries of the %s watchlist : Expected %+v. Got %+v", Failed, testID, tc.name, tc.entries, entries)
+			}
+			if len(errs) != len(tc.errs) {
+				t.Fatalf("\t%s\tTest %d:\tShould report the rejected entries of the %s watchlist : Expected %q. Got %v", Failed, testID, tc.name, tc.errs, errs)
+			}
+			for i, want := range tc.errs {
+				if !strings.HasPrefix(errs[i].Error(), want) {
+					t.Fatalf("\t%s\tTest %d:\tShould report where entries of the %s watchlist are rejected : Expected %q. Got %v", Failed, testID, tc.name, want, errs[i])
+				}
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould read watchlists in every format", Success, testID)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		testID := 1
+		expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		subs := []svc.Subscription{
+			{Address: alice, Source: "cli", Owner: "ops", Labels: []string{"hot", "cold"}, Metadata: map[string]string{"desk": "otc"}, ExpiresAt: &expires},
+			{Address: bob, Source: "crm"},
+		}
+
+		for _, file := range []string{"watchlist.json", "watchlist.csv", "watchlist.txt"} {
+			path := filepath.Join(t.TempDir(), file)
+			if err := writeWatchlist(path, subs); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould write %s : %v", Failed, testID, file, err)
+			}
+			entries, errs, err := readWatchlist(path)
+			if err != nil || len(errs) != 0 || len(entries) != len(subs) {
+				t.Fatalf("\t%s\tTest %d:\tShould read %s back : Got %+v, %v, %v", Failed, testID, file, entries, errs, err)
+			}
+			for i, e := range entries {
+				if e.sub.Address != subs[i].Address {
+					t.Fatalf("\t%s\tTest %d:\tShould read the addresses of %s back : Got %s", Failed, testID, file, e.sub.Address)
+				}
+				if file != "watchlist.txt" && !reflect.DeepEqual(e.sub, subs[i]) {
+					t.Fatalf("\t%s\tTest %d:\tShould read the details of %s back : Expected %+v. Got %+v", Failed, testID, file, subs[i], e.sub)
+				}
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould read written watchlists back", Success, testID)
+	})
+}
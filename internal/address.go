@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/keccak"
+)
+
+// AddressLength is the length of an address in bytes.
+const AddressLength = 20
+
+// Address is an Ethereum account address. It renders in the EIP-55 mixed
+// case checksummed form.
+type Address [AddressLength]byte
+
+// ParseAddress parses a 0x prefixed hex encoded address. Addresses in a
+// single case are accepted as is, mixed case ones must carry a valid
+// EIP-55 checksum. Errors wrap ErrInvalidAddress.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	if len(s) != 2+2*AddressLength || (s[:2] != "0x" && s[:2] != "0X") {
+		return a, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	if _, err := hex.Decode(a[:], []byte(s[2:])); err != nil {
+		return a, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	digits := s[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && digits != a.Hex()[2:] {
+		return a, fmt.Errorf("%w: bad checksum %q", ErrInvalidAddress, s)
+	}
+	return a, nil
+}
+
+// Hex returns the EIP-55 checksummed form of the address: a hex letter is
+// upper case when the matching nibble of the Keccak-256 hash of the lower
+// case hex address is 8 or more.
+func (a Address) Hex() string {
+	digits := []byte(hex.EncodeToString(a[:]))
+	hash := keccak.Sum256(digits)
+	for i, c := range digits {
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if c >= 'a' && nibble >= 8 {
+			digits[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(digits)
+}
+
+// Canonical returns the lower case hex form of the address bytes, under
+// which addresses are stored and compared.
+func (a Address) Canonical() string {
+	return "0x" + hex.EncodeToString(a[:])
+}
+
+func (a Address) String() string {
+	return a.Hex()
+}
+
+// IsZero reports whether a is the zero address.
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// MarshalText encodes the address in its checksummed form.
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+// UnmarshalText parses the address as ParseAddress does. The empty text,
+// stored by earlier versions for absent addresses, is the zero address;
+// Transaction decodes an empty recipient as absent instead.
+func (a *Address) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*a = Address{}
+		return nil
+	}
+	parsed, err := ParseAddress(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Checksummed returns the address in its checksummed form, or s unchanged
+// if it is not a valid address, such as the empty recipient of a contract
+// creation.
+func Checksummed(s string) string {
+	a, err := ParseAddress(s)
+	if err != nil {
+		return s
+	}
+	return a.Hex()
+}
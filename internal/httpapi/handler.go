@@ -0,0 +1,373 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// handler routes the requests to the parser.
+type handler struct {
+	parser  svc.ParserV2
+	scanner Scanner
+}
+
+// NewHandler returns the handler of the REST API over the parser.
+func NewHandler(parser svc.ParserV2, scanner Scanner) http.Handler {
+	h := &handler{parser: parser, scanner: scanner}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi.yaml", h.openAPI)
+	mux.HandleFunc("/v1/status", h.status)
+	mux.HandleFunc("/v1/subscriptions", h.subscriptions)
+	mux.HandleFunc("/v1/subscriptions/", h.subscription)
+	mux.HandleFunc("/v1/addresses/", h.transactions)
+	mux.HandleFunc("/v1/transactions/", h.transaction)
+	return mux
+}
+
+func (h *handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPI)
+}
+
+// status serves GET /v1/status.
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.scanner.Status())
+}
+
+// subscriptions serves GET /v1/subscriptions, listing the subscriptions
+// matching the query, and POST /v1/subscriptions, subscribing the address
+// of the body.
+func (h *handler) subscriptions(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		filter, err := subscriptionFilter(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		subs, err := h.parser.ListSubscriptions(r.Context(), filter)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if subs == nil {
+			subs = []svc.Subscription{}
+		}
+		writeJSON(w, http.StatusOK, subs)
+		return
+	}
+
+	var sub svc.Subscription
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sub); err != nil {
+		writeError(w, badRequest(fmt.Errorf("invalid subscription: %w", err)))
+		return
+	}
+	if sub.Source == "" {
+		sub.Source = "api"
+	}
+	if err := h.parser.SubscribeWith(r.Context(), sub); err != nil {
+		writeError(w, err)
+		return
+	}
+	saved, err := h.parser.GetSubscription(r.Context(), sub.Address)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, saved)
+}
+
+// subscription serves GET and DELETE /v1/subscriptions/{address}.
+func (h *handler) subscription(w http.ResponseWriter, r *http.Request) {
+	address, ok := pathParam(w, r, "/v1/subscriptions/", "")
+	if !ok || !allow(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		sub, err := h.parser.GetSubscription(r.Context(), address)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+		return
+	}
+
+	opts, err := retention(r.URL.Query().Get("retention"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.parser.Unsubscribe(r.Context(), address, opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transactions serves GET /v1/addresses/{address}/transactions, a page of
+// the history of the address matching the query.
+func (h *handler) transactions(w http.ResponseWriter, r *http.Request) {
+	address, ok := pathParam(w, r, "/v1/addresses/", "/transactions")
+	if !ok || !allow(w, r, http.MethodGet) {
+		return
+	}
+	opts, err := queryOptions(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := h.parser.ListTransactions(r.Context(), address, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if page.Transactions == nil {
+		page.Transactions = []svc.Transaction{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// transaction serves GET /v1/transactions/{hash}.
+func (h *handler) transaction(w http.ResponseWriter, r *http.Request) {
+	hash, ok := pathParam(w, r, "/v1/transactions/", "")
+	if !ok || !allow(w, r, http.MethodGet) {
+		return
+	}
+	lookup, err := h.parser.GetTransaction(r.Context(), hash)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lookup)
+}
+
+// pathParam returns the path segment between the prefix and the suffix,
+// replying not found if there is none.
+func pathParam(w http.ResponseWriter, r *http.Request, prefix, suffix string) (string, bool) {
+	param := strings.TrimPrefix(r.URL.Path, prefix)
+	if suffix != "" {
+		if !strings.HasSuffix(param, suffix) {
+			param = ""
+		}
+		param = strings.TrimSuffix(param, suffix)
+	}
+	if param == "" || strings.Contains(param, "/") {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "not found"})
+		return "", false
+	}
+	return param, true
+}
+
+// allow replies method not allowed unless the request uses one of the
+// given methods.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, errorBody{Error: "method not allowed"})
+	return false
+}
+
+// subscriptionFilter parses the query of a subscription listing: owner,
+// source, label (repeatable), meta.<key>, q for free text and all to
+// include expired subscriptions.
+func subscriptionFilter(r *http.Request) (svc.SubscriptionFilter, error) {
+	var filter svc.SubscriptionFilter
+	for key, values := range r.URL.Query() {
+		value := values[len(values)-1]
+		switch {
+		case key == "owner":
+			filter.Owner = value
+		case key == "source":
+			filter.Source = value
+		case key == "label":
+			filter.Labels = append(filter.Labels, values...)
+		case key == "q":
+			filter.Text = value
+		case key == "all":
+			all, err := strconv.ParseBool(value)
+			if err != nil {
+				return filter, badRequest(fmt.Errorf("invalid all %q: expected a boolean", value))
+			}
+			filter.IncludeExpired = all
+		case strings.HasPrefix(key, "meta."):
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			filter.Metadata[strings.TrimPrefix(key, "meta.")] = value
+		default:
+			return filter, badRequest(fmt.Errorf("unknown parameter %q", key))
+		}
+	}
+	return filter, nil
+}
+
+// queryOptions parses the query of a transaction listing: fromBlock,
+// toBlock, since and until (RFC 3339), direction (in or out),
+// counterparty, min and max values in wei, kind (repeatable), status
+// (success or failed), method (selector or name), and the limit, order
+// (asc or desc) and cursor of the page.
+func queryOptions(r *http.Request) ([]svc.QueryOption, error) {
+	var opts []svc.QueryOption
+	for key, values := range r.URL.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "fromBlock", "toBlock":
+			block, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, badRequest(fmt.Errorf("invalid %s %q: expected a block number", key, value))
+			}
+			if key == "fromBlock" {
+				opts = append(opts, svc.FromBlock(block))
+			} else {
+				opts = append(opts, svc.ToBlock(block))
+			}
+		case "since", "until":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, badRequest(fmt.Errorf("invalid %s %q: expected an RFC 3339 time", key, value))
+			}
+			if key == "since" {
+				opts = append(opts, svc.Since(t))
+			} else {
+				opts = append(opts, svc.Until(t))
+			}
+		case "direction":
+			switch value {
+			case "in":
+				opts = append(opts, svc.WithDirection(svc.Incoming))
+			case "out":
+				opts = append(opts, svc.WithDirection(svc.Outgoing))
+			default:
+				return nil, badRequest(fmt.Errorf("invalid direction %q: expected in or out", value))
+			}
+		case "counterparty":
+			opts = append(opts, svc.WithCounterparty(value))
+		case "min", "max":
+			v, ok := new(big.Int).SetString(value, 10)
+			if !ok || v.Sign() < 0 {
+				return nil, badRequest(fmt.Errorf("invalid %s %q: expected a value in wei", key, value))
+			}
+			if key == "min" {
+				opts = append(opts, svc.MinValue(v))
+			} else {
+				opts = append(opts, svc.MaxValue(v))
+			}
+		case "kind":
+			opts = append(opts, svc.WithKinds(values...))
+		case "status":
+			switch value {
+			case "success":
+				opts = append(opts, svc.WithStatus(svc.StatusSuccess))
+			case "failed":
+				opts = append(opts, svc.WithStatus(svc.StatusFailed))
+			default:
+				return nil, badRequest(fmt.Errorf("invalid status %q: expected success or failed", value))
+			}
+		case "method":
+			opts = append(opts, svc.WithMethod(value))
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, badRequest(fmt.Errorf("invalid limit %q", value))
+			}
+			opts = append(opts, svc.WithLimit(n))
+		case "order":
+			switch value {
+			case "asc":
+				opts = append(opts, svc.WithOrder(svc.Ascending))
+			case "desc":
+				opts = append(opts, svc.WithOrder(svc.Descending))
+			default:
+				return nil, badRequest(fmt.Errorf("invalid order %q: expected asc or desc", value))
+			}
+		case "cursor":
+			opts = append(opts, svc.WithCursor(value))
+		default:
+			return nil, badRequest(fmt.Errorf("unknown parameter %q", key))
+		}
+	}
+	return opts, nil
+}
+
+// retention parses the retention parameter of an unsubscription: keep
+// (default), purge, or a grace period such as 72h.
+func retention(value string) (svc.UnsubscribeOptions, error) {
+	switch value {
+	case "", "keep":
+		return svc.UnsubscribeOptions{Retention: svc.KeepHistory}, nil
+	case "purge":
+		return svc.UnsubscribeOptions{Retention: svc.PurgeHistory}, nil
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		return svc.UnsubscribeOptions{}, badRequest(fmt.Errorf("invalid retention %q: expected keep, purge or a grace period", value))
+	}
+	return svc.UnsubscribeOptions{Retention: svc.ExpireHistory, GracePeriod: grace}, nil
+}
+
+// errBadRequest marks the errors of malformed requests.
+var errBadRequest = errors.New("bad request")
+
+func badRequest(err error) error {
+	return fmt.Errorf("%w: %v", errBadRequest, err)
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeError replies with the status matching the error of the parser.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest),
+		errors.Is(err, svc.ErrInvalidAddress),
+		errors.Is(err, svc.ErrInvalidHash),
+		errors.Is(err, svc.ErrInvalidCursor),
+		errors.Is(err, svc.ErrInvalidRange):
+		code = http.StatusBadRequest
+	case errors.Is(err, svc.ErrNotSubscribed), errors.Is(err, svc.ErrTransactionNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, svc.ErrStoreUnavailable),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusServiceUnavailable
+	}
+	if code == http.StatusInternalServerError {
+		fmt.Println("error serving request: ", err)
+	}
+	writeJSON(w, code, errorBody{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("error writing response: ", err)
+	}
+}
@@ -0,0 +1,187 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/httpapi"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/txparser"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+const (
+	alice = "0x388c818ca8b9251b393131c08a736a67ccb19297"
+	bob   = "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"
+)
+
+func hash(s string) svc.Hash {
+	h, _ := svc.ParseHash("0x" + strings.Repeat("0", 64-len(s)) + s)
+	return h
+}
+
+func address(s string) svc.Address {
+	a, _ := svc.ParseAddress(s)
+	return a
+}
+
+// call sends the request to the server and decodes the JSON response into
+// v, if given. It returns the status code.
+func call(t *testing.T, srv *httptest.Server, method, path string, body interface{}, v interface{}) int {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decoding response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Subscriptions", func(t *testing.T) {
+		testID := 0
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 100)
+		srv := httptest.NewServer(httpapi.NewHandler(service.V2(), service))
+		defer srv.Close()
+
+		var sub svc.Subscription
+		if code := call(t, srv, http.MethodPost, "/v1/subscriptions", svc.Subscription{Address: alice, Labels: []string{"hot"}}, &sub); code != http.StatusCreated || sub.Address != svc.Checksummed(alice) || sub.Source != "api" || sub.StartBlock != 101 {
+			t.Fatalf("\t%s\tTest %d:\tShould subscribe the address : Got %d, %+v", Failed, testID, code, sub)
+		}
+		if code := call(t, srv, http.MethodPost, "/v1/subscriptions", svc.Subscription{Address: "0x1234"}, nil); code != http.StatusBadRequest {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed addresses : Got %d", Failed, testID, code)
+		}
+		call(t, srv, http.MethodPost, "/v1/subscriptions", svc.Subscription{Address: bob}, nil)
+
+		var subs []svc.Subscription
+		if code := call(t, srv, http.MethodGet, "/v1/subscriptions?label=hot", nil, &subs); code != http.StatusOK || len(subs) != 1 || subs[0].Address != svc.Checksummed(alice) {
+			t.Fatalf("\t%s\tTest %d:\tShould list the subscriptions matching the filter : Got %d, %+v", Failed, testID, code, subs)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/subscriptions?colour=red", nil, nil); code != http.StatusBadRequest {
+			t.Fatalf("\t%s\tTest %d:\tShould reject unknown parameters : Got %d", Failed, testID, code)
+		}
+
+		if code := call(t, srv, http.MethodDelete, "/v1/subscriptions/"+bob+"?retention=purge", nil, nil); code != http.StatusNoContent {
+			t.Fatalf("\t%s\tTest %d:\tShould unsubscribe the address : Got %d", Failed, testID, code)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/subscriptions/"+bob, nil, nil); code != http.StatusNotFound {
+			t.Fatalf("\t%s\tTest %d:\tShould report unknown subscriptions : Got %d", Failed, testID, code)
+		}
+		if code := call(t, srv, http.MethodPut, "/v1/subscriptions/"+alice, nil, nil); code != http.StatusMethodNotAllowed {
+			t.Fatalf("\t%s\tTest %d:\tShould reject unsupported methods : Got %d", Failed, testID, code)
+		}
+		t.Logf("\t%s\tTest %d:\tShould manage subscriptions over HTTP", Success, testID)
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		testID := 1
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 200)
+		srv := httptest.NewServer(httpapi.NewHandler(service.V2(), service))
+		defer srv.Close()
+
+		service.Subscribe(alice)
+		to := address(bob)
+		from := address(alice)
+		service.SaveTxs(service.Pull([]svc.Transaction{
+			{Kind: svc.KindTransaction, Hash: hash("a0"), From: address(alice), To: &to, Value: svc.NewBig(big.NewInt(1)), BlockNumber: 201},
+			{Kind: svc.KindTransaction, Hash: hash("a1"), From: address(bob), To: &from, Value: svc.NewBig(big.NewInt(2)), BlockNumber: 202},
+		}))
+
+		var page svc.TransactionPage
+		if code := call(t, srv, http.MethodGet, "/v1/addresses/"+alice+"/transactions?limit=1", nil, &page); code != http.StatusOK || len(page.Transactions) != 1 || page.NextCursor == "" {
+			t.Fatalf("\t%s\tTest %d:\tShould return the first page : Got %d, %+v", Failed, testID, code, page)
+		}
+		var next svc.TransactionPage
+		if code := call(t, srv, http.MethodGet, "/v1/addresses/"+alice+"/transactions?limit=1&cursor="+page.NextCursor, nil, &next); code != http.StatusOK || len(next.Transactions) != 1 || next.Transactions[0].Hash != hash("a1") {
+			t.Fatalf("\t%s\tTest %d:\tShould return the next page : Got %d, %+v", Failed, testID, code, next)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/addresses/"+alice+"/transactions?direction=out&fromBlock=201", nil, &page); code != http.StatusOK || len(page.Transactions) != 1 || page.Transactions[0].Hash != hash("a0") {
+			t.Fatalf("\t%s\tTest %d:\tShould filter the transactions : Got %d, %+v", Failed, testID, code, page)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/addresses/"+alice+"/transactions?direction=up", nil, nil); code != http.StatusBadRequest {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed filters : Got %d", Failed, testID, code)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/addresses/"+bob+"/transactions", nil, nil); code != http.StatusNotFound {
+			t.Fatalf("\t%s\tTest %d:\tShould report unknown addresses : Got %d", Failed, testID, code)
+		}
+
+		var lookup svc.TransactionLookup
+		if code := call(t, srv, http.MethodGet, "/v1/transactions/"+hash("a0").Hex(), nil, &lookup); code != http.StatusOK || lookup.Transaction.Hash != hash("a0") || len(lookup.Addresses) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould look the transaction up : Got %d, %+v", Failed, testID, code, lookup)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/transactions/0xa0", nil, nil); code != http.StatusBadRequest {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed hashes : Got %d", Failed, testID, code)
+		}
+		if code := call(t, srv, http.MethodGet, "/v1/transactions/"+hash("a9").Hex(), nil, nil); code != http.StatusNotFound {
+			t.Fatalf("\t%s\tTest %d:\tShould report unknown transactions : Got %d", Failed, testID, code)
+		}
+		t.Logf("\t%s\tTest %d:\tShould serve transactions over HTTP", Success, testID)
+	})
+
+	t.Run("StatusAndShutdown", func(t *testing.T) {
+		testID := 2
+		ctx, cancel := context.WithCancel(context.Background())
+		service := txparser.New(ctx, "http://127.0.0.1:0", 300)
+		handler := httpapi.NewHandler(service.V2(), service)
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		var status svc.ScannerStatus
+		if code := call(t, srv, http.MethodGet, "/v1/status", nil, &status); code != http.StatusOK || status.CurrentBlock != 300 || !status.Leader || status.Running {
+			t.Fatalf("\t%s\tTest %d:\tShould report the scanner status : Got %d, %+v", Failed, testID, code, status)
+		}
+		resp, err := srv.Client().Get(srv.URL + "/openapi.yaml")
+		if err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould serve the OpenAPI document : %v", Failed, testID, err)
+		}
+		doc, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(doc, []byte("openapi: 3")) {
+			t.Fatalf("\t%s\tTest %d:\tShould serve the OpenAPI document : Got %d", Failed, testID, resp.StatusCode)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- httpapi.ListenAndServe(ctx, "127.0.0.1:0", handler)
+		}()
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould shut down gracefully : %v", Failed, testID, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("\t%s\tTest %d:\tShould shut down with the context", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould report the status and shut down with the scanner context", Success, testID)
+	})
+}
@@ -0,0 +1,58 @@
+// Package httpapi serves the parser as a JSON REST API. The routes are
+// described by the OpenAPI document served at /openapi.yaml.
+package httpapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// ShutdownTimeout is the time given to requests in flight to complete
+// once the server is shut down.
+var ShutdownTimeout = time.Second * 10
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+// Scanner reports the progress of the block scanner.
+type Scanner interface {
+	Status() svc.ScannerStatus
+}
+
+// ListenAndServe serves the handler on the address until the context is
+// done, then shuts the server down gracefully. It returns nil once the
+// server is shut down.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("error serving http: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down http server: %w", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving http: %w", err)
+	}
+	return nil
+}
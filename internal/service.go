@@ -1,6 +1,48 @@
 package service
 
-import "math/big"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotSubscribed is returned for an address which is neither
+	// subscribed nor has a kept history.
+	ErrNotSubscribed = errors.New("address not subscribed")
+
+	// ErrInvalidAddress is returned for a malformed address.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrStoreUnavailable is returned when the state could not be read or
+	// written.
+	ErrStoreUnavailable = errors.New("store unavailable")
+
+	// ErrInvalidCursor is returned for a malformed pagination cursor.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrDuplicateSubscription is returned for an address given more
+	// than once to SubscribeMany.
+	ErrDuplicateSubscription = errors.New("duplicate subscription")
+
+	// ErrInvalidRange is returned for an unknown bucket size, or a time
+	// range which is empty or spans too many buckets.
+	ErrInvalidRange = errors.New("invalid range")
+
+	// ErrTransactionNotFound is returned for a hash which was not indexed
+	// for any subscribed address.
+	ErrTransactionNotFound = errors.New("transaction not found")
+
+	// ErrInvalidHash is returned for a malformed transaction hash.
+	ErrInvalidHash = errors.New("invalid hash")
+)
 
 type Parser interface {
 	// last parsed block
@@ -9,19 +51,992 @@ type Parser interface {
 	// add address to observer
 	Subscribe(address string) bool
 
+	// add address to observer along with its registry details
+	SubscribeWith(sub Subscription) bool
+
+	// add addresses to observer along with their registry details,
+	// reporting the outcome for each of them
+	SubscribeMany(subs []Subscription) []SubscribeResult
+
+	// registry details of a subscribed address
+	GetSubscription(address string) (Subscription, bool)
+
+	// subscriptions matching the filter, all of them for the zero filter
+	ListSubscriptions(filter SubscriptionFilter) []Subscription
+
+	// remove address from observer, applying the retention policy
+	// to its transaction history
+	Unsubscribe(address string, opts UnsubscribeOptions) bool
+
 	// list of inbound or outbound transactions for an address
-	GetTransactions(address string) []Transaction
+	GetTransactions(address string, opts ...QueryOption) []Transaction
+
+	// transaction with the given hash and the subscribed addresses it
+	// touched
+	GetTransaction(hash string) (TransactionLookup, bool)
+
+	// total fees paid by an address on its outgoing transactions
+	GetFees(address string, opts ...QueryOption) *big.Int
+
+	// balance of an address according to its indexed history
+	GetBalance(address string) *big.Int
+
+	// differences found between the indexed and the on-chain balance
+	GetBalanceMismatches(address string) []BalanceMismatch
+
+	// outgoing nonces indexed for an address and the gaps found in them
+	GetNonceStatus(address string) NonceStatus
+
+	// aggregates of the indexed history of an address
+	GetStats(address string) Stats
+
+	// activity of an address per time bucket over a time range
+	GetRollups(address string, bucket Bucket, from, to time.Time) []Rollup
+
+	// activity of every subscribed address per time bucket over a time
+	// range
+	GetTotalRollups(bucket Bucket, from, to time.Time) []Rollup
 }
 
+// ParserV2 is the Parser API reporting failures as errors. Every method
+// takes a context and returns ErrInvalidAddress, ErrNotSubscribed or
+// ErrStoreUnavailable, possibly wrapped, when it fails.
+type ParserV2 interface {
+	// last parsed block
+	GetCurrentBlock(ctx context.Context) (int, error)
+
+	// add address to observer, keeping its details if already subscribed
+	Subscribe(ctx context.Context, address string) error
+
+	// add address to observer along with its registry details
+	SubscribeWith(ctx context.Context, sub Subscription) error
+
+	// add addresses to observer along with their registry details,
+	// reporting the outcome for each of them
+	SubscribeMany(ctx context.Context, subs []Subscription) ([]SubscribeResult, error)
+
+	// registry details of a subscribed address
+	GetSubscription(ctx context.Context, address string) (Subscription, error)
+
+	// subscriptions matching the filter, all of them for the zero filter
+	ListSubscriptions(ctx context.Context, filter SubscriptionFilter) ([]Subscription, error)
+
+	// remove address from observer, applying the retention policy
+	// to its transaction history
+	Unsubscribe(ctx context.Context, address string, opts UnsubscribeOptions) error
+
+	// list of inbound or outbound transactions for an address
+	GetTransactions(ctx context.Context, address string, opts ...QueryOption) ([]Transaction, error)
+
+	// page of the transactions of an address, with the cursor of the
+	// next page
+	ListTransactions(ctx context.Context, address string, opts ...QueryOption) (TransactionPage, error)
+
+	// transaction with the given hash and the subscribed addresses it
+	// touched
+	GetTransaction(ctx context.Context, hash string) (TransactionLookup, error)
+
+	// total fees paid by an address on its outgoing transactions
+	GetFees(ctx context.Context, address string, opts ...QueryOption) (*big.Int, error)
+
+	// balance of an address according to its indexed history
+	GetBalance(ctx context.Context, address string) (*big.Int, error)
+
+	// differences found between the indexed and the on-chain balance
+	GetBalanceMismatches(ctx context.Context, address string) ([]BalanceMismatch, error)
+
+	// outgoing nonces indexed for an address and the gaps found in them
+	GetNonceStatus(ctx context.Context, address string) (NonceStatus, error)
+
+	// aggregates of the indexed history of an address
+	GetStats(ctx context.Context, address string) (Stats, error)
+
+	// activity of an address per time bucket over a time range
+	GetRollups(ctx context.Context, address string, bucket Bucket, from, to time.Time) ([]Rollup, error)
+
+	// activity of every subscribed address per time bucket over a time
+	// range
+	GetTotalRollups(ctx context.Context, bucket Bucket, from, to time.Time) ([]Rollup, error)
+}
+
+// ScannerStatus reports the progress of the block scanner.
+type ScannerStatus struct {
+	// CurrentBlock is the last scanned block.
+	CurrentBlock int `json:"currentBlock"`
+
+	// Leader is false on standby copies, which serve reads but don't
+	// scan blocks.
+	Leader bool `json:"leader"`
+
+	// Running is true while the scanning goroutine runs.
+	Running bool `json:"running"`
+
+	// LastRunAt is the end of the last scanning round, nil before the
+	// first one. LastError is the error the round stopped on, empty if
+	// it scanned every pending block.
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// NonceStatus summarizes the outgoing transactions indexed for a sender,
+// compared with its on-chain transaction count.
+type NonceStatus struct {
+	// Highest is the highest indexed nonce, nil if none was seen.
+	Highest *big.Int `json:"highest"`
+
+	// TransactionCount is the on-chain transaction count at the block
+	// of the last check.
+	TransactionCount uint64 `json:"transactionCount"`
+	CheckedAt        uint64 `json:"checkedAt"`
+
+	// Gaps are the nonces used on chain with no indexed transaction.
+	Gaps []NonceGap `json:"gaps"`
+}
+
+// Stats aggregates the indexed history of an address. Values and fees are
+// in wei and follow the balance rules: failed transactions transfer no
+// value but their fees are still counted.
+type Stats struct {
+	// Transactions is the number of entries of the history, Incoming
+	// and Outgoing the ones received and sent by the address. An entry
+	// sent to itself counts as both.
+	Transactions uint64 `json:"transactions"`
+	Incoming     uint64 `json:"incoming"`
+	Outgoing     uint64 `json:"outgoing"`
+
+	ValueIn  *big.Int `json:"valueIn"`
+	ValueOut *big.Int `json:"valueOut"`
+	Fees     *big.Int `json:"fees"`
+
+	// FirstBlock and LastBlock are the blocks of the oldest and the
+	// newest entries, 0 for an empty history.
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+
+	// Counterparties is the number of distinct addresses the address
+	// received from or sent to.
+	Counterparties uint64 `json:"counterparties"`
+}
+
+// Bucket is the time span activity is rolled up by. Buckets are aligned on
+// UTC hours and days.
+type Bucket string
+
+// Bucket sizes.
+const (
+	Hourly Bucket = "hour"
+	Daily  Bucket = "day"
+)
+
+// Duration returns the time span of the bucket, 0 for an unknown size.
+func (b Bucket) Duration() time.Duration {
+	switch b {
+	case Hourly:
+		return time.Hour
+	case Daily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Start returns the start of the bucket holding t.
+func (b Bucket) Start(t time.Time) time.Time {
+	return t.UTC().Truncate(b.Duration())
+}
+
+// Rollup is the activity of an address, or of every subscribed address,
+// over one bucket, by block timestamp. Values and fees are in wei and add
+// up as in Stats. The rollup of every address is the sum of their own.
+type Rollup struct {
+	Start    time.Time `json:"start"`
+	Count    uint64    `json:"count"`
+	ValueIn  *big.Int  `json:"valueIn"`
+	ValueOut *big.Int  `json:"valueOut"`
+	Fees     *big.Int  `json:"fees"`
+}
+
+// NonceGap is an outgoing transaction the indexer failed to store.
+type NonceGap struct {
+	Nonce uint64 `json:"nonce"`
+
+	// Block is the block the transaction was mined in, 0 if it could
+	// not be located.
+	Block uint64 `json:"block"`
+}
+
+// BalanceMismatch records a reconciliation where the balance derived from
+// the indexed history differed from the on-chain balance, meaning some
+// balance change was not indexed.
+type BalanceMismatch struct {
+	Block    uint64   `json:"block"`
+	Expected *big.Int `json:"expected"`
+	Actual   *big.Int `json:"actual"`
+}
+
+// Diff returns the on-chain balance minus the indexed balance.
+func (m BalanceMismatch) Diff() *big.Int {
+	return new(big.Int).Sub(m.Actual, m.Expected)
+}
+
+// Subscription is the registry entry of a subscribed address.
+type Subscription struct {
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// StartBlock is the first block scanned for the subscription.
+	StartBlock uint64 `json:"startBlock"`
+
+	// Source tells where the subscription came from, such as "cli".
+	Source   string            `json:"source,omitempty"`
+	Owner    string            `json:"owner,omitempty"`
+	Labels   []string          `json:"labels,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// ExpiresAt stops the scanning of the address once reached. Nil
+	// subscriptions never expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// SubscribeResult is the outcome of subscribing one address of a batch.
+// Err is nil when the address was subscribed.
+type SubscribeResult struct {
+	Address string
+	Err     error
+}
+
+// Expired reports whether the subscription is expired at the given time.
+func (s Subscription) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// HasLabel reports whether the subscription carries the label.
+func (s Subscription) HasLabel(label string) bool {
+	for _, l := range s.Labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriptionFilter selects subscriptions in ListSubscriptions. Empty
+// fields match every subscription.
+type SubscriptionFilter struct {
+	Owner  string
+	Source string
+
+	// Labels must all be carried by the subscription.
+	Labels []string
+
+	// Metadata entries must all be present with the same value.
+	Metadata map[string]string
+
+	// Text matches subscriptions whose address, owner, labels or metadata
+	// values contain it, ignoring case.
+	Text string
+
+	// IncludeExpired also returns expired subscriptions.
+	IncludeExpired bool
+}
+
+// Match reports whether the subscription passes the filter at the given
+// time.
+func (f SubscriptionFilter) Match(s Subscription, now time.Time) bool {
+	if !f.IncludeExpired && s.Expired(now) {
+		return false
+	}
+	if f.Owner != "" && !strings.EqualFold(f.Owner, s.Owner) {
+		return false
+	}
+	if f.Source != "" && !strings.EqualFold(f.Source, s.Source) {
+		return false
+	}
+	for _, l := range f.Labels {
+		if !s.HasLabel(l) {
+			return false
+		}
+	}
+	for k, v := range f.Metadata {
+		if got, ok := s.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	if f.Text != "" {
+		text := strings.ToLower(f.Text)
+		fields := append([]string{s.Address, s.Owner}, s.Labels...)
+		for _, v := range s.Metadata {
+			fields = append(fields, v)
+		}
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), text) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Retention is the policy applied to the stored history of an address
+// when it is unsubscribed.
+type Retention int
+
+const (
+	// KeepHistory keeps the transaction history available.
+	KeepHistory Retention = iota
+
+	// PurgeHistory deletes the transaction history right away.
+	PurgeHistory
+
+	// ExpireHistory deletes the transaction history once the grace period
+	// is over, unless the address is subscribed again in the meantime.
+	ExpireHistory
+)
+
+// UnsubscribeOptions configures Unsubscribe.
+type UnsubscribeOptions struct {
+	Retention Retention
+
+	// GracePeriod is the delay before the history is deleted when
+	// Retention is ExpireHistory.
+	GracePeriod time.Duration
+}
+
+// Tenant is a user of a shared parser. Each tenant has its own set of
+// subscriptions and histories, isolated from the other tenants.
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Filters select the entries indexed for the tenant addresses.
+	Filters TenantFilters `json:"filters"`
+
+	// DeliveryTargets are URLs the new entries of the tenant addresses
+	// are posted to once stored.
+	DeliveryTargets []string `json:"deliveryTargets,omitempty"`
+}
+
+// TenantFilters select the entries indexed for a tenant. Empty fields
+// match every entry.
+type TenantFilters struct {
+	// MinValue is the lowest value, in wei, of the indexed transactions
+	// and withdrawals.
+	MinValue *big.Int `json:"minValue,omitempty"`
+
+	// Kinds are the entry kinds indexed, such as KindTransaction.
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// Match reports whether the entry passes the filters.
+func (f TenantFilters) Match(tx Transaction) bool {
+	if len(f.Kinds) > 0 && !containsFold(f.Kinds, tx.Kind) {
+		return false
+	}
+	if f.MinValue != nil && tx.Kind != KindAuthorization {
+		if tx.Value == nil || tx.Value.ToInt().Cmp(f.MinValue) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Query holds the filters applied by GetTransactions. The zero value
+// matches every transaction.
+type Query struct {
+	// Since excludes transactions mined before the given time.
+	Since time.Time
+
+	// Until excludes transactions mined after the given time.
+	Until time.Time
+
+	// FromBlock excludes transactions mined before the given block.
+	FromBlock uint64
+
+	// ToBlock excludes transactions mined after the given block.
+	ToBlock uint64
+
+	// WithBalance sets the running balance after each transaction.
+	WithBalance bool
+
+	// Direction keeps the entries received or sent by the address.
+	Direction Direction
+
+	// Counterparty keeps the entries exchanged with the given address:
+	// the recipient of sent entries and the sender of received ones.
+	Counterparty string
+
+	// MinValue and MaxValue bound the value in wei, inclusive.
+	MinValue *big.Int
+	MaxValue *big.Int
+
+	// Kinds keeps the entries of the given kinds, such as KindTransaction.
+	Kinds []string
+
+	// Status keeps the transactions with the given execution status.
+	// Entries without a receipt only pass StatusAny.
+	Status Status
+
+	// Method keeps the transactions calling the given method, either a
+	// 4-byte selector such as "0xa9059cbb" or a decoded method name such
+	// as "transfer".
+	Method string
+
+	// Order is the order of the returned transactions by position in the
+	// chain.
+	Order Order
+
+	// Limit is the maximum number of returned transactions, 0 for no
+	// limit.
+	Limit int
+
+	// Cursor resumes the listing after the last transaction of a previous
+	// page, as returned in TransactionPage.NextCursor.
+	Cursor string
+}
+
+// Direction is the direction of an entry relative to the queried address.
+type Direction int
+
+const (
+	// AnyDirection keeps both received and sent entries.
+	AnyDirection Direction = iota
+
+	// Incoming keeps the entries received by the address.
+	Incoming
+
+	// Outgoing keeps the entries sent by the address.
+	Outgoing
+)
+
+// Status is the execution status of a transaction.
+type Status int
+
+const (
+	// StatusAny keeps every entry.
+	StatusAny Status = iota
+
+	// StatusSuccess keeps the transactions that were executed.
+	StatusSuccess
+
+	// StatusFailed keeps the transactions that were reverted.
+	StatusFailed
+)
+
+// TransactionLookup is a transaction found by hash.
+type TransactionLookup struct {
+	Transaction Transaction `json:"transaction"`
+
+	// Addresses are the subscribed addresses whose history holds an entry
+	// of the transaction, including the authorities of its EIP-7702
+	// authorizations.
+	Addresses []string `json:"addresses"`
+}
+
+// Order is the order of a transaction listing.
+type Order int
+
+const (
+	// Ascending lists the oldest transactions first.
+	Ascending Order = iota
+
+	// Descending lists the newest transactions first.
+	Descending
+)
+
+// TransactionPage is a page of a transaction listing.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+
+	// NextCursor resumes the listing after the page, empty on the last
+	// page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// QueryOption sets a GetTransactions filter.
+type QueryOption func(*Query)
+
+// Since returns transactions mined at or after t.
+func Since(t time.Time) QueryOption {
+	return func(q *Query) {
+		q.Since = t
+	}
+}
+
+// Until returns transactions mined at or before t.
+func Until(t time.Time) QueryOption {
+	return func(q *Query) {
+		q.Until = t
+	}
+}
+
+// FromBlock returns transactions mined at or after block n.
+func FromBlock(n uint64) QueryOption {
+	return func(q *Query) {
+		q.FromBlock = n
+	}
+}
+
+// ToBlock returns transactions mined at or before block n.
+func ToBlock(n uint64) QueryOption {
+	return func(q *Query) {
+		q.ToBlock = n
+	}
+}
+
+// WithBalance returns each transaction with the balance of the address
+// right after it.
+func WithBalance() QueryOption {
+	return func(q *Query) {
+		q.WithBalance = true
+	}
+}
+
+// WithDirection returns the entries received or sent by the address.
+func WithDirection(d Direction) QueryOption {
+	return func(q *Query) {
+		q.Direction = d
+	}
+}
+
+// WithCounterparty returns the entries exchanged with the address.
+func WithCounterparty(address string) QueryOption {
+	return func(q *Query) {
+		q.Counterparty = address
+	}
+}
+
+// MinValue returns the entries of at least v wei.
+func MinValue(v *big.Int) QueryOption {
+	return func(q *Query) {
+		q.MinValue = v
+	}
+}
+
+// MaxValue returns the entries of at most v wei.
+func MaxValue(v *big.Int) QueryOption {
+	return func(q *Query) {
+		q.MaxValue = v
+	}
+}
+
+// WithKinds returns the entries of the given kinds.
+func WithKinds(kinds ...string) QueryOption {
+	return func(q *Query) {
+		q.Kinds = append(q.Kinds, kinds...)
+	}
+}
+
+// WithStatus returns the transactions with the given execution status.
+func WithStatus(s Status) QueryOption {
+	return func(q *Query) {
+		q.Status = s
+	}
+}
+
+// WithMethod returns the transactions calling the method, given by
+// selector or name.
+func WithMethod(method string) QueryOption {
+	return func(q *Query) {
+		q.Method = method
+	}
+}
+
+// WithQuery replaces the query with q, for callers building the query
+// object directly.
+func WithQuery(q Query) QueryOption {
+	return func(dst *Query) {
+		*dst = q
+	}
+}
+
+// WithOrder lists transactions in the given order, ascending by default.
+func WithOrder(o Order) QueryOption {
+	return func(q *Query) {
+		q.Order = o
+	}
+}
+
+// WithLimit returns at most n transactions.
+func WithLimit(n int) QueryOption {
+	return func(q *Query) {
+		q.Limit = n
+	}
+}
+
+// WithCursor returns the transactions following the cursor of a previous
+// page.
+func WithCursor(cursor string) QueryOption {
+	return func(q *Query) {
+		q.Cursor = cursor
+	}
+}
+
+// NewQuery builds a query from the given options.
+func NewQuery(opts ...QueryOption) Query {
+	var q Query
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+// Match reports whether the transaction passes the query filters.
+func (q Query) Match(tx Transaction) bool {
+	if !q.Since.IsZero() && tx.Time().Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && tx.Time().After(q.Until) {
+		return false
+	}
+	if q.FromBlock != 0 && uint64(tx.BlockNumber) < q.FromBlock {
+		return false
+	}
+	if q.ToBlock != 0 && uint64(tx.BlockNumber) > q.ToBlock {
+		return false
+	}
+	if q.MinValue != nil && (tx.Value == nil || tx.Value.ToInt().Cmp(q.MinValue) < 0) {
+		return false
+	}
+	if q.MaxValue != nil && (tx.Value == nil || tx.Value.ToInt().Cmp(q.MaxValue) > 0) {
+		return false
+	}
+	if len(q.Kinds) > 0 && !containsFold(q.Kinds, tx.Kind) {
+		return false
+	}
+	if q.Status != StatusAny {
+		if tx.Receipt == nil || (tx.Receipt.Status == 1) != (q.Status == StatusSuccess) {
+			return false
+		}
+	}
+	if q.Method != "" && !matchMethod(q.Method, tx) {
+		return false
+	}
+	return true
+}
+
+// MatchFor reports whether the entry of the history of the address passes
+// the query filters, including the ones relative to the address: direction
+// and counterparty.
+func (q Query) MatchFor(address string, tx Transaction) bool {
+	if !q.Match(tx) {
+		return false
+	}
+	sent := tx.Sender() != "" && strings.EqualFold(tx.Sender(), address)
+	received := tx.Recipient() != "" && strings.EqualFold(tx.Recipient(), address)
+	switch q.Direction {
+	case Incoming:
+		if !received {
+			return false
+		}
+	case Outgoing:
+		if !sent {
+			return false
+		}
+	}
+	if q.Counterparty != "" {
+		peer := (sent && strings.EqualFold(tx.Recipient(), q.Counterparty)) || (received && strings.EqualFold(tx.Sender(), q.Counterparty))
+		if !peer {
+			return false
+		}
+	}
+	return true
+}
+
+func matchMethod(method string, tx Transaction) bool {
+	if strings.HasPrefix(method, "0x") {
+		return len(tx.Input) >= 4 && strings.EqualFold(tx.Input[:4].String(), method)
+	}
+	return tx.Call != nil && strings.EqualFold(tx.Call.Method, method)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transaction types, as carried by the typed transaction envelope.
+const (
+	LegacyTxType     = 0
+	AccessListTxType = 1
+	DynamicFeeTxType = 2
+	BlobTxType       = 3
+	SetCodeTxType    = 4
+)
+
+// Transaction kinds. A transaction hash may produce several entries of
+// different kinds for the same address.
+const (
+	KindTransaction   = "transaction"
+	KindWithdrawal    = "withdrawal"
+	KindAuthorization = "authorization"
+	KindInternal      = "internal"
+)
+
+// Transaction is an entry of an address history. It encodes in JSON as
+// the node does, with hex quantities and data and checksummed addresses.
 type Transaction struct {
-	ChainID     *big.Int `json:"chainId"`
-	BlockNumber *big.Int `json:"blockNumber"`
-	Hash        string   `json:"hash"`
-	Nonce       *big.Int `json:"nonce"`
-	From        string   `json:"from"`
-	To          string   `json:"to"`
-	Value       *big.Int `json:"value"`
-	Gas         *big.Int `json:"gas"`
-	GasPrice    *big.Int `json:"gasPrice"`
-	Input       string   `json:"input"`
+	Kind        string   `json:"kind"`
+	LogIndex    Uint64   `json:"logIndex"`
+	ChainID     *Big     `json:"chainId"`
+	BlockNumber Uint64   `json:"blockNumber"`
+	Hash        Hash     `json:"hash"`
+	Nonce       *Big     `json:"nonce"`
+	From        Address  `json:"from"`
+	To          *Address `json:"to"`
+	Value       *Big     `json:"value"`
+	Gas         *Big     `json:"gas"`
+	GasPrice    *Big     `json:"gasPrice"`
+	Input       Bytes    `json:"input"`
+	Timestamp   Uint64   `json:"timestamp"`
+
+	Call       *Call       `json:"call,omitempty"`
+	Withdrawal *Withdrawal `json:"withdrawal,omitempty"`
+
+	Authorization *Authorization `json:"authorization,omitempty"`
+	Internal      *Internal      `json:"internal,omitempty"`
+
+	// Receipt is the execution outcome of the transaction and Fee the
+	// amount charged to its sender, in wei.
+	Receipt *Receipt `json:"receipt,omitempty"`
+	Fee     *Big     `json:"fee,omitempty"`
+
+	// BalanceAfter is the balance of the queried address after the
+	// transaction. It is only set when requested with WithBalance.
+	BalanceAfter *Big `json:"balanceAfter,omitempty"`
+
+	Type                 Uint64        `json:"type"`
+	TransactionIndex     Uint64        `json:"transactionIndex"`
+	MaxFeePerGas         *Big          `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *Big          `json:"maxPriorityFeePerGas,omitempty"`
+	AccessList           []AccessTuple `json:"accessList,omitempty"`
+	MaxFeePerBlobGas     *Big          `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes  []Hash        `json:"blobVersionedHashes,omitempty"`
+
+	// Fee market fields of the block the transaction was mined in.
+	BaseFeePerGas *Big `json:"baseFeePerGas,omitempty"`
+	BlobGasUsed   *Big `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas *Big `json:"excessBlobGas,omitempty"`
+}
+
+// UnmarshalJSON decodes the transaction. An empty recipient, stored by
+// earlier versions for contract creations, is decoded as absent, as a null
+// or missing one is.
+func (t *Transaction) UnmarshalJSON(input []byte) error {
+	type transaction Transaction
+	var raw struct {
+		transaction
+		To json.RawMessage `json:"to"`
+	}
+	if err := json.Unmarshal(input, &raw); err != nil {
+		return err
+	}
+	*t = Transaction(raw.transaction)
+	if len(raw.To) == 0 || isNull(raw.To) || string(raw.To) == `""` {
+		return nil
+	}
+	var to Address
+	if err := json.Unmarshal(raw.To, &to); err != nil {
+		return err
+	}
+	t.To = &to
+	return nil
+}
+
+// Sender returns the canonical form of the sender of the entry, empty
+// for withdrawals which have none. The zero address is a sender like any
+// other, such as of the tokens minted by a Transfer log.
+func (t Transaction) Sender() string {
+	if t.Kind == KindWithdrawal {
+		return ""
+	}
+	return t.From.Canonical()
+}
+
+// Recipient returns the canonical form of the recipient of the entry,
+// empty for contract creations, which have no To. The zero address is a
+// recipient like any other, such as of burned tokens.
+func (t Transaction) Recipient() string {
+	if t.To == nil {
+		return ""
+	}
+	return t.To.Canonical()
+}
+
+// Authorization holds the details of a KindAuthorization entry: an
+// EIP-7702 authorization setting the code of Authority to a delegation to
+// Address. The zero address clears the delegation.
+type Authorization struct {
+	// Index is the position of the authorization in the transaction
+	// authorization list.
+	Index     int     `json:"index"`
+	ChainID   *Big    `json:"chainId"`
+	Address   Address `json:"address"`
+	Nonce     *Big    `json:"nonce"`
+	Authority Address `json:"authority"`
+}
+
+// Internal holds the details of a KindInternal entry: a transfer of value
+// made by a contract while executing the transaction, found in its call
+// trace.
+type Internal struct {
+	// Index is the position of the call in the transaction trace, depth
+	// first, the transaction itself being 0.
+	Index int `json:"index"`
+
+	// Type is the type of the call: CALL, CREATE, CREATE2 or SELFDESTRUCT.
+	Type  string `json:"type"`
+	Depth int    `json:"depth"`
+}
+
+// Receipt holds the execution outcome of a transaction.
+type Receipt struct {
+	Status            Uint64 `json:"status"`
+	GasUsed           *Big   `json:"gasUsed"`
+	EffectiveGasPrice *Big   `json:"effectiveGasPrice"`
+	BlobGasUsed       *Big   `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      *Big   `json:"blobGasPrice,omitempty"`
+}
+
+// AccessTuple is an EIP-2930 access list entry.
+type AccessTuple struct {
+	Address     Address `json:"address"`
+	StorageKeys []Hash  `json:"storageKeys"`
+}
+
+// Withdrawal holds the beacon chain details of a KindWithdrawal entry. The
+// credited amount in wei is carried by Transaction.Value.
+type Withdrawal struct {
+	Index          Uint64 `json:"index"`
+	ValidatorIndex Uint64 `json:"validatorIndex"`
+	AmountGwei     Uint64 `json:"amountGwei"`
+}
+
+// ID returns the identity of the entry within an address history, made
+// of its hash, kind and log index. Entries stored before kinds existed are
+// plain transactions. Withdrawals have no hash and are identified by their
+// withdrawal index instead, authorizations by their position in the
+// authorization list and internal transfers by their position in the
+// call trace.
+func (t Transaction) ID() string {
+	kind := t.Kind
+	if kind == "" {
+		kind = KindTransaction
+	}
+	if kind == KindWithdrawal && t.Withdrawal != nil {
+		return fmt.Sprintf("%s:%d", kind, t.Withdrawal.Index)
+	}
+	if kind == KindAuthorization && t.Authorization != nil {
+		return fmt.Sprintf("%s:%s:%d", t.Hash, kind, t.Authorization.Index)
+	}
+	if kind == KindInternal && t.Internal != nil {
+		return fmt.Sprintf("%s:%s:%d", t.Hash, kind, t.Internal.Index)
+	}
+	return fmt.Sprintf("%s:%s:%d", t.Hash, kind, t.LogIndex)
+}
+
+// Time returns the timestamp of the block the transaction was mined in.
+func (t Transaction) Time() time.Time {
+	return time.Unix(int64(t.Timestamp), 0).UTC()
+}
+
+// Position is the place of an entry in the chain, by which histories are
+// ordered: block, transaction index and log index, the entry ID breaking
+// the remaining ties.
+type Position struct {
+	Block    uint64
+	TxIndex  uint64
+	LogIndex uint64
+	ID       string
+}
+
+// Position returns the position of the entry in the chain. Withdrawals
+// are processed after the transactions of their block, by index, and
+// internal transfers after their transaction, in trace order.
+func (t Transaction) Position() Position {
+	p := Position{Block: uint64(t.BlockNumber), TxIndex: uint64(t.TransactionIndex), LogIndex: uint64(t.LogIndex), ID: t.ID()}
+	if t.Kind == KindInternal && t.Internal != nil {
+		p.LogIndex = uint64(t.Internal.Index)
+	}
+	if t.Kind == KindWithdrawal {
+		p.TxIndex = math.MaxUint64
+		if t.Withdrawal != nil {
+			p.LogIndex = uint64(t.Withdrawal.Index)
+		}
+	}
+	return p
+}
+
+// Less reports whether p comes before q.
+func (p Position) Less(q Position) bool {
+	if p.Block != q.Block {
+		return p.Block < q.Block
+	}
+	if p.TxIndex != q.TxIndex {
+		return p.TxIndex < q.TxIndex
+	}
+	if p.LogIndex != q.LogIndex {
+		return p.LogIndex < q.LogIndex
+	}
+	return p.ID < q.ID
+}
+
+// Cursor encodes the position as an opaque pagination cursor.
+func (p Position) Cursor() string {
+	s := fmt.Sprintf("%d:%d:%d:%s", p.Block, p.TxIndex, p.LogIndex, p.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// ParseCursor decodes a pagination cursor.
+func ParseCursor(cursor string) (Position, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Position{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	parts := strings.SplitN(string(raw), ":", 4)
+	if len(parts) != 4 {
+		return Position{}, ErrInvalidCursor
+	}
+	var p Position
+	for i, dst := range []*uint64{&p.Block, &p.TxIndex, &p.LogIndex} {
+		if *dst, err = strconv.ParseUint(parts[i], 10, 64); err != nil {
+			return Position{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+	}
+	p.ID = parts[3]
+	return p, nil
+}
+
+// Call is the decoded calldata of a transaction.
+type Call struct {
+	Selector  string    `json:"selector"`
+	Method    string    `json:"method"`
+	Signature string    `json:"signature"`
+	Args      []CallArg `json:"args"`
+}
+
+// CallArg is a decoded call argument. Value holds a string for numbers,
+// addresses, bytes and strings, a bool, or a []interface{} for arrays
+// and tuples.
+type CallArg struct {
+	Name  string      `json:"name,omitempty"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// String renders the call as method(name=value, ...).
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		if a.Name != "" {
+			args[i] = fmt.Sprintf("%s=%v", a.Name, a.Value)
+			continue
+		}
+		args[i] = fmt.Sprintf("%v", a.Value)
+	}
+	return c.Method + "(" + strings.Join(args, ", ") + ")"
 }
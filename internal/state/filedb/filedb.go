@@ -0,0 +1,239 @@
+// Package filedb implements the key-value db over a file shared by several
+// processes.
+package filedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Settings of the lock taken around every operation.
+const (
+	// LockTimeout bounds the time spent waiting for the lock.
+	LockTimeout = 5 * time.Second
+
+	// StaleLockAge is the age after which a lock file is considered left
+	// behind by a process which stopped while holding it, on systems
+	// without flock. Elsewhere the lock is released with the process.
+	StaleLockAge = 10 * time.Second
+
+	lockRetryDelay = 10 * time.Millisecond
+)
+
+var (
+	// ErrFileDBNotFound is returned if a key is requested that is not found
+	// in the file.
+	ErrFileDBNotFound = errors.New("not found")
+
+	// ErrFileDBLocked is returned when the lock of the file can't be taken
+	// within LockTimeout.
+	ErrFileDBLocked = errors.New("file locked")
+)
+
+// Database is a key-value store kept in a single JSON file. Every
+// operation reads the file, and rewrites it if needed, while holding the
+// lock of a file next to it, so processes sharing the file see each other's writes
+// and CompareAndSwap is atomic between them. As every operation reads the
+// whole file, it suits small stores, such as the lease of the leader of
+// several processes, and the state of copies of the parser on one machine
+// watching a limited number of addresses.
+type Database struct {
+	path string
+}
+
+// New returns a store kept in the file at path, created on the first
+// write.
+func New(path string) *Database {
+	return &Database{path: path}
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key string) (bool, error) {
+	var ok bool
+	err := db.view(func(data map[string][][]byte) {
+		_, ok = data[key]
+	})
+	return ok, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key string) ([][]byte, error) {
+	var (
+		result [][]byte
+		ok     bool
+	)
+	err := db.view(func(data map[string][][]byte) {
+		result, ok = data[key]
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrFileDBNotFound
+	}
+	if result == nil {
+		result = [][]byte{}
+	}
+	return result, nil
+}
+
+// Len returns the number of values of the key, 0 if it's not present.
+func (db *Database) Len(key string) (int, error) {
+	var n int
+	err := db.view(func(data map[string][][]byte) {
+		n = len(data[key])
+	})
+	return n, err
+}
+
+// GetRange retrieves the values of the key from index start up to index
+// end, excluded.
+func (db *Database) GetRange(key string, start, end int) ([][]byte, error) {
+	entry, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(entry) {
+		end = len(entry)
+	}
+	if start >= end {
+		return [][]byte{}, nil
+	}
+	return entry[start:end], nil
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key string, value [][]byte) error {
+	return db.edit(func(data map[string][][]byte) bool {
+		data[key] = append(data[key], value...)
+		return true
+	})
+}
+
+// List retrieves all the keys present in the key-value store.
+func (db *Database) List() ([]string, error) {
+	var result []string
+	err := db.view(func(data map[string][][]byte) {
+		for k := range data {
+			result = append(result, k)
+		}
+	})
+	return result, err
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key string) error {
+	return db.edit(func(data map[string][][]byte) bool {
+		if _, ok := data[key]; !ok {
+			return false
+		}
+		delete(data, key)
+		return true
+	})
+}
+
+// CompareAndSwap replaces the values of the key with the given value if its
+// last value equals old, or if the key is absent and old is nil.
+func (db *Database) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	var swapped bool
+	err := db.edit(func(data map[string][][]byte) bool {
+		entry, ok := data[key]
+		switch {
+		case old == nil && ok:
+			return false
+		case old != nil && (!ok || len(entry) == 0 || !bytes.Equal(entry[len(entry)-1], old)):
+			return false
+		}
+		data[key] = [][]byte{value}
+		swapped = true
+		return true
+	})
+	return swapped, err
+}
+
+// CompareAndReplace replaces the values of the key from index start on with
+// the given values if they equal old, an absent key holding no values.
+func (db *Database) CompareAndReplace(key string, start int, old, values [][]byte) (bool, error) {
+	var replaced bool
+	err := db.edit(func(data map[string][][]byte) bool {
+		entry, ok := data[key]
+		if start < 0 || start > len(entry) || len(entry)-start != len(old) {
+			return false
+		}
+		for i, v := range old {
+			if !bytes.Equal(entry[start+i], v) {
+				return false
+			}
+		}
+		replaced = true
+		if !ok && len(values) == 0 {
+			return false
+		}
+		data[key] = append(entry[:start], values...)
+		return true
+	})
+	return replaced, err
+}
+
+// view calls fn with the contents of the file.
+func (db *Database) view(fn func(data map[string][][]byte)) error {
+	return db.edit(func(data map[string][][]byte) bool {
+		fn(data)
+		return false
+	})
+}
+
+// edit calls fn with the contents of the file under the lock, and writes
+// them back if fn reports a change. The file is replaced by renaming a
+// complete copy over it, so it is never read half written.
+func (db *Database) edit(fn func(data map[string][][]byte) bool) error {
+	unlock, err := db.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data := make(map[string][][]byte)
+	content, err := os.ReadFile(db.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("error reading %s: %w", db.path, err)
+	default:
+		if err := json.Unmarshal(content, &data); err != nil {
+			return fmt.Errorf("error decoding %s: %w", db.path, err)
+		}
+	}
+
+	if !fn(data) {
+		return nil
+	}
+	content, err = json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", db.path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", db.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", db.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", db.path, err)
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return fmt.Errorf("error writing %s: %w", db.path, err)
+	}
+	return nil
+}
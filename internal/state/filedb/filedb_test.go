@@ -0,0 +1,103 @@
+package filedb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state/filedb"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+func TestFileDB(t *testing.T) {
+	t.Run("SharedFile", func(t *testing.T) {
+		testID := 0
+		path := filepath.Join(t.TempDir(), "store.json")
+		a, b := filedb.New(path), filedb.New(path)
+
+		if _, err := a.Get("ha:leader"); !errors.Is(err, filedb.ErrFileDBNotFound) {
+			t.Fatalf("\t%s\tTest %d:\tShould report missing keys : Got %v", Failed, testID, err)
+		}
+		if err := a.Put("ha:leader", [][]byte{[]byte("v1")}); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould write to the file : %v", Failed, testID, err)
+		}
+		if got, err := b.Get("ha:leader"); err != nil || len(got) != 1 || string(got[0]) != "v1" {
+			t.Fatalf("\t%s\tTest %d:\tShould read the writes of other processes : Got %q, %v", Failed, testID, got, err)
+		}
+		if ok, _ := b.CompareAndSwap("ha:leader", []byte("v0"), []byte("v2")); ok {
+			t.Fatalf("\t%s\tTest %d:\tShould not swap a value which changed", Failed, testID)
+		}
+		if ok, err := b.CompareAndSwap("ha:leader", []byte("v1"), []byte("v2")); err != nil || !ok {
+			t.Fatalf("\t%s\tTest %d:\tShould swap the expected value : %t, %v", Failed, testID, ok, err)
+		}
+		if err := a.Delete("ha:leader"); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould delete the key : %v", Failed, testID, err)
+		}
+		if exist, _ := b.Has("ha:leader"); exist {
+			t.Fatalf("\t%s\tTest %d:\tShould see the deletes of other processes", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould share the store between processes", Success, testID)
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		testID := 1
+		path := filepath.Join(t.TempDir(), "store.json")
+
+		var (
+			wg      sync.WaitGroup
+			lock    sync.Mutex
+			winners int
+		)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := filedb.New(path).CompareAndSwap("ha:leader", nil, []byte("holder"))
+				if err != nil {
+					t.Errorf("\t%s\tTest %d:\tShould take the lock : %v", Failed, testID, err)
+				}
+				if ok {
+					lock.Lock()
+					winners++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if winners != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould let a single writer create the key : Got %d", Failed, testID, winners)
+		}
+		t.Logf("\t%s\tTest %d:\tShould compare and swap atomically", Success, testID)
+	})
+
+	t.Run("LeftLock", func(t *testing.T) {
+		testID := 2
+		path := filepath.Join(t.TempDir(), "store.json")
+
+		// A process stopped while holding the lock.
+		if err := os.WriteFile(path+".lock", []byte("stopped"), 0o644); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould write the lock file : %v", Failed, testID, err)
+		}
+		left := time.Now().Add(-2 * filedb.StaleLockAge)
+		if err := os.Chtimes(path+".lock", left, left); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould age the lock file : %v", Failed, testID, err)
+		}
+
+		db := filedb.New(path)
+		if ok, err := db.CompareAndSwap("ha:leader", nil, []byte("holder")); err != nil || !ok {
+			t.Fatalf("\t%s\tTest %d:\tShould take over the lock of a stopped process : %t, %v", Failed, testID, ok, err)
+		}
+		if got, err := db.Get("ha:leader"); err != nil || string(got[0]) != "holder" {
+			t.Fatalf("\t%s\tTest %d:\tShould keep writing once the lock is taken over : Got %q, %v", Failed, testID, got, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould not be blocked by the lock of a stopped process", Success, testID)
+	})
+}
@@ -0,0 +1,76 @@
+//go:build !unix
+
+package filedb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lock creates the lock file of the store with a token of its own, waiting
+// for the process holding it to remove it. A lock older than StaleLockAge
+// is taken over. The lock is only ever removed after checking that it
+// still holds the token it was read with, so a waiter never removes a lock
+// just taken by another process. It returns the function removing it.
+func (db *Database) lock() (func(), error) {
+	path := db.path + ".lock"
+	token, err := lockToken()
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", db.path, err)
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, werr := f.Write(token)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				removeLock(path, token)
+				return nil, fmt.Errorf("error locking %s: %w", db.path, werr)
+			}
+			return func() { removeLock(path, token) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error locking %s: %w", db.path, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > StaleLockAge {
+			if holder, err := os.ReadFile(path); err == nil {
+				removeLock(path, holder)
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrFileDBLocked, path)
+		}
+		time.Sleep(lockRetryDelay)
+	}
+}
+
+// removeLock removes the lock file if it holds the given token. The file is
+// first moved aside, which is atomic, and put back if it turns out to hold
+// the token of another process.
+func removeLock(path string, token []byte) {
+	aside := fmt.Sprintf("%s.%x", path, token)
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	defer os.Remove(aside)
+	if holder, err := os.ReadFile(aside); err != nil || !bytes.Equal(holder, token) {
+		os.Link(aside, path)
+	}
+}
+
+func lockToken() ([]byte, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(b)), nil
+}
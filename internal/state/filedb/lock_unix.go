@@ -0,0 +1,42 @@
+//go:build unix
+
+package filedb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lock takes an exclusive flock on the lock file of the store, waiting for
+// the process holding it to release it. The lock is held by the kernel, so
+// it is released when the process stops and the file is never removed. It
+// returns the function releasing it.
+func (db *Database) lock() (func(), error) {
+	path := db.path + ".lock"
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", db.path, err)
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			f.Close()
+			return nil, fmt.Errorf("error locking %s: %w", db.path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrFileDBLocked, path)
+		}
+		time.Sleep(lockRetryDelay)
+	}
+}
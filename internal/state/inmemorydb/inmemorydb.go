@@ -2,6 +2,7 @@
 package inmemorydb
 
 import (
+	"bytes"
 	"errors"
 	"sync"
 )
@@ -54,6 +55,44 @@ func (db *Database) Get(key string) ([][]byte, error) {
 	return nil, ErrInMemoryDBNotFound
 }
 
+// Len returns the number of values of the key, 0 if it's not present.
+func (db *Database) Len(key string) (int, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return 0, ErrInMemoryDBNotFound
+	}
+	return len(db.db[key]), nil
+}
+
+// GetRange retrieves the values of the key from index start up to index
+// end, excluded.
+func (db *Database) GetRange(key string, start, end int) ([][]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.db == nil {
+		return nil, ErrInMemoryDBNotFound
+	}
+	entry, ok := db.db[key]
+	if !ok {
+		return nil, ErrInMemoryDBNotFound
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(entry) {
+		end = len(entry)
+	}
+	if start >= end {
+		return [][]byte{}, nil
+	}
+	result := make([][]byte, end-start)
+	copy(result, entry[start:end])
+	return result, nil
+}
+
 // Put inserts the given value into the key-value store.
 func (db *Database) Put(key string, value [][]byte) error {
 	db.lock.Lock()
@@ -94,6 +133,62 @@ func (db *Database) Delete(key string) error {
 	return nil
 }
 
+// CompareAndSwap replaces the values of the key with the given value if its
+// last value equals old, or if the key is absent and old is nil.
+func (db *Database) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return false, ErrInMemoryDBNotFound
+	}
+
+	entry, ok := db.db[key]
+	switch {
+	case old == nil && ok:
+		return false, nil
+	case old != nil && (!ok || len(entry) == 0 || !bytes.Equal(entry[len(entry)-1], old)):
+		return false, nil
+	}
+	db.db[key] = [][]byte{value}
+	return true, nil
+}
+
+// CompareAndReplace replaces the values of the key from index start on with
+// the given values if they equal old, an absent key holding no values.
+func (db *Database) CompareAndReplace(key string, start int, old, values [][]byte) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.db == nil {
+		return false, ErrInMemoryDBNotFound
+	}
+
+	entry, ok := db.db[key]
+	if !equalFrom(entry, start, old) {
+		return false, nil
+	}
+	if !ok && len(values) == 0 {
+		return true, nil
+	}
+	db.db[key] = append(entry[:start], values...)
+	return true, nil
+}
+
+// equalFrom reports whether the values of entry from index start on equal
+// old.
+func equalFrom(entry [][]byte, start int, old [][]byte) bool {
+	if start < 0 || start > len(entry) || len(entry)-start != len(old) {
+		return false
+	}
+	for i, v := range old {
+		if !bytes.Equal(entry[start+i], v) {
+			return false
+		}
+	}
+	return true
+}
+
 // Close deallocates the internal map and ensures any consecutive data access op
 // fails with an error.
 func (db *Database) Close() {
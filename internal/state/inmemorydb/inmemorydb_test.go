@@ -2,6 +2,7 @@ package inmemorydb_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/danielmbirochi/trustwallet-assignment/internal/state/inmemorydb"
@@ -87,5 +88,94 @@ func TestInMemoryDB(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete an entry in the key-value store", Success, testID)
 		}
+
+		{
+			testID := 5
+			if ok, err := db.CompareAndSwap(key, nil, []byte("v1")); err != nil || !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an absent key : %t, %v", Failed, testID, ok, err)
+			}
+			if ok, _ := db.CompareAndSwap(key, nil, []byte("v2")); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould not create a key already present", Failed, testID)
+			}
+			if ok, _ := db.CompareAndSwap(key, []byte("v0"), []byte("v2")); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould not swap a value which changed", Failed, testID)
+			}
+			if ok, _ := db.CompareAndSwap(key, []byte("v1"), []byte("v2")); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould swap the expected value", Failed, testID)
+			}
+			if got, _ := db.Get(key); len(got) != 1 || string(got[0]) != "v2" {
+				t.Fatalf("\t%s\tTest %d:\tShould store the swapped value : Got %q", Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to compare and swap an entry", Success, testID)
+		}
+
+		{
+			testID := 6
+			missing := "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"
+			if n, err := db.Len(missing); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould report no values for a missing key : Got %d, %v", Failed, testID, n, err)
+			}
+			if err := db.Put(missing, [][]byte{[]byte("v0"), []byte("v1"), []byte("v2")}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write an entry in the key-value store : %s", Failed, testID, err)
+			}
+			if n, err := db.Len(missing); err != nil || n != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the values of the key : Got %d, %v", Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to count the values of an entry", Success, testID)
+		}
+
+		{
+			testID := 7
+			key := "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"
+			tt := []struct {
+				name       string
+				start, end int
+				expected   []string
+			}{
+				{"inner range", 1, 2, []string{"v1"}},
+				{"whole range", 0, 3, []string{"v0", "v1", "v2"}},
+				{"negative start", -5, 2, []string{"v0", "v1"}},
+				{"end past the last value", 2, 10, []string{"v2"}},
+				{"start past the last value", 5, 10, nil},
+				{"empty range", 2, 1, nil},
+			}
+			for _, tc := range tt {
+				got, err := db.GetRange(key, tc.start, tc.end)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould read the %s : %s", Failed, testID, tc.name, err)
+				}
+				if len(got) != len(tc.expected) {
+					t.Fatalf("\t%s\tTest %d:\tShould read the %s : Expected %q. Got %q", Failed, testID, tc.name, tc.expected, got)
+				}
+				for i := range got {
+					if string(got[i]) != tc.expected[i] {
+						t.Fatalf("\t%s\tTest %d:\tShould read the %s : Expected %q. Got %q", Failed, testID, tc.name, tc.expected, got)
+					}
+				}
+			}
+			if _, err := db.GetRange("0xdac17f958d2ee523a2206206994597c13d831ec7", 0, 1); !errors.Is(err, inmemorydb.ErrInMemoryDBNotFound) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail to read a range of a missing key : Got %v", Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to read a range of the values of an entry", Success, testID)
+		}
+
+		{
+			testID := 8
+			key := "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"
+			old := [][]byte{[]byte("v2")}
+			if ok, _ := db.CompareAndReplace(key, 1, old, [][]byte{[]byte("v9")}); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould not replace values which changed", Failed, testID)
+			}
+			if ok, err := db.CompareAndReplace(key, 2, old, [][]byte{[]byte("v2"), []byte("v3")}); err != nil || !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould replace the expected values : %t, %v", Failed, testID, ok, err)
+			}
+			if got, _ := db.Get(key); len(got) != 4 || string(got[3]) != "v3" {
+				t.Fatalf("\t%s\tTest %d:\tShould store the replaced values : Got %q", Failed, testID, got)
+			}
+			if ok, _ := db.CompareAndReplace("0xdac17f958d2ee523a2206206994597c13d831ec7", 0, nil, [][]byte{[]byte("v0")}); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould create an absent key", Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to compare and replace the values of an entry", Success, testID)
+		}
 	})
 }
@@ -0,0 +1,78 @@
+package state
+
+import "strings"
+
+// Prefixed is a KeyValueStorer exposing the keys of an underlying store
+// that start with a prefix, with the prefix stripped. It is used to give
+// isolated namespaces to several users of the same store.
+type Prefixed struct {
+	kv     KeyValueStorer
+	prefix string
+}
+
+// NewPrefixed returns a view of kv restricted to the keys starting with
+// prefix.
+func NewPrefixed(kv KeyValueStorer, prefix string) *Prefixed {
+	return &Prefixed{
+		kv:     kv,
+		prefix: prefix,
+	}
+}
+
+// Has retrieves if a key is present in the namespace.
+func (p *Prefixed) Has(key string) (bool, error) {
+	return p.kv.Has(p.prefix + key)
+}
+
+// Get retrieves the given key if it's present in the namespace.
+func (p *Prefixed) Get(key string) ([][]byte, error) {
+	return p.kv.Get(p.prefix + key)
+}
+
+// Len returns the number of values of the given key of the namespace.
+func (p *Prefixed) Len(key string) (int, error) {
+	return p.kv.Len(p.prefix + key)
+}
+
+// GetRange retrieves a range of the values of the given key of the
+// namespace.
+func (p *Prefixed) GetRange(key string, start, end int) ([][]byte, error) {
+	return p.kv.GetRange(p.prefix+key, start, end)
+}
+
+// Put inserts the given value into the namespace.
+func (p *Prefixed) Put(key string, value [][]byte) error {
+	return p.kv.Put(p.prefix+key, value)
+}
+
+// List retrieves all the keys present in the namespace, without prefix.
+func (p *Prefixed) List() ([]string, error) {
+	keys, err := p.kv.List()
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, p.prefix) {
+			result = append(result, strings.TrimPrefix(k, p.prefix))
+		}
+	}
+	return result, nil
+}
+
+// CompareAndSwap atomically replaces the value of the given key of the
+// namespace if it equals old.
+func (p *Prefixed) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	return p.kv.CompareAndSwap(p.prefix+key, old, value)
+}
+
+// CompareAndReplace atomically replaces the values of the given key of the
+// namespace from index start on if they equal old.
+func (p *Prefixed) CompareAndReplace(key string, start int, old, values [][]byte) (bool, error) {
+	return p.kv.CompareAndReplace(p.prefix+key, start, old, values)
+}
+
+// Delete removes the given key from the namespace.
+func (p *Prefixed) Delete(key string) error {
+	return p.kv.Delete(p.prefix + key)
+}
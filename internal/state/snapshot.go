@@ -0,0 +1,211 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"time"
+)
+
+// SnapshotFormat identifies snapshot files.
+const SnapshotFormat = "txparser-snapshot"
+
+// SnapshotVersion is the version of the snapshot files written by Export.
+const SnapshotVersion = 1
+
+var (
+	// ErrSnapshotFormat is returned when importing a file which is not a
+	// snapshot, or a snapshot of an unsupported version.
+	ErrSnapshotFormat = errors.New("invalid snapshot format")
+
+	// ErrSnapshotChecksum is returned when importing a truncated or
+	// corrupted snapshot.
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+// SnapshotHeader is the first line of a snapshot file.
+type SnapshotHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SnapshotTrailer is the last line of a snapshot file. Checksum is the hex
+// encoded SHA-256 of every line before it.
+type SnapshotTrailer struct {
+	Entries  int    `json:"entries"`
+	Checksum string `json:"checksum"`
+}
+
+// snapshotLine is a line of a snapshot file: the header, one key with its
+// values, or the trailer. Snapshots are written one key per line so they
+// can be written and read without holding the store in memory.
+type snapshotLine struct {
+	Header  *SnapshotHeader  `json:"header,omitempty"`
+	Key     string           `json:"key,omitempty"`
+	Values  [][]byte         `json:"values,omitempty"`
+	Trailer *SnapshotTrailer `json:"trailer,omitempty"`
+}
+
+// Export writes every key of kv with its values to w as a snapshot, except
+// the keys for which skip, if not nil, returns true. It returns the number
+// of keys written.
+func Export(w io.Writer, kv KeyValueStorer, skip func(key string) bool) (int, error) {
+	keys, err := listKeys(kv, skip)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	sum := sha256.New()
+	write := func(line snapshotLine, h hash.Hash) error {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return fmt.Errorf("error marshaling snapshot line: %w", err)
+		}
+		data = append(data, '\n')
+		if h != nil {
+			h.Write(data)
+		}
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("error writing snapshot: %w", err)
+		}
+		return nil
+	}
+
+	header := SnapshotHeader{Format: SnapshotFormat, Version: SnapshotVersion, CreatedAt: time.Now().UTC()}
+	if err := write(snapshotLine{Header: &header}, sum); err != nil {
+		return 0, err
+	}
+
+	entries := 0
+	for _, key := range keys {
+		values, err := kv.Get(key)
+		if err != nil {
+			// The key was deleted since it was listed.
+			continue
+		}
+		if err := write(snapshotLine{Key: key, Values: values}, sum); err != nil {
+			return entries, err
+		}
+		entries++
+	}
+
+	trailer := SnapshotTrailer{Entries: entries, Checksum: hex.EncodeToString(sum.Sum(nil))}
+	if err := write(snapshotLine{Trailer: &trailer}, nil); err != nil {
+		return entries, err
+	}
+	if err := bw.Flush(); err != nil {
+		return entries, fmt.Errorf("error writing snapshot: %w", err)
+	}
+	return entries, nil
+}
+
+// Import restores the snapshot read from r into kv: every key of kv is
+// deleted, then the keys of the snapshot are written. The keys for which
+// skip, if not nil, returns true are neither deleted nor restored. The
+// snapshot is verified before anything is written, so a corrupted file
+// leaves kv unchanged. It returns the number of keys restored.
+func Import(r io.ReadSeeker, kv KeyValueStorer, skip func(key string) bool) (int, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("error reading snapshot: %w", err)
+	}
+	if _, err := readSnapshot(r, nil); err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	keys, err := listKeys(kv, skip)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := kv.Delete(key); err != nil {
+			if exist, _ := kv.Has(key); exist {
+				return 0, fmt.Errorf("error clearing %s: %w", key, err)
+			}
+		}
+	}
+
+	return readSnapshot(r, func(key string, values [][]byte) error {
+		if skip != nil && skip(key) {
+			return nil
+		}
+		if err := kv.Put(key, values); err != nil {
+			return fmt.Errorf("error restoring %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// listKeys returns the sorted keys of kv, except those for which skip, if
+// not nil, returns true.
+func listKeys(kv KeyValueStorer, skip func(key string) bool) ([]string, error) {
+	all, err := kv.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing keys: %w", err)
+	}
+	keys := all[:0]
+	for _, key := range all {
+		if skip == nil || !skip(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// readSnapshot reads the snapshot from r, calling fn with every key, and
+// checks its header and checksum. It returns the number of keys read.
+func readSnapshot(r io.Reader, fn func(key string, values [][]byte) error) (int, error) {
+	br := bufio.NewReader(r)
+	sum := sha256.New()
+	entries := 0
+	for i := 0; ; i++ {
+		data, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, fmt.Errorf("%w: missing trailer", ErrSnapshotChecksum)
+		}
+		if err != nil {
+			return entries, fmt.Errorf("error reading snapshot: %w", err)
+		}
+
+		var line snapshotLine
+		if err := json.Unmarshal(bytes.TrimSpace(data), &line); err != nil {
+			return entries, fmt.Errorf("%w: line %d: %v", ErrSnapshotFormat, i+1, err)
+		}
+
+		switch {
+		case i == 0:
+			if line.Header == nil || line.Header.Format != SnapshotFormat {
+				return 0, fmt.Errorf("%w: missing header", ErrSnapshotFormat)
+			}
+			if line.Header.Version != SnapshotVersion {
+				return 0, fmt.Errorf("%w: unsupported version %d", ErrSnapshotFormat, line.Header.Version)
+			}
+		case line.Trailer != nil:
+			if line.Trailer.Entries != entries || line.Trailer.Checksum != hex.EncodeToString(sum.Sum(nil)) {
+				return entries, ErrSnapshotChecksum
+			}
+			return entries, nil
+		default:
+			if fn != nil {
+				if err := fn(line.Key, line.Values); err != nil {
+					return entries, err
+				}
+			}
+			entries++
+		}
+		sum.Write(data)
+	}
+}
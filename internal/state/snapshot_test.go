@@ -0,0 +1,80 @@
+package state_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state/inmemorydb"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		testID := 0
+		src := inmemorydb.New()
+		src.Put("0x388c818ca8b9251b393131c08a736a67ccb19297", [][]byte{[]byte(`{"hash":"0x01"}`), []byte(`{"hash":"0x02"}`)})
+		src.Put("sub:0x388c818ca8b9251b393131c08a736a67ccb19297", [][]byte{[]byte(`{}`)})
+		src.Put("seen:0x388c818ca8b9251b393131c08a736a67ccb19297:0x01", nil)
+		src.Put("lease:worker", [][]byte{[]byte(`src`)})
+		lease := func(key string) bool { return strings.HasPrefix(key, "lease:") }
+
+		var buf bytes.Buffer
+		if n, err := state.Export(&buf, src, lease); err != nil || n != 3 {
+			t.Fatalf("\t%s\tTest %d:\tShould export every key : Got %d, %v", Failed, testID, n, err)
+		}
+
+		dst := inmemorydb.New()
+		dst.Put("sub:0x388c818ca8b9251b393131c08a736a67ccb19297", [][]byte{[]byte(`stale`)})
+		dst.Put("sub:0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5", [][]byte{[]byte(`{}`)})
+		dst.Put("lease:worker", [][]byte{[]byte(`dst`)})
+		if n, err := state.Import(bytes.NewReader(buf.Bytes()), dst, lease); err != nil || n != 3 {
+			t.Fatalf("\t%s\tTest %d:\tShould import every key : Got %d, %v", Failed, testID, n, err)
+		}
+		history, _ := dst.Get("0x388c818ca8b9251b393131c08a736a67ccb19297")
+		sub, _ := dst.Get("sub:0x388c818ca8b9251b393131c08a736a67ccb19297")
+		seen, _ := dst.Has("seen:0x388c818ca8b9251b393131c08a736a67ccb19297:0x01")
+		if len(history) != 2 || string(history[1]) != `{"hash":"0x02"}` || len(sub) != 1 || string(sub[0]) != `{}` || !seen {
+			t.Fatalf("\t%s\tTest %d:\tShould restore the values of every key : Got %q, %q, %t", Failed, testID, history, sub, seen)
+		}
+		if exist, _ := dst.Has("sub:0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"); exist {
+			t.Fatalf("\t%s\tTest %d:\tShould delete the keys absent from the snapshot", Failed, testID)
+		}
+		if values, _ := dst.Get("lease:worker"); len(values) != 1 || string(values[0]) != `dst` {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the skipped keys : Got %q", Failed, testID, values)
+		}
+		t.Logf("\t%s\tTest %d:\tShould export and import the store contents", Success, testID)
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		testID := 1
+		src := inmemorydb.New()
+		src.Put("0x388c818ca8b9251b393131c08a736a67ccb19297", [][]byte{[]byte(`{"hash":"0x01"}`)})
+		var buf bytes.Buffer
+		state.Export(&buf, src, nil)
+
+		tampered := bytes.Replace(buf.Bytes(), []byte("key"), []byte("kez"), 1)
+		dst := inmemorydb.New()
+		if _, err := state.Import(bytes.NewReader(tampered), dst, nil); !errors.Is(err, state.ErrSnapshotChecksum) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject a tampered snapshot : Got %v", Failed, testID, err)
+		}
+		truncated := buf.Bytes()[:bytes.LastIndexByte(buf.Bytes()[:buf.Len()-1], '\n')+1]
+		if _, err := state.Import(bytes.NewReader(truncated), dst, nil); !errors.Is(err, state.ErrSnapshotChecksum) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject a truncated snapshot : Got %v", Failed, testID, err)
+		}
+		if _, err := state.Import(bytes.NewReader([]byte("{}\n")), dst, nil); !errors.Is(err, state.ErrSnapshotFormat) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject files which are not snapshots : Got %v", Failed, testID, err)
+		}
+		if keys, _ := dst.List(); len(keys) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould leave the store unchanged on failure : Got %v", Failed, testID, keys)
+		}
+		t.Logf("\t%s\tTest %d:\tShould verify the snapshot before importing it", Success, testID)
+	})
+}
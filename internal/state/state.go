@@ -17,6 +17,16 @@ type KeyValueStorer interface {
 	// slice - [][]byte{item}. It will return an error if datastore is not initialized.
 	Put(key string, value [][]byte) error
 
+	// Len returns the number of values of the given key, 0 if it's not
+	// present. It will return an error if datastore is not initialized.
+	Len(key string) (int, error)
+
+	// GetRange retrieves the values of the given key from index start up
+	// to index end, excluded, without reading the others. Indexes past the
+	// last value are ignored. It will return an error if datastore is not
+	// initialized or the key is not found.
+	GetRange(key string, start, end int) ([][]byte, error)
+
 	// List retrieves all the keys present in the key-value store. It will
 	// return an error if datastore is not initialized.
 	List() ([]string, error)
@@ -24,4 +34,16 @@ type KeyValueStorer interface {
 	// Delete removes the given key from the key-value store. It will return
 	// an error if datastore is not initialized.
 	Delete(key string) error
+
+	// CompareAndSwap atomically replaces the values of the key with the
+	// single given value if its last value equals old. A nil old value
+	// expects the key to be absent. It reports whether the values were
+	// replaced, and will return an error if datastore is not initialized.
+	CompareAndSwap(key string, old, value []byte) (bool, error)
+
+	// CompareAndReplace atomically replaces the values of the key from
+	// index start on with the given values if they equal old, an absent
+	// key holding no values. It reports whether the values were replaced,
+	// and will return an error if datastore is not initialized.
+	CompareAndReplace(key string, start int, old, values [][]byte) (bool, error)
 }
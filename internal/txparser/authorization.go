@@ -0,0 +1,183 @@
+package txparser
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/keccak"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/rlp"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/secp256k1"
+)
+
+// setCodeMagic prefixes the payload signed by EIP-7702 authorities.
+const setCodeMagic = 0x05
+
+// parseAuthorizations converts the EIP-7702 authorizations carried by the
+// block transactions into entries of kind authorization, going from the
+// authority to the delegate address. Authorizations ignored by the
+// protocol are skipped: those for another chain, with a nonce out of range
+// or whose signer can't be recovered. Those whose nonce doesn't match the
+// authority's are dropped once matched, see dropSkippedAuthorizations.
+func parseAuthorizations(block ethclient.Block) ([]svc.Transaction, error) {
+	h, err := parseBlockHeader(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		d       decoder
+		entries []svc.Transaction
+	)
+	for _, tx := range block.Transactions {
+		chainID := d.optionalBig("chain ID", tx.ChainID)
+		for i, auth := range tx.AuthorizationList {
+			authChainID := d.big("chain ID", auth.ChainID)
+			if d.err != nil {
+				break
+			}
+			if authChainID.ToInt().Sign() != 0 && (chainID == nil || authChainID.ToInt().Cmp(chainID.ToInt()) != 0) {
+				fmt.Printf("skipping authorization %d of tx %s: chain ID %s\n", i, tx.Hash, authChainID)
+				continue
+			}
+			authority, err := RecoverAuthority(auth)
+			if err != nil {
+				fmt.Printf("skipping authorization %d of tx %s: %s\n", i, tx.Hash, err)
+				continue
+			}
+			nonce := d.big("nonce", auth.Nonce)
+			if d.err == nil && !nonce.ToInt().IsUint64() {
+				fmt.Printf("skipping authorization %d of tx %s: nonce %s\n", i, tx.Hash, nonce)
+				continue
+			}
+			delegate := d.address("delegate address", auth.Address)
+			entries = append(entries, svc.Transaction{
+				Kind:             svc.KindAuthorization,
+				BlockNumber:      h.number,
+				Hash:             d.hash("hash", tx.Hash),
+				From:             authority,
+				To:               &delegate,
+				Value:            svc.NewBig(new(big.Int)),
+				Timestamp:        h.timestamp,
+				Type:             d.uint64("type", tx.Type),
+				TransactionIndex: d.uint64("transaction index", tx.TransactionIndex),
+				Authorization: &svc.Authorization{
+					Index:     i,
+					ChainID:   authChainID,
+					Address:   delegate,
+					Nonce:     nonce,
+					Authority: authority,
+				},
+			})
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("error parsing authorizations of block %s: %w", block.Number, d.err)
+	}
+	return entries, nil
+}
+
+// dropSkippedAuthorizations removes from the matched entries of the block
+// the authorizations skipped by the protocol because their nonce is not the
+// one of the authority when they are applied. The nonce of the authority
+// before the block is queried once per block, then moved forward by its
+// transactions and applied authorizations, in block order.
+func (b *Blockscan) dropSkippedAuthorizations(blockNumber int, entries []svc.Transaction, matched map[string][]svc.Transaction, cache *receiptCache) error {
+	for address, txs := range matched {
+		var kept []svc.Transaction
+		for _, tx := range txs {
+			if tx.Kind != svc.KindAuthorization {
+				kept = append(kept, tx)
+				continue
+			}
+			applied, ok := cache.authorizations[tx.From]
+			if !ok {
+				nonce, err := b.clt.TransactionCount(tx.From.Canonical(), blockNumber-1)
+				if err != nil {
+					return fmt.Errorf("nonce of %s: %w", tx.From, err)
+				}
+				applied = appliedAuthorizations(tx.From, nonce, entries)
+				cache.authorizations[tx.From] = applied
+			}
+			if !applied[tx.ID()] {
+				fmt.Printf("skipping authorization %d of tx %s: nonce %s\n", tx.Authorization.Index, tx.Hash, tx.Authorization.Nonce)
+				continue
+			}
+			kept = append(kept, tx)
+		}
+		if len(kept) == 0 {
+			delete(matched, address)
+			continue
+		}
+		matched[address] = kept
+	}
+	return nil
+}
+
+// appliedAuthorizations returns the IDs of the authorizations of the
+// entries applied by the protocol for the authority, whose nonce is the
+// given one before the block. The nonce of the sender is incremented
+// before the authorization list of its transaction is processed.
+func appliedAuthorizations(authority svc.Address, nonce uint64, entries []svc.Transaction) map[string]bool {
+	var events []svc.Transaction
+	for _, tx := range entries {
+		if tx.From == authority && (tx.Kind == svc.KindTransaction || tx.Kind == svc.KindAuthorization) {
+			events = append(events, tx)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].TransactionIndex != events[j].TransactionIndex {
+			return events[i].TransactionIndex < events[j].TransactionIndex
+		}
+		return events[i].Kind == svc.KindTransaction && events[j].Kind != svc.KindTransaction
+	})
+
+	applied := make(map[string]bool)
+	for _, e := range events {
+		if e.Kind == svc.KindTransaction {
+			nonce++
+			continue
+		}
+		if e.Authorization.Nonce.ToInt().Uint64() == nonce {
+			applied[e.ID()] = true
+			nonce++
+		}
+	}
+	return applied
+}
+
+// RecoverAuthority returns the address of the account that signed the
+// authorization.
+func RecoverAuthority(auth ethclient.Authorization) (svc.Address, error) {
+	var d decoder
+	var (
+		delegate = d.address("delegate address", auth.Address)
+		chainID  = d.big("chain ID", auth.ChainID)
+		nonce    = d.big("nonce", auth.Nonce)
+		parity   = d.uint64("y parity", auth.YParity)
+		r        = d.big("r", auth.R)
+		s        = d.big("s", auth.S)
+	)
+	if d.err != nil {
+		return svc.Address{}, d.err
+	}
+	payload, err := rlp.Encode([]interface{}{chainID.ToInt(), delegate[:], nonce.ToInt()})
+	if err != nil {
+		return svc.Address{}, err
+	}
+	hash := keccak.Sum256([]byte{setCodeMagic}, payload)
+
+	if parity > 1 {
+		return svc.Address{}, secp256k1.ErrInvalidSignature
+	}
+	pub, err := secp256k1.Recover(hash[:], r.ToInt(), s.ToInt(), byte(parity))
+	if err != nil {
+		return svc.Address{}, err
+	}
+	var authority svc.Address
+	digest := keccak.Sum256(pub.Bytes())
+	copy(authority[:], digest[12:])
+	return authority, nil
+}
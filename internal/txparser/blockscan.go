@@ -5,15 +5,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
 	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/abi"
 	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
 )
 
+// MaxScanRetryDelay bounds the wait before the scanning is retried after
+// failed runs, such as on a block the node keeps returning malformed.
+const MaxScanRetryDelay = time.Minute
+
 type Scanner interface {
 	// Run starts the block scanning process. It will return the number
 	// of the last scanned block and an error if any. In case of no pending
@@ -25,63 +32,179 @@ type Scanner interface {
 }
 
 type Blockscan struct {
-	ctx              context.Context
-	kvstate          state.KeyValueStorer
-	clt              *ethclient.Client
+	ctx             context.Context
+	kvstate         state.KeyValueStorer
+	clt             *ethclient.Client
+	abis            *abi.Registry
+	reconcileEvery  int
+	nonceCheckEvery int
+	traceInternal   atomic.Bool
+	traceProbed     atomic.Bool
+	once            sync.Once
+
+	// scanLock is held while blocks are scanned and while a snapshot is
+	// imported, which replaces the store under the scanner.
+	scanLock sync.Mutex
+
+	// tenant is set on the scanners of tenants, which are driven by
+	// their parent: blocks are fetched once and indexed for every tenant.
+	tenant      *svc.Tenant
+	parent      *Blockscan
+	tenantsLock sync.Mutex
+	tenants     map[string]*Blockscan
+
+	// shard is set when the scanning is split with other workers.
+	shard *shard
+
+	// election is set when the scanning runs on the elected leader of
+	// several copies sharing the store. leases holds the leader lease,
+	// the store of the parser if nil.
+	election *election
+	leases   state.KeyValueStorer
+
+	// statusLock guards the progress of the scanning goroutine, read
+	// by Status.
+	statusLock       sync.Mutex
 	lastScannedBlock int
-	once             sync.Once
+	running          bool
+	lastRunAt        time.Time
+	lastErr          error
+}
+
+// Option configures a Blockscan.
+type Option func(*Blockscan)
+
+// WithABIRegistry sets the registry used to decode the calldata of
+// matched transactions. By default only the built-in signatures are known.
+func WithABIRegistry(reg *abi.Registry) Option {
+	return func(b *Blockscan) {
+		b.abis = reg
+	}
 }
 
 // ParseTx converts an ethclient.Transaction into a the domain
-// type service.Transaction.
-func ParseTx(tx ethclient.Transaction) svc.Transaction {
-	return svc.Transaction{
-		ChainID:     decodeHexString(tx.ChainID),
-		BlockNumber: decodeHexString(tx.BlockNumber),
-		Hash:        tx.Hash,
-		Nonce:       decodeHexString(tx.Nonce),
-		From:        tx.From,
-		To:          tx.To,
-		Value:       decodeHexString(tx.Value),
-		Gas:         decodeHexString(tx.Gas),
-		GasPrice:    decodeHexString(tx.GasPrice),
-		Input:       tx.Input,
-	}
-}
-
-func NewScan(ctx context.Context, kvstate state.KeyValueStorer, clt *ethclient.Client, startAt int) *Blockscan {
+// type service.Transaction. It fails on malformed hex fields.
+func ParseTx(tx ethclient.Transaction) (svc.Transaction, error) {
+	var d decoder
+	parsed := svc.Transaction{
+		Kind:                 svc.KindTransaction,
+		ChainID:              d.optionalBig("chain ID", tx.ChainID),
+		BlockNumber:          d.uint64("block number", tx.BlockNumber),
+		Hash:                 d.hash("hash", tx.Hash),
+		Nonce:                d.big("nonce", tx.Nonce),
+		From:                 d.address("sender", tx.From),
+		To:                   d.optionalAddress("recipient", tx.To),
+		Value:                d.big("value", tx.Value),
+		Gas:                  d.big("gas", tx.Gas),
+		GasPrice:             d.optionalBig("gas price", tx.GasPrice),
+		Input:                d.bytes("input", tx.Input),
+		Type:                 d.uint64("type", tx.Type),
+		TransactionIndex:     d.uint64("transaction index", tx.TransactionIndex),
+		MaxFeePerGas:         d.optionalBig("max fee per gas", tx.MaxFeePerGas),
+		MaxPriorityFeePerGas: d.optionalBig("max priority fee per gas", tx.MaxPriorityFeePerGas),
+		AccessList:           parseAccessList(&d, tx.AccessList),
+		MaxFeePerBlobGas:     d.optionalBig("max fee per blob gas", tx.MaxFeePerBlobGas),
+		BlobVersionedHashes:  d.hashes("blob versioned hash", tx.BlobVersionedHashes),
+	}
+	if d.err != nil {
+		return svc.Transaction{}, fmt.Errorf("error parsing transaction %s: %w", tx.Hash, d.err)
+	}
+	return parsed, nil
+}
+
+func parseAccessList(d *decoder, list []ethclient.AccessListEntry) []svc.AccessTuple {
+	if len(list) == 0 {
+		return nil
+	}
+	tuples := make([]svc.AccessTuple, len(list))
+	for i, e := range list {
+		tuples[i] = svc.AccessTuple{
+			Address:     d.address("access list address", e.Address),
+			StorageKeys: d.hashes("access list storage key", e.StorageKeys),
+		}
+	}
+	return tuples
+}
+
+func NewScan(ctx context.Context, kvstate state.KeyValueStorer, clt *ethclient.Client, startAt int, opts ...Option) *Blockscan {
 	fmt.Println("Blockscan set to start at block: ", startAt)
-	return &Blockscan{
+	b := &Blockscan{
 		ctx:              ctx,
 		kvstate:          kvstate,
 		clt:              clt,
+		reconcileEvery:   DefaultReconcileInterval,
+		nonceCheckEvery:  DefaultNonceCheckInterval,
 		lastScannedBlock: startAt,
 	}
+	b.traceInternal.Store(true)
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.abis == nil {
+		b.abis = abi.NewRegistry()
+	}
+	return b
 }
 
 // StartScan spawn a goroutine that will run the block scanning process
 // at the given interval. It will stop the process when a signal is received
 // on the shutdown channel. It will spawn only one goroutine for each Blockscan
-// instance.
+// instance. Tenant scanners start the scanning of their parent. With
+// leader election, blocks are only scanned while the process is the
+// leader, and standbys campaign at every interval. The deliveries queued
+// for the tenant targets are posted by a separate goroutine, so slow
+// targets never hold the scanning up. A run stops at the first block
+// which fails, recorded in Status, and the block is retried after a wait
+// doubled with every run failing in a row, up to MaxScanRetryDelay.
 func (b *Blockscan) StartScan(interval time.Duration) {
+	if b.parent != nil {
+		b.parent.StartScan(interval)
+		return
+	}
 	b.once.Do(func() {
+		b.setRunning(true)
+		go b.runDeliveries(DeliveryInterval)
 		go func() {
 			ticker := time.NewTicker(interval)
+			failures := 0
 			for {
 				select {
 				case <-b.ctx.Done():
 					ticker.Stop()
+					b.Resign()
+					b.setRunning(false)
 					fmt.Println("stopping blockscan")
 					return
 				case <-ticker.C:
 					ticker.Stop()
-					for scannedBlock, err := b.Run(); scannedBlock != 0 || err != nil; scannedBlock, err = b.Run() {
+					if !b.Campaign() {
+						ticker.Reset(interval)
+						continue
+					}
+					var lastErr error
+					for {
+						scannedBlock, err := b.Run()
 						if err != nil {
 							fmt.Println(fmt.Errorf("error scanning block: %s", err))
-							continue
+							lastErr = err
+							break
+						}
+						if scannedBlock == 0 || !b.Campaign() {
+							break
 						}
 					}
-					ticker.Reset(interval)
+					b.ranAt(time.Now(), lastErr)
+					for _, s := range b.scanners() {
+						if _, err := s.PurgeExpired(time.Now()); err != nil {
+							fmt.Println(fmt.Errorf("error purging expired histories: %s", err))
+						}
+					}
+					if lastErr != nil {
+						failures++
+					} else {
+						failures = 0
+					}
+					ticker.Reset(scanRetryDelay(interval, failures))
 					fmt.Printf("last scanned block %d\n", b.GetCurrentBlock())
 				}
 			}
@@ -89,93 +212,474 @@ func (b *Blockscan) StartScan(interval time.Duration) {
 	})
 }
 
-// GetCurrentBlock returns the last scanned block.
+// scanRetryDelay returns the wait before the next run of the scanning
+// after the given number of runs failing in a row: the interval, doubled
+// with every failure up to MaxScanRetryDelay.
+func scanRetryDelay(interval time.Duration, failures int) time.Duration {
+	delay := interval
+	for i := 0; i < failures && delay < MaxScanRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxScanRetryDelay && interval < MaxScanRetryDelay {
+		delay = MaxScanRetryDelay
+	}
+	return delay
+}
+
+// GetCurrentBlock returns the last scanned block. Standby copies return
+// the last block scanned by the leader.
 func (b *Blockscan) GetCurrentBlock() int {
+	if b.parent != nil {
+		return b.parent.GetCurrentBlock()
+	}
+	if b.election != nil && !b.IsLeader() {
+		lease, _, _ := b.loadLeaderLease()
+		if block, ok, _ := b.leaderCheckpoint(lease); ok {
+			return block
+		}
+	}
+	return b.scanned()
+}
+
+// scanned returns the last block scanned by the process.
+func (b *Blockscan) scanned() int {
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
 	return b.lastScannedBlock
 }
 
+func (b *Blockscan) setScanned(block int) {
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
+	b.lastScannedBlock = block
+}
+
+// Status returns the progress of the scanning started by StartScan.
+// Tenant scanners return the status of their parent.
+func (b *Blockscan) Status() svc.ScannerStatus {
+	if b.parent != nil {
+		return b.parent.Status()
+	}
+	status := svc.ScannerStatus{
+		CurrentBlock: b.GetCurrentBlock(),
+		Leader:       b.IsLeader(),
+	}
+
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
+	status.Running = b.running
+	if !b.lastRunAt.IsZero() {
+		at := b.lastRunAt.UTC()
+		status.LastRunAt = &at
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
+
+func (b *Blockscan) setRunning(running bool) {
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
+	b.running = running
+}
+
+// ranAt records the end of a scanning round and the error it stopped on,
+// nil if it scanned every pending block.
+func (b *Blockscan) ranAt(t time.Time, err error) {
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
+	b.lastRunAt, b.lastErr = t, err
+}
+
 // Run starts the block scanning process. It will return the number
 // of the last scanned block and an error if any. In case of no pending
-// blocks to be scanned it will return 0.
+// blocks to be scanned it will return 0. The block is indexed for
+// every tenant. With leader election, standbys return 0 right away, and
+// the leader renews its lease before saving the block, failing with
+// ErrNotLeader if it was taken over meanwhile.
 func (b *Blockscan) Run() (int, error) {
+	if b.parent != nil {
+		return b.parent.Run()
+	}
+	if !b.IsLeader() {
+		return 0, nil
+	}
+	b.scanLock.Lock()
+	defer b.scanLock.Unlock()
+
+	if b.shard != nil {
+		return b.runShard()
+	}
 	headBlock, err := b.clt.BlockNumber()
 	if err != nil {
 		fmt.Println("error querying head block number: ", err)
 		return 0, err
 	}
 
-	nextBlock := nextBlock(b.lastScannedBlock, headBlock)
+	nextBlock := nextBlock(b.scanned(), headBlock)
 	if nextBlock == 0 {
 		return 0, nil
 	}
 
-	txs, err := b.ScanBlock(nextBlock)
+	scanners, err := b.index(nextBlock, b.fence)
 	if err != nil {
-		fmt.Println("error scanning block: ", err)
 		return 0, err
 	}
+	b.setScanned(nextBlock)
+	if err := b.set(checkpointKey, []byte(strconv.Itoa(nextBlock))); err != nil {
+		fmt.Println("error saving checkpoint: ", err)
+	}
+	for _, s := range scanners {
+		s.afterBlock(nextBlock)
+	}
+
+	return nextBlock, nil
+}
+
+// index scans the block and saves its entries for every tenant, once fence
+// confirmed the worker still holds its leases. It returns the scanners the
+// block was indexed for, and fails if the entries could not all be saved,
+// so the block is scanned again.
+func (b *Blockscan) index(blockNumber int, fence func() error) ([]*Blockscan, error) {
+	entries, err := b.fetchEntries(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	receipts := newReceiptCache()
+	scanners := b.scanners()
+	matched := make([]map[string][]svc.Transaction, len(scanners))
+	for i, s := range scanners {
+		if matched[i], err = s.match(blockNumber, entries, receipts); err != nil {
+			fmt.Println("error scanning block: ", err)
+			return nil, err
+		}
+	}
+
+	if err := fence(); err != nil {
+		fmt.Printf("block %d not saved: %s\n", blockNumber, err)
+		return nil, err
+	}
+	for i, s := range scanners {
+		if err := s.SaveTxs(matched[i]); err != nil {
+			fmt.Printf("block %d not saved: %s\n", blockNumber, err)
+			return nil, err
+		}
+	}
+	return scanners, nil
+}
 
-	b.SaveTxs(txs)
-	b.lastScannedBlock = nextBlock
+// afterBlock runs the periodic consistency checks against the chain once
+// the block is saved. New subscriptions are anchored right away.
+func (b *Blockscan) afterBlock(block int) {
+	if b.reconcileEvery > 0 {
+		reconcile := b.anchorLedgers
+		if block%b.reconcileEvery == 0 {
+			reconcile = b.Reconcile
+		}
+		if err := reconcile(block); err != nil {
+			fmt.Println("error reconciling balances: ", err)
+		}
+	}
+	if b.nonceCheckEvery > 0 {
+		check := b.anchorNonceTrackers
+		if block%b.nonceCheckEvery == 0 {
+			check = b.CheckNonces
+		}
+		if err := check(block); err != nil {
+			fmt.Println("error checking nonces: ", err)
+		}
+	}
+}
 
-	return b.lastScannedBlock, nil
+// loadTxs returns the stored history of the address.
+func (b *Blockscan) loadTxs(address string) ([]svc.Transaction, error) {
+	values, err := b.kvstate.Get(address)
+	if err != nil {
+		return nil, fmt.Errorf("error getting transactions: %w", err)
+	}
+	txs := make([]svc.Transaction, 0, len(values))
+	for _, v := range values {
+		var tx svc.Transaction
+		if err := json.Unmarshal(v, &tx); err != nil {
+			fmt.Println("error unmarshaling transaction: ", err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
 }
 
 // ScanBlock retrieves the block with the given block number and
 // returns a map containing the ingoing/outgoing transactions for
 // the addresses subscribed.
 func (b *Blockscan) ScanBlock(blockNumber int) (map[string][]svc.Transaction, error) {
+	entries, err := b.fetchEntries(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return b.match(blockNumber, entries, newReceiptCache())
+}
+
+// fetchEntries retrieves the block with the given block number and
+// returns its entries, including the internal transfers of its
+// transactions.
+func (b *Blockscan) fetchEntries(blockNumber int) ([]svc.Transaction, error) {
 	block, err := b.clt.BlockByNumber(blockNumber)
 	if err != nil {
 		fmt.Println("error querying block: ", err)
 		return nil, err
 	}
 
-	newTxs := b.Pull(parseTxs(block.Transactions))
+	entries, err := blockEntries(block)
+	if err != nil {
+		fmt.Println("error parsing block: ", err)
+		return nil, err
+	}
+	internal, err := b.internalTransfers(blockNumber, block)
+	if err != nil {
+		fmt.Println("error tracing block: ", err)
+		return nil, err
+	}
+	return append(entries, internal...), nil
+}
+
+// blockEntries returns the transactions, withdrawals and authorizations
+// of the block. It fails when a field of the block is malformed, rather
+// than indexing wrong values.
+func blockEntries(block ethclient.Block) ([]svc.Transaction, error) {
+	entries, err := parseBlockTxs(block)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals, err := parseWithdrawals(block)
+	if err != nil {
+		return nil, err
+	}
+	authorizations, err := parseAuthorizations(block)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, withdrawals...)
+	return append(entries, authorizations...), nil
+}
+
+// match returns the entries of the block involving the subscribed
+// addresses and passing the tenant filters, with their receipts.
+func (b *Blockscan) match(blockNumber int, entries []svc.Transaction, receipts *receiptCache) (map[string][]svc.Transaction, error) {
+	newTxs := b.Pull(entries)
+	if b.tenant != nil {
+		for address, txs := range newTxs {
+			var kept []svc.Transaction
+			for _, tx := range txs {
+				if b.tenant.Filters.Match(tx) {
+					kept = append(kept, tx)
+				}
+			}
+			if len(kept) == 0 {
+				delete(newTxs, address)
+				continue
+			}
+			newTxs[address] = kept
+		}
+	}
+	if err := b.dropSkippedAuthorizations(blockNumber, entries, newTxs, receipts); err != nil {
+		fmt.Println("error checking authorizations: ", err)
+		return nil, err
+	}
 	if len(newTxs) == 0 {
 		return nil, nil
 	}
 
+	if err := b.attachReceipts(blockNumber, newTxs, receipts); err != nil {
+		fmt.Println("error querying receipts: ", err)
+		return nil, err
+	}
+
 	return newTxs, nil
 }
 
 // Pull retrieves ingoing/outgoing transactions for the given list
-// of address. This method does not check for internal transactions
-// from smart contract executions.
+// of address. Internal transfers made by smart contract executions are
+// matched as the other entries, when the block was traced. The calldata of
+// matched transactions is decoded against the ABI registry.
 func (b *Blockscan) Pull(txs []svc.Transaction) map[string][]svc.Transaction {
 	result := make(map[string][]svc.Transaction)
 	for _, tx := range txs {
-		if exist, _ := b.kvstate.Has(tx.From); exist {
-			result[tx.From] = append(result[tx.From], tx)
+		from, to := tx.Sender(), tx.Recipient()
+		fromExist := from != "" && b.subscribed(from)
+		toExist := to != "" && b.subscribed(to)
+		if !fromExist && !toExist {
+			continue
+		}
+
+		tx.Call = DecodeCall(b.abis, tx.Input)
+		if fromExist {
+			result[from] = append(result[from], tx)
 		}
-		if exist, _ := b.kvstate.Has(tx.To); exist {
-			result[tx.To] = append(result[tx.To], tx)
+		if toExist && to != from {
+			result[to] = append(result[to], tx)
 		}
 	}
 	return result
 }
 
-// saveTxs saves the given transactions into the key value store.
-func (b *Blockscan) SaveTxs(newTxs map[string][]svc.Transaction) {
+// SaveTxs saves the given transactions into the key value store. Entries
+// already stored for an address, identified by hash, kind and log index,
+// are skipped, so saving the same batch twice is a no-op. The history is
+// the record of what is stored: entries already in it are dropped as the
+// batch is swapped in, so workers saving the same entry concurrently store
+// it once, and entries are marked as seen only once stored. It fails if a
+// history can't be written, after saving the other addresses, and saving
+// the batch again stores what is missing. The statistics, rollups and
+// other state derived from the stored entries are updated as well, errors
+// being logged.
+func (b *Blockscan) SaveTxs(newTxs map[string][]svc.Transaction) error {
+	var failed error
 	for address, txs := range newTxs {
-		if err := b.kvstate.Put(address, encodeTxBatch(txs)); err != nil {
-			fmt.Println("error saving transactions: ", err)
+		fresh := b.unseen(address, txs)
+		if len(fresh) == 0 {
 			continue
 		}
+		stored, err := b.appendTxs(address, fresh)
+		if err != nil {
+			fmt.Println(err)
+			if failed == nil {
+				failed = fmt.Errorf("error saving transactions of %s: %w", address, err)
+			}
+			continue
+		}
+		if len(stored) == 0 {
+			continue
+		}
+		b.markSeen(address, stored)
+		if err := b.indexHashes(address, stored); err != nil {
+			fmt.Println(err)
+		}
+		if err := b.updateStats(address, stored); err != nil {
+			fmt.Println(err)
+		}
+		if err := b.updateRollups(address, stored, true); err != nil {
+			fmt.Println(err)
+		}
+		if err := b.trackNonces(address, stored); err != nil {
+			fmt.Println("error tracking nonces: ", err)
+		}
+		b.deliver(address, stored)
 	}
+	return failed
 }
 
-func encodeTxBatch(batch []svc.Transaction) [][]byte {
-	var txs [][]byte
-	for _, v := range batch {
-		tx, err := json.Marshal(v)
-		if err != nil {
-			fmt.Println("error marshaling transaction: ", err)
+// unseen returns the entries not marked as stored for the address,
+// leaving out duplicates within the batch.
+func (b *Blockscan) unseen(address string, txs []svc.Transaction) []svc.Transaction {
+	var fresh []svc.Transaction
+	batch := make(map[string]bool, len(txs))
+	for _, tx := range txs {
+		id := tx.ID()
+		if batch[id] {
 			continue
 		}
-		txs = append(txs, tx)
+		batch[id] = true
+		if seen, _ := b.kvstate.Has(seenKey(address, id)); !seen {
+			fresh = append(fresh, tx)
+		}
 	}
-	return txs
+	return fresh
+}
+
+// markSeen marks the entries as stored for the address. An entry left
+// unmarked, if the process stops first, is still found in the history when
+// saved again.
+func (b *Blockscan) markSeen(address string, txs []svc.Transaction) {
+	for _, tx := range txs {
+		if _, err := b.kvstate.CompareAndSwap(seenKey(address, tx.ID()), nil, nil); err != nil {
+			fmt.Println("error marking transaction as saved: ", err)
+		}
+	}
+}
+
+// DedupeTxs removes duplicated entries from every stored address history
+// and rebuilds the markers, the statistics and the per-address rollups
+// maintained by SaveTxs. It is meant to be run once on
+// data saved before SaveTxs became idempotent, and returns the number of
+// removed entries.
+func (b *Blockscan) DedupeTxs() (int, error) {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return 0, fmt.Errorf("error listing keys: %w", err)
+	}
+
+	// The rollups of every address are kept, as they include the activity
+	// of purged histories.
+	for _, key := range keys {
+		if strings.HasPrefix(key, rollupPrefix) && !strings.HasPrefix(key, rollupPrefix+allScope+":") {
+			if err := b.kvstate.Delete(key); err != nil {
+				return 0, fmt.Errorf("error deleting %s: %w", key, err)
+			}
+		}
+	}
+
+	removed := 0
+	for _, address := range keys {
+		if !isAddressKey(address) {
+			continue
+		}
+		entries, err := b.kvstate.Get(address)
+		if err != nil {
+			return removed, fmt.Errorf("error getting transactions: %w", err)
+		}
+
+		var (
+			kept [][]byte
+			txs  []svc.Transaction
+			seen = make(map[string]bool, len(entries))
+		)
+		for _, v := range entries {
+			var tx svc.Transaction
+			if err := json.Unmarshal(v, &tx); err != nil {
+				// Keep what we can't read rather than losing data.
+				kept = append(kept, v)
+				continue
+			}
+			if seen[tx.ID()] {
+				continue
+			}
+			seen[tx.ID()] = true
+			kept = append(kept, v)
+			txs = append(txs, tx)
+		}
+		removed += len(entries) - len(kept)
+
+		// Histories saved before they were kept ordered are sorted too.
+		kept, reordered := sortHistory(kept)
+		if len(kept) != len(entries) || reordered {
+			ok, err := b.kvstate.CompareAndReplace(address, 0, entries, kept)
+			if err != nil {
+				return removed, fmt.Errorf("error rewriting transactions: %w", err)
+			}
+			if !ok {
+				return removed, fmt.Errorf("error rewriting transactions: history of %s changed meanwhile", address)
+			}
+		}
+		for _, tx := range txs {
+			if err := b.kvstate.Put(seenKey(address, tx.ID()), nil); err != nil {
+				return removed, fmt.Errorf("error marking transaction as saved: %w", err)
+			}
+		}
+		if err := b.rebuildStats(address, txs); err != nil {
+			return removed, err
+		}
+		if err := b.updateRollups(address, txs, false); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
 }
 
 // nextBlock returns the next block to be scanned. It will return
@@ -192,20 +696,78 @@ func nextBlock(lastScannedBlock, headBlock int) int {
 	return next
 }
 
-// parseTxs converts a list of ethclient.Transaction into a list of
-// service.Transaction.
-func parseTxs(txs []ethclient.Transaction) []svc.Transaction {
-	transactions := make([]svc.Transaction, len(txs))
-	for i, v := range txs {
-		transactions[i] = ParseTx(v)
+// blockHeader holds the fields of the block copied to its entries.
+type blockHeader struct {
+	number        svc.Uint64
+	timestamp     svc.Uint64
+	baseFee       *svc.Big
+	blobGasUsed   *svc.Big
+	excessBlobGas *svc.Big
+}
+
+func parseBlockHeader(block ethclient.Block) (blockHeader, error) {
+	var d decoder
+	h := blockHeader{
+		number:        d.uint64("block number", block.Number),
+		timestamp:     d.uint64("block timestamp", block.Timestamp),
+		baseFee:       d.optionalBig("base fee per gas", block.BaseFeePerGas),
+		blobGasUsed:   d.optionalBig("blob gas used", block.BlobGasUsed),
+		excessBlobGas: d.optionalBig("excess blob gas", block.ExcessBlobGas),
+	}
+	if d.err != nil {
+		return blockHeader{}, fmt.Errorf("error parsing block %s: %w", block.Number, d.err)
 	}
-	return transactions
+	return h, nil
 }
 
-func decodeHexString(hexStr string) *big.Int {
-	hexStr = strings.TrimPrefix(hexStr, "0x")
+// parseBlockTxs converts the transactions of the block into a list of
+// service.Transaction carrying the block timestamp.
+func parseBlockTxs(block ethclient.Block) ([]svc.Transaction, error) {
+	h, err := parseBlockHeader(block)
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]svc.Transaction, len(block.Transactions))
+	for i, v := range block.Transactions {
+		if transactions[i], err = ParseTx(v); err != nil {
+			return nil, err
+		}
+		transactions[i].BlockNumber = h.number
+		transactions[i].Timestamp = h.timestamp
+		transactions[i].BaseFeePerGas = h.baseFee
+		transactions[i].BlobGasUsed = h.blobGasUsed
+		transactions[i].ExcessBlobGas = h.excessBlobGas
+	}
+	return transactions, nil
+}
 
-	n := new(big.Int)
-	n.SetString(hexStr, 16)
-	return n
+// parseWithdrawals converts the withdrawals of the block into a list of
+// service.Transaction of kind withdrawal, crediting the withdrawal address.
+func parseWithdrawals(block ethclient.Block) ([]svc.Transaction, error) {
+	h, err := parseBlockHeader(block)
+	if err != nil {
+		return nil, err
+	}
+	var d decoder
+	withdrawals := make([]svc.Transaction, len(block.Withdrawals))
+	for i, w := range block.Withdrawals {
+		to := d.address("withdrawal address", w.Address)
+		gwei := d.uint64("withdrawal amount", w.Amount)
+		withdrawals[i] = svc.Transaction{
+			Kind:        svc.KindWithdrawal,
+			BlockNumber: h.number,
+			To:          &to,
+			Value:       svc.NewBig(new(big.Int).Mul(new(big.Int).SetUint64(uint64(gwei)), big.NewInt(1e9))),
+			Timestamp:   h.timestamp,
+			Withdrawal: &svc.Withdrawal{
+				Index:          d.uint64("withdrawal index", w.Index),
+				ValidatorIndex: d.uint64("validator index", w.ValidatorIndex),
+				AmountGwei:     gwei,
+			},
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("error parsing withdrawals of block %s: %w", block.Number, d.err)
+	}
+	return withdrawals, nil
 }
@@ -0,0 +1,1516 @@
+package txparser_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state/filedb"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state/inmemorydb"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/txparser"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
+)
+
+const (
+	alice = "0x388c818ca8b9251b393131c08a736a67ccb19297"
+	bob   = "0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"
+	token = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
+
+func word(s string) string {
+	return strings.Repeat("0", 64-len(s)) + s
+}
+
+// hexHash returns the hex form of the hash whose value is n.
+func hexHash(n int) string {
+	return "0x" + word(fmt.Sprintf("%x", n))
+}
+
+// failingStore fails to write the history of an address while fail is
+// set, and calls saving, if set, before writing it.
+type failingStore struct {
+	*inmemorydb.Database
+	address string
+	fail    bool
+	saving  func()
+}
+
+func (s *failingStore) CompareAndReplace(key string, start int, old, values [][]byte) (bool, error) {
+	if key == s.address && s.saving != nil {
+		s.saving()
+	}
+	if s.fail && key == s.address {
+		return false, errors.New("store unavailable")
+	}
+	return s.Database.CompareAndReplace(key, start, old, values)
+}
+
+// listingStore counts the calls listing every key of the store.
+type listingStore struct {
+	*inmemorydb.Database
+	mu    sync.Mutex
+	lists int
+}
+
+func (s *listingStore) List() ([]string, error) {
+	s.mu.Lock()
+	s.lists++
+	s.mu.Unlock()
+	return s.Database.List()
+}
+
+func (s *listingStore) Lists() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists
+}
+
+func hash(n int) svc.Hash {
+	h, _ := svc.ParseHash(hexHash(n))
+	return h
+}
+
+func address(s string) svc.Address {
+	a, _ := svc.ParseAddress(s)
+	return a
+}
+
+func recipient(s string) *svc.Address {
+	a := address(s)
+	return &a
+}
+
+func quantity(n int64) *svc.Big {
+	return svc.NewBig(big.NewInt(n))
+}
+
+func data(s string) svc.Bytes {
+	b, _ := svc.ParseBytes(s)
+	return b
+}
+
+func TestBlockscan(t *testing.T) {
+	t.Run("DecodeCalldata", func(t *testing.T) {
+		testID := 0
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1)
+		service.Subscribe(alice)
+
+		tx := svc.Transaction{
+			Hash:  hash(0x01),
+			From:  address(alice),
+			To:    recipient(token),
+			Input: data("0xa9059cbb" + word(bob[2:]) + word("3e8")),
+		}
+		entries := service.Pull([]svc.Transaction{tx})
+		if len(entries[alice]) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould match the subscribed sender : Got %d entries", Failed, testID, len(entries[alice]))
+		}
+
+		call := entries[alice][0].Call
+		if call == nil || call.Method != "transfer" || call.Signature != "transfer(address,uint256)" {
+			t.Fatalf("\t%s\tTest %d:\tShould decode the calldata of matched transactions : Got %+v", Failed, testID, call)
+		}
+		if call.Args[0].Value != bob || call.Args[1].Value != "1000" {
+			t.Fatalf("\t%s\tTest %d:\tShould decode typed call arguments : Got %+v", Failed, testID, call.Args)
+		}
+
+		service.SaveTxs(entries)
+		stored := service.GetTransactions(alice)
+		if len(stored) != 1 || stored[0].Call == nil || stored[0].Call.String() != "transfer(to="+bob+", amount=1000)" {
+			t.Fatalf("\t%s\tTest %d:\tShould store the decoded call with the transaction : Got %+v", Failed, testID, stored)
+		}
+		t.Logf("\t%s\tTest %d:\tShould decode and store the calldata of matched transactions", Success, testID)
+	})
+
+	t.Run("IdempotentSave", func(t *testing.T) {
+		testID := 1
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1)
+		service.Subscribe(alice)
+
+		self := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x02), From: address(alice), To: recipient(alice)}
+		entries := service.Pull([]svc.Transaction{self})
+		if len(entries[alice]) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould pull a self-transfer once : Got %d entries", Failed, testID, len(entries[alice]))
+		}
+
+		service.SaveTxs(entries)
+		service.SaveTxs(entries)
+		if got := service.GetTransactions(alice); len(got) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould ignore already saved transactions : Expected 1. Got %d", Failed, testID, len(got))
+		}
+
+		// The process stopped after storing an entry, before marking it.
+		kv := inmemorydb.New()
+		stored, _ := json.Marshal(self)
+		kv.Put(alice, [][]byte{stored})
+		scan := txparser.NewScan(context.Background(), kv, ethclient.New("http://127.0.0.1:0"), 1)
+		if err := scan.SaveTxs(entries); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould save the batch again : %v", Failed, testID, err)
+		}
+		if got, _ := kv.Get(alice); len(got) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould find unmarked entries in the history : Expected 1. Got %d", Failed, testID, len(got))
+		}
+
+		node := newFakeNode(t, ethclient.Block{
+			Number:       hexInt(2),
+			Timestamp:    hexInt(1760000000),
+			Transactions: []ethclient.Transaction{{Hash: hexHash(0x04), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"}},
+		})
+		store := &failingStore{Database: inmemorydb.New(), address: alice, fail: true}
+		failing := txparser.NewWithStore(context.Background(), store, node.URL, 1)
+		failing.Subscribe(alice)
+		if _, err := failing.Run(); err == nil || failing.GetCurrentBlock() != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould not move past a block which was not saved : Got block %d, %v", Failed, testID, failing.GetCurrentBlock(), err)
+		}
+		store.fail = false
+		if block, err := failing.Run(); err != nil || block != 2 || len(failing.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould save the block when scanned again : Got block %d, %v", Failed, testID, block, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould save each transaction only once per address", Success, testID)
+	})
+
+	t.Run("DedupeTxs", func(t *testing.T) {
+		testID := 2
+		kv := inmemorydb.New()
+		defer kv.Close()
+
+		tx, _ := json.Marshal(svc.Transaction{Hash: hash(0x03), From: address(alice), To: recipient(bob)})
+		kv.Put(alice, [][]byte{tx, tx, tx})
+
+		scan := txparser.NewScan(context.Background(), kv, ethclient.New("http://127.0.0.1:0"), 1)
+		removed, err := scan.DedupeTxs()
+		if err != nil || removed != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould remove duplicated transactions : Expected 2. Got %d, %v", Failed, testID, removed, err)
+		}
+
+		scan.SaveTxs(map[string][]svc.Transaction{alice: {{Kind: svc.KindTransaction, Hash: hash(0x03), From: address(alice), To: recipient(bob)}}})
+		if got, _ := kv.Get(alice); len(got) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould not save deduped transactions again : Expected 1. Got %d", Failed, testID, len(got))
+		}
+		t.Logf("\t%s\tTest %d:\tShould remove duplicated transactions from existing data", Success, testID)
+	})
+
+	t.Run("TimeRange", func(t *testing.T) {
+		testID := 3
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1)
+		service.Subscribe(alice)
+
+		day := time.Date(2023, 7, 23, 0, 0, 0, 0, time.UTC)
+		var txs []svc.Transaction
+		for i := 0; i < 3; i++ {
+			txs = append(txs, svc.Transaction{
+				Kind:      svc.KindTransaction,
+				Hash:      hash(0x10 + i),
+				From:      address(alice),
+				To:        recipient(bob),
+				Timestamp: svc.Uint64(day.Add(time.Duration(i) * 24 * time.Hour).Unix()),
+			})
+		}
+		service.SaveTxs(service.Pull(txs))
+
+		got := service.GetTransactions(alice, svc.Since(day.Add(time.Hour)), svc.Until(day.Add(48*time.Hour)))
+		if len(got) != 2 || got[0].Hash != hash(0x11) || got[1].Hash != hash(0x12) {
+			t.Fatalf("\t%s\tTest %d:\tShould filter transactions by time range : Got %+v", Failed, testID, got)
+		}
+		if !got[0].Time().Equal(day.Add(24 * time.Hour)) {
+			t.Fatalf("\t%s\tTest %d:\tShould carry the block timestamp : Got %s", Failed, testID, got[0].Time())
+		}
+		t.Logf("\t%s\tTest %d:\tShould filter transactions by time range", Success, testID)
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		testID := 4
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1)
+		tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x20), From: address(alice), To: recipient(bob)}
+
+		service.Subscribe(alice)
+		service.SaveTxs(service.Pull([]svc.Transaction{tx}))
+		if !service.Unsubscribe(alice, svc.UnsubscribeOptions{Retention: svc.KeepHistory}) {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to unsubscribe an address", Failed, testID)
+		}
+		if entries := service.Pull([]svc.Transaction{tx}); len(entries) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould stop matching unsubscribed addresses : Got %d entries", Failed, testID, len(entries))
+		}
+		if got := service.GetTransactions(alice); len(got) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the history : Expected 1. Got %d", Failed, testID, len(got))
+		}
+		if service.Unsubscribe(alice, svc.UnsubscribeOptions{}) {
+			t.Fatalf("\t%s\tTest %d:\tShould not unsubscribe an unknown address", Failed, testID)
+		}
+
+		service.Subscribe(alice)
+		service.Unsubscribe(alice, svc.UnsubscribeOptions{Retention: svc.PurgeHistory})
+		if got := service.GetTransactions(alice); len(got) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould purge the history : Expected 0. Got %d", Failed, testID, len(got))
+		}
+
+		service.Subscribe(alice)
+		service.SaveTxs(map[string][]svc.Transaction{alice: {tx}})
+		service.Unsubscribe(alice, svc.UnsubscribeOptions{Retention: svc.ExpireHistory, GracePeriod: time.Hour})
+		if n, _ := service.PurgeExpired(time.Now()); n != 0 || len(service.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the history during the grace period", Failed, testID)
+		}
+		if n, _ := service.PurgeExpired(time.Now().Add(2 * time.Hour)); n != 1 || len(service.GetTransactions(alice)) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould delete the history after the grace period", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould apply the retention policy on unsubscribe", Success, testID)
+	})
+
+	t.Run("Withdrawals", func(t *testing.T) {
+		testID := 5
+		node := newFakeNode(t, ethclient.Block{
+			Number:    hexInt(100),
+			Timestamp: hexInt(1700000000),
+			Transactions: []ethclient.Transaction{
+				{BlockNumber: hexInt(100), Hash: hexHash(0x30), From: bob, To: token, Value: "0x0"},
+			},
+			Withdrawals: []ethclient.Withdrawal{
+				{Index: "0x10", ValidatorIndex: "0x2a", Address: alice, Amount: "0x3b9aca00"},
+				{Index: "0x11", ValidatorIndex: "0x2b", Address: bob, Amount: "0x1"},
+			},
+		})
+		service := txparser.New(context.Background(), node.URL, 99)
+		service.Subscribe(alice)
+
+		if block, err := service.Run(); err != nil || block != 100 {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the next block : Got %d, %v", Failed, testID, block, err)
+		}
+
+		got := service.GetTransactions(alice)
+		if len(got) != 1 || got[0].Kind != svc.KindWithdrawal || got[0].Withdrawal == nil {
+			t.Fatalf("\t%s\tTest %d:\tShould match withdrawals of subscribed addresses : Got %+v", Failed, testID, got)
+		}
+		w := got[0].Withdrawal
+		if w.Index != 16 || w.ValidatorIndex != 42 || w.AmountGwei != 1e9 || got[0].Value.String() != "1000000000000000000" {
+			t.Fatalf("\t%s\tTest %d:\tShould decode withdrawal index, validator and amount : Got %+v, value %s", Failed, testID, w, got[0].Value)
+		}
+		if got[0].Timestamp != 1700000000 {
+			t.Fatalf("\t%s\tTest %d:\tShould carry the block timestamp : Got %d", Failed, testID, got[0].Timestamp)
+		}
+		t.Logf("\t%s\tTest %d:\tShould track withdrawals to subscribed addresses", Success, testID)
+	})
+
+	t.Run("TypedTransactions", func(t *testing.T) {
+		testID := 6
+		node := newFakeNode(t, ethclient.Block{
+			Number:        hexInt(200),
+			Timestamp:     hexInt(1710000000),
+			BaseFeePerGas: "0x3b9aca00",
+			BlobGasUsed:   "0x20000",
+			ExcessBlobGas: "0x0",
+			Transactions: []ethclient.Transaction{
+				{
+					Type: "0x2", Hash: hexHash(0x40), From: alice, To: bob, Value: "0x1", TransactionIndex: "0x0",
+					GasPrice: "0x77359400", MaxFeePerGas: "0xb2d05e00", MaxPriorityFeePerGas: "0x3b9aca00",
+					AccessList: []ethclient.AccessListEntry{{Address: token, StorageKeys: []string{"0x" + word("1")}}},
+				},
+				{
+					Type: "0x3", Hash: hexHash(0x41), From: alice, To: bob, Value: "0x0", TransactionIndex: "0x1",
+					MaxFeePerGas: "0xb2d05e00", MaxPriorityFeePerGas: "0x1", MaxFeePerBlobGas: "0x64",
+					BlobVersionedHashes: []string{"0x01" + word("")[2:]},
+				},
+			},
+		})
+		service := txparser.New(context.Background(), node.URL, 199)
+		service.Subscribe(alice)
+		if _, err := service.Run(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+		}
+
+		got := service.GetTransactions(alice)
+		if len(got) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould store typed transactions : Got %d", Failed, testID, len(got))
+		}
+		dynamic, blob := got[0], got[1]
+		if dynamic.Type != svc.DynamicFeeTxType || dynamic.MaxFeePerGas.ToInt().Int64() != 3e9 || dynamic.MaxPriorityFeePerGas.ToInt().Int64() != 1e9 || len(dynamic.AccessList) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould carry EIP-1559 and EIP-2930 fields : Got %+v", Failed, testID, dynamic)
+		}
+		if blob.Type != svc.BlobTxType || blob.TransactionIndex != 1 || blob.MaxFeePerBlobGas.ToInt().Int64() != 100 || len(blob.BlobVersionedHashes) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould carry EIP-4844 fields : Got %+v", Failed, testID, blob)
+		}
+		if blob.BaseFeePerGas.ToInt().Int64() != 1e9 || blob.BlobGasUsed.ToInt().Int64() != 0x20000 || blob.ExcessBlobGas.ToInt().Sign() != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould carry block fee market fields : Got %+v", Failed, testID, blob)
+		}
+		t.Logf("\t%s\tTest %d:\tShould carry typed transaction fields", Success, testID)
+	})
+
+	t.Run("Authorizations", func(t *testing.T) {
+		testID := 7
+		// Authorization signed by the private key 1, whose address is
+		// 0x7e5f4552091a69125d5dfcb7b8c2659029395bdf.
+		authority := "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"
+		auth := ethclient.Authorization{
+			ChainID: "0x1",
+			Address: token,
+			Nonce:   "0x0",
+			YParity: "0x0",
+			R:       "0xf01d6b9018ab421dd410404cb869072065522bf85734008f105cf385a023a80f",
+			S:       "0x474846fb3efa38d26d45443af003c58f7453e7c0eeb158cf1cef0eade8330155",
+		}
+		invalid := auth
+		invalid.R = "0x0"
+		otherChain := auth
+		otherChain.ChainID = "0x5"
+
+		// The replay of the authorization in the second transaction is
+		// skipped, the nonce of the authority having moved on.
+		node := newFakeNode(t, ethclient.Block{
+			Number:    hexInt(300),
+			Timestamp: hexInt(1750000000),
+			Transactions: []ethclient.Transaction{
+				{Type: "0x4", ChainID: "0x1", Hash: hexHash(0x50), From: bob, To: bob, Value: "0x0", AuthorizationList: []ethclient.Authorization{invalid, auth, otherChain}},
+				{Type: "0x4", ChainID: "0x1", Hash: hexHash(0x51), From: bob, To: bob, Value: "0x0", AuthorizationList: []ethclient.Authorization{auth}},
+			},
+		})
+		service := txparser.New(context.Background(), node.URL, 299)
+		service.Subscribe(authority)
+		service.Subscribe(token)
+		if _, err := service.Run(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+		}
+
+		for _, addr := range []string{authority, token} {
+			got := service.GetTransactions(addr)
+			if len(got) != 1 || got[0].Kind != svc.KindAuthorization || got[0].Authorization == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould record the authorization for %s : Got %+v", Failed, testID, addr, got)
+			}
+			a := got[0].Authorization
+			if a.Authority != address(authority) || a.Address != address(token) || a.Index != 1 || got[0].Hash != hash(0x50) {
+				t.Fatalf("\t%s\tTest %d:\tShould recover the authority : Got %+v", Failed, testID, a)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould record the applied authorizations of subscribed authorities and delegates", Success, testID)
+	})
+
+	t.Run("Fees", func(t *testing.T) {
+		testID := 8
+		node := newFakeNode(t,
+			ethclient.Block{
+				Number:    hexInt(400),
+				Timestamp: hexInt(1760000000),
+				Transactions: []ethclient.Transaction{
+					{Type: "0x2", Hash: hexHash(0x60), From: alice, To: bob, Value: "0x1", GasPrice: "0x2"},
+					{Type: "0x0", Hash: hexHash(0x61), From: bob, To: alice, Value: "0x1", GasPrice: "0x3"},
+				},
+			},
+			ethclient.Block{
+				Number:    hexInt(401),
+				Timestamp: hexInt(1760000012),
+				Transactions: []ethclient.Transaction{
+					{Type: "0x3", Hash: hexHash(0x62), From: alice, To: bob, Value: "0x0", GasPrice: "0x2"},
+				},
+			},
+		)
+		node.SetReceipt(ethclient.Receipt{
+			TransactionHash: hexHash(0x62), Status: "0x1", GasUsed: "0x5208", EffectiveGasPrice: "0x2",
+			BlobGasUsed: "0x20000", BlobGasPrice: "0x3",
+		})
+		// Endpoints without eth_getBlockReceipts fall back to receipts by hash.
+		node.Handle(ethclient.GetBlockReceipts, func([]json.RawMessage) (interface{}, error) {
+			return nil, fmt.Errorf("method not supported")
+		})
+
+		service := txparser.New(context.Background(), node.URL, 399)
+		service.Subscribe(alice)
+		for i := 0; i < 2; i++ {
+			if _, err := service.Run(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+			}
+		}
+
+		got := service.GetTransactions(alice)
+		if len(got) != 3 || got[0].Receipt == nil || got[0].Fee.ToInt().Int64() != 42000 {
+			t.Fatalf("\t%s\tTest %d:\tShould compute the fee from the receipt : Got %+v", Failed, testID, got)
+		}
+		if fee := got[2].Fee.ToInt().Int64(); fee != 42000+3*0x20000 {
+			t.Fatalf("\t%s\tTest %d:\tShould include blob fees : Got %d", Failed, testID, fee)
+		}
+		if total := service.GetFees(alice); total.Int64() != 84000+3*0x20000 {
+			t.Fatalf("\t%s\tTest %d:\tShould total fees of outgoing transactions only : Got %s", Failed, testID, total)
+		}
+		if total := service.GetFees(alice, svc.ToBlock(400)); total.Int64() != 42000 {
+			t.Fatalf("\t%s\tTest %d:\tShould total fees over a block range : Got %s", Failed, testID, total)
+		}
+		t.Logf("\t%s\tTest %d:\tShould account the fees paid by subscribed senders", Success, testID)
+	})
+
+	t.Run("BalanceLedger", func(t *testing.T) {
+		testID := 9
+		node := newFakeNode(t,
+			ethclient.Block{
+				Number:       hexInt(500),
+				Timestamp:    hexInt(1770000000),
+				Transactions: []ethclient.Transaction{{Hash: hexHash(0x70), From: bob, To: alice, Value: hexInt(1e6), GasPrice: "0x1"}},
+			},
+			ethclient.Block{
+				Number:    hexInt(501),
+				Timestamp: hexInt(1770000012),
+				Transactions: []ethclient.Transaction{
+					{Hash: hexHash(0x71), From: alice, To: bob, Value: hexInt(300), GasPrice: "0x1"},
+					{Hash: hexHash(0x72), From: bob, To: token, Value: hexInt(80), GasPrice: "0x1"},
+				},
+			},
+			ethclient.Block{Number: hexInt(502), Timestamp: hexInt(1770000024)},
+		)
+		// The contract called by bob pays 50 wei out to alice. The
+		// payment of 7 wei reverts with its parent call.
+		node.SetTrace(hexHash(0x72), ethclient.CallFrame{
+			Type: "CALL", From: bob, To: token, Value: hexInt(80),
+			Calls: []ethclient.CallFrame{
+				{Type: "CALL", From: token, To: alice, Value: hexInt(50)},
+				{Type: "CALL", From: token, To: bob, Value: "0x0", Error: "execution reverted", Calls: []ethclient.CallFrame{
+					{Type: "CALL", From: bob, To: alice, Value: hexInt(7)},
+				}},
+				{Type: "DELEGATECALL", From: token, To: bob, Value: hexInt(80)},
+			},
+		})
+		node.SetBalance(alice, 500, 2e6)
+		node.SetBalance(alice, 501, 2e6-21300+50)
+		// A balance change of 9 wei the indexer can't see.
+		node.SetBalance(alice, 502, 2e6-21300+50+9)
+
+		service := txparser.New(context.Background(), node.URL, 499, txparser.WithReconcileInterval(1))
+		service.Subscribe(alice)
+		for i := 0; i < 3; i++ {
+			if _, err := service.Run(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+			}
+		}
+
+		got := service.GetTransactions(alice, svc.WithBalance())
+		if len(got) != 3 || got[0].BalanceAfter.ToInt().Int64() != 2e6 || got[1].BalanceAfter.ToInt().Int64() != 2e6-21300 {
+			t.Fatalf("\t%s\tTest %d:\tShould return the running balance after each transaction : Got %+v", Failed, testID, got)
+		}
+		if got[2].Kind != svc.KindInternal || got[2].Internal.Index != 1 || got[2].Sender() != token || got[2].BalanceAfter.ToInt().Int64() != 2e6-21300+50 {
+			t.Fatalf("\t%s\tTest %d:\tShould index the internal transfer to the address : Got %+v", Failed, testID, got[2])
+		}
+		mismatches := service.GetBalanceMismatches(alice)
+		if len(mismatches) != 1 || mismatches[0].Block != 502 || mismatches[0].Diff().Int64() != 9 {
+			t.Fatalf("\t%s\tTest %d:\tShould flag balance mismatches : Got %+v", Failed, testID, mismatches)
+		}
+		if balance := service.GetBalance(alice); balance.Int64() != 2e6-21300+50+9 {
+			t.Fatalf("\t%s\tTest %d:\tShould correct the balance with the mismatch : Got %s", Failed, testID, balance)
+		}
+
+		// Endpoints refusing to trace blocks with errors of their own, or
+		// with an HTTP status, are probed on the first block.
+		refusing := newFakeNode(t, ethclient.Block{
+			Number:       hexInt(503),
+			Timestamp:    hexInt(1770000036),
+			Transactions: []ethclient.Transaction{{Hash: hexHash(0x73), From: bob, To: alice, Value: hexInt(5), GasPrice: "0x1"}},
+		}, ethclient.Block{
+			Number:       hexInt(504),
+			Timestamp:    hexInt(1770000048),
+			Transactions: []ethclient.Transaction{{Hash: hexHash(0x74), From: bob, To: alice, Value: hexInt(5), GasPrice: "0x1"}},
+		})
+		refusing.Handle(ethclient.TraceBlockByNumber, func(params []json.RawMessage) (interface{}, error) {
+			return nil, errors.New("method not available on this plan")
+		})
+		forbidding := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if bytes.Contains(body, []byte(ethclient.TraceBlockByNumber)) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			resp, err := http.Post(refusing.URL, "application/json", bytes.NewReader(body))
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			io.Copy(w, resp.Body)
+		}))
+		defer forbidding.Close()
+		for _, endpoint := range []string{refusing.URL, forbidding.URL} {
+			untraced := txparser.New(context.Background(), endpoint, 502)
+			untraced.Subscribe(alice)
+			for want := 503; want <= 504; want++ {
+				if block, err := untraced.Run(); err != nil || block != want {
+					t.Fatalf("\t%s\tTest %d:\tShould scan without traces when the endpoint refuses them : Got %d, %v", Failed, testID, block, err)
+				}
+			}
+			if got := untraced.GetTransactions(alice); len(got) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould index the blocks without traces : Got %d entries", Failed, testID, len(got))
+			}
+		}
+		if calls := refusing.Calls(ethclient.TraceBlockByNumber); calls != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould probe the endpoint once : Got %d calls", Failed, testID, calls)
+		}
+		t.Logf("\t%s\tTest %d:\tShould keep a balance ledger reconciled with the chain", Success, testID)
+	})
+
+	t.Run("NonceGaps", func(t *testing.T) {
+		testID := 10
+		sent := func(block, nonce int) ethclient.Block {
+			return ethclient.Block{
+				Number:       hexInt(block),
+				Timestamp:    hexInt(1780000000 + block),
+				Transactions: []ethclient.Transaction{{Hash: hexHash(0x800 + nonce), From: alice, To: bob, Nonce: hexInt(nonce), Value: "0x1"}},
+			}
+		}
+		node := newFakeNode(t, sent(600, 5), sent(601, 6), sent(602, 7))
+
+		// The node first serves block 601 without its transaction.
+		served := false
+		node.Handle(ethclient.GetBlockByNumber, func(params []json.RawMessage) (interface{}, error) {
+			number, _ := hexParam(params[0])
+			if number == 601 && !served {
+				served = true
+				return ethclient.Block{Number: hexInt(601), Timestamp: hexInt(1780000601)}, nil
+			}
+			return complete(sent(int(number), int(number)-595)), nil
+		})
+
+		store := &listingStore{Database: inmemorydb.New()}
+		service := txparser.NewWithStore(context.Background(), store, node.URL, 599, txparser.WithNonceCheckInterval(2))
+		service.Subscribe(alice)
+		var lists int
+		for i := 0; i < 2; i++ {
+			if _, err := service.Run(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+			}
+			if i == 0 {
+				lists = store.Lists()
+			}
+		}
+		if got := store.Lists(); got != lists {
+			t.Fatalf("\t%s\tTest %d:\tShould find the subscriptions and tenants without listing the store : Got %d listings", Failed, testID, got-lists)
+		}
+		if got := service.GetTransactions(alice); len(got) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould miss the transaction of block 601 : Got %d", Failed, testID, len(got))
+		}
+
+		if _, err := service.Run(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the next block and rescan the gap : %v", Failed, testID, err)
+		}
+		status := service.GetNonceStatus(alice)
+		if got := service.GetTransactions(alice); len(got) != 3 {
+			t.Fatalf("\t%s\tTest %d:\tShould rescan the block of the missing nonce : Got %d transactions", Failed, testID, len(got))
+		}
+		if status.Highest.Int64() != 7 || status.TransactionCount != 8 || len(status.Gaps) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould report no gap once rescanned : Got %+v", Failed, testID, status)
+		}
+		t.Logf("\t%s\tTest %d:\tShould detect nonce gaps and rescan their block", Success, testID)
+	})
+
+	t.Run("SubscriptionRegistry", func(t *testing.T) {
+		testID := 11
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 700)
+		expired := time.Now().Add(-time.Minute)
+
+		service.SubscribeWith(svc.Subscription{Address: "0x" + strings.ToUpper(alice[2:]), Owner: "payments", Source: "cli", Labels: []string{"hot-wallet"}, Metadata: map[string]string{"customer": "acme"}})
+		service.SubscribeWith(svc.Subscription{Address: bob, Owner: "treasury", Labels: []string{"cold-wallet"}, ExpiresAt: &expired})
+		service.Subscribe(token)
+
+		sub, ok := service.GetSubscription("0x" + strings.ToUpper(alice[2:]))
+		if !ok || sub.Owner != "payments" || sub.StartBlock != 701 || sub.CreatedAt.IsZero() {
+			t.Fatalf("\t%s\tTest %d:\tShould record the subscription details : Got %+v", Failed, testID, sub)
+		}
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{}); len(got) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould list active subscriptions : Got %d", Failed, testID, len(got))
+		}
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{IncludeExpired: true}); len(got) != 3 {
+			t.Fatalf("\t%s\tTest %d:\tShould list expired subscriptions on demand : Got %d", Failed, testID, len(got))
+		}
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{Labels: []string{"HOT-WALLET"}, Metadata: map[string]string{"customer": "acme"}}); len(got) != 1 || got[0].Owner != "payments" {
+			t.Fatalf("\t%s\tTest %d:\tShould search subscriptions by labels and metadata : Got %+v", Failed, testID, got)
+		}
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{Text: "treas", IncludeExpired: true}); len(got) != 1 || got[0].Address != svc.Checksummed(bob) {
+			t.Fatalf("\t%s\tTest %d:\tShould search subscriptions by text : Got %+v", Failed, testID, got)
+		}
+
+		tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x90), From: address(bob), To: recipient(token)}
+		if entries := service.Pull([]svc.Transaction{tx}); len(entries) != 1 || len(entries[token]) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould stop matching expired subscriptions : Got %+v", Failed, testID, entries)
+		}
+
+		service.Subscribe(alice)
+		if sub, _ := service.GetSubscription(alice); sub.Owner != "payments" {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the details when subscribing again : Got %+v", Failed, testID, sub)
+		}
+
+		// A store written before the subscription index existed.
+		legacy := inmemorydb.New()
+		legacy.Put(alice, [][]byte{})
+		legacy.Put("sub:"+alice, [][]byte{[]byte(`{"address":"` + alice + `","owner":"payments"}`)})
+		service = txparser.NewWithStore(context.Background(), legacy, "http://127.0.0.1:0", 700)
+		service.Subscribe(bob)
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{}); len(got) != 2 || got[0].Owner != "payments" {
+			t.Fatalf("\t%s\tTest %d:\tShould index the subscriptions of an earlier store : Got %+v", Failed, testID, got)
+		}
+		service.Unsubscribe(alice, svc.UnsubscribeOptions{})
+		if got := service.ListSubscriptions(svc.SubscriptionFilter{}); len(got) != 1 || got[0].Address != svc.Checksummed(bob) {
+			t.Fatalf("\t%s\tTest %d:\tShould drop unsubscribed addresses from the index : Got %+v", Failed, testID, got)
+		}
+		t.Logf("\t%s\tTest %d:\tShould keep a searchable subscription registry", Success, testID)
+	})
+
+	t.Run("Tenants", func(t *testing.T) {
+		testID := 12
+		node := newFakeNode(t, ethclient.Block{
+			Number:    hexInt(800),
+			Timestamp: hexInt(1760000000),
+			Transactions: []ethclient.Transaction{
+				{Type: "0x2", Hash: hexHash(0xa0), From: alice, To: bob, Value: "0xde0b6b3a7640000", GasPrice: "0x1"},
+				{Type: "0x2", Hash: hexHash(0xa1), From: bob, To: alice, Value: "0x1", GasPrice: "0x1"},
+			},
+		})
+
+		var (
+			lock      sync.Mutex
+			delivered []txparser.Delivery
+		)
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var d txparser.Delivery
+			json.NewDecoder(r.Body).Decode(&d)
+			lock.Lock()
+			delivered = append(delivered, d)
+			lock.Unlock()
+		}))
+		defer webhook.Close()
+
+		service := txparser.New(context.Background(), node.URL, 799, txparser.WithReconcileInterval(0), txparser.WithNonceCheckInterval(0))
+		if service.CreateTenant(svc.Tenant{ID: "bad:id"}) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject invalid tenant IDs", Failed, testID)
+		}
+		for _, target := range []string{"ftp://example.com/hook", "file:///etc/passwd", "example.com/hook", "http://", "http://:8080/hook", "https://exa mple.com", ""} {
+			if service.CreateTenant(svc.Tenant{ID: "payments", DeliveryTargets: []string{target}}) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the delivery target %q", Failed, testID, target)
+			}
+		}
+		service.CreateTenant(svc.Tenant{ID: "payments", DeliveryTargets: []string{webhook.URL}})
+		service.CreateTenant(svc.Tenant{ID: "treasury", Filters: svc.TenantFilters{MinValue: big.NewInt(1e18)}})
+
+		payments, _ := service.Tenant("payments")
+		treasury, _ := service.Tenant("treasury")
+		payments.Subscribe(alice)
+		treasury.Subscribe(alice)
+		treasury.Subscribe(bob)
+
+		if _, err := service.Run(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the next block : %v", Failed, testID, err)
+		}
+		if n := node.Calls(ethclient.GetBlockByNumber); n != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould fetch the block once for every tenant : Got %d calls", Failed, testID, n)
+		}
+		if got := payments.GetTransactions(alice); len(got) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould index the tenant subscriptions : Got %d", Failed, testID, len(got))
+		}
+		if got := treasury.GetTransactions(bob); len(got) != 1 || got[0].Hash != hash(0xa0) {
+			t.Fatalf("\t%s\tTest %d:\tShould apply the tenant filters : Got %+v", Failed, testID, got)
+		}
+		if got := payments.GetTransactions(bob); len(got) != 0 || len(payments.ListSubscriptions(svc.SubscriptionFilter{})) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould not see the addresses of other tenants : Got %+v", Failed, testID, got)
+		}
+		if got := service.GetTransactions(alice); len(got) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not see tenant addresses from the default tenant : Got %+v", Failed, testID, got)
+		}
+
+		lock.Lock()
+		if len(delivered) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould queue deliveries rather than post them while scanning : Got %+v", Failed, testID, delivered)
+		}
+		lock.Unlock()
+		now := time.Now()
+		if n, err := service.DeliverPending(now); err != nil || n != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould post the queued deliveries : Got %d, %v", Failed, testID, n, err)
+		}
+		if n, _ := service.DeliverPending(now); n != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould post each delivery once : Got %d", Failed, testID, n)
+		}
+		lock.Lock()
+		if len(delivered) != 1 || delivered[0].Tenant != "payments" || len(delivered[0].Transactions) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould deliver new entries to the tenant targets : Got %+v", Failed, testID, delivered)
+		}
+		lock.Unlock()
+
+		// A failing target is retried with a backoff.
+		failures := 1
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var d txparser.Delivery
+			json.NewDecoder(r.Body).Decode(&d)
+			delivered = append(delivered, d)
+		}))
+		defer flaky.Close()
+		service.CreateTenant(svc.Tenant{ID: "payments", DeliveryTargets: []string{flaky.URL}})
+		payments.SaveTxs(map[string][]svc.Transaction{alice: {{Kind: svc.KindTransaction, Hash: hash(0xa2), From: address(alice), To: recipient(bob), BlockNumber: 801}}})
+		now = time.Now()
+		if n, _ := service.DeliverPending(now); n != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould report failed deliveries as pending : Got %d", Failed, testID, n)
+		}
+		if n, _ := service.DeliverPending(now.Add(time.Second)); n != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould wait before retrying : Got %d", Failed, testID, n)
+		}
+		if n, _ := service.DeliverPending(now.Add(txparser.DeliveryRetryDelay)); n != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould retry failed deliveries : Got %d", Failed, testID, n)
+		}
+		lock.Lock()
+		if len(delivered) != 2 || delivered[1].Transactions[0].Hash != hash(0xa2) {
+			t.Fatalf("\t%s\tTest %d:\tShould deliver the retried entries : Got %+v", Failed, testID, delivered)
+		}
+		lock.Unlock()
+
+		if !service.DeleteTenant("treasury") || len(service.ListTenants()) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould delete the tenant : Got %+v", Failed, testID, service.ListTenants())
+		}
+		if _, ok := service.Tenant("treasury"); ok {
+			t.Fatalf("\t%s\tTest %d:\tShould not serve deleted tenants", Failed, testID)
+		}
+
+		// A store written before the tenant index existed.
+		legacy := inmemorydb.New()
+		legacy.Put("tenants:acme", [][]byte{[]byte(`{"id":"acme"}`)})
+		service = txparser.NewWithStore(context.Background(), legacy, "http://127.0.0.1:0", 700)
+		service.CreateTenant(svc.Tenant{ID: "globex"})
+		if got := service.ListTenants(); len(got) != 2 || got[0].ID != "acme" || got[1].ID != "globex" {
+			t.Fatalf("\t%s\tTest %d:\tShould index the tenants of an earlier store : Got %+v", Failed, testID, got)
+		}
+		t.Logf("\t%s\tTest %d:\tShould index isolated tenants from a single scan", Success, testID)
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		testID := 13
+		node := newFakeNode(t, ethclient.Block{
+			Number:    hexInt(900),
+			Timestamp: hexInt(1760000000),
+			Transactions: []ethclient.Transaction{
+				{Type: "0x2", Hash: hexHash(0xb0), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"},
+			},
+		})
+
+		service := txparser.New(context.Background(), node.URL, 899)
+		service.Subscribe(alice)
+		service.Run()
+
+		var buf bytes.Buffer
+		if _, err := service.Export(&buf); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould export the state : %v", Failed, testID, err)
+		}
+
+		restored := txparser.New(context.Background(), node.URL, 0)
+		restored.Subscribe(bob)
+		if _, err := restored.Import(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould import the state : %v", Failed, testID, err)
+		}
+		if block := restored.GetCurrentBlock(); block != 900 {
+			t.Fatalf("\t%s\tTest %d:\tShould resume from the checkpoint : Got %d", Failed, testID, block)
+		}
+		if _, ok := restored.GetSubscription(alice); !ok || len(restored.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould restore subscriptions and histories : Got %+v", Failed, testID, restored.GetTransactions(alice))
+		}
+		if _, ok := restored.GetSubscription(bob); ok {
+			t.Fatalf("\t%s\tTest %d:\tShould replace the previous state", Failed, testID)
+		}
+
+		// A block saved during an export is wholly in the snapshot.
+		node.AddBlock(ethclient.Block{
+			Number:       hexInt(901),
+			Timestamp:    hexInt(1760000012),
+			Transactions: []ethclient.Transaction{{Type: "0x2", Hash: hexHash(0xb1), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"}},
+		})
+		store := &failingStore{Database: inmemorydb.New(), address: alice}
+		scanning := txparser.NewWithStore(context.Background(), store, node.URL, 900)
+		scanning.Subscribe(alice)
+		saving := make(chan struct{})
+		var once sync.Once
+		store.saving = func() {
+			once.Do(func() { close(saving) })
+			time.Sleep(50 * time.Millisecond)
+		}
+		scanned := make(chan struct{})
+		go func() {
+			scanning.Run()
+			close(scanned)
+		}()
+		<-saving
+		var during bytes.Buffer
+		if _, err := scanning.Export(&during); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould export the state while scanning : %v", Failed, testID, err)
+		}
+		<-scanned
+		imported := txparser.New(context.Background(), node.URL, 0)
+		if _, err := imported.Import(bytes.NewReader(during.Bytes())); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould import the state exported while scanning : %v", Failed, testID, err)
+		}
+		if block, stats := imported.GetCurrentBlock(), imported.GetStats(alice); block != 901 || len(imported.GetTransactions(alice)) != 1 || stats.Transactions != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould export a consistent state : Got block %d, %+v", Failed, testID, block, stats)
+		}
+		t.Logf("\t%s\tTest %d:\tShould restore the state and checkpoint from a snapshot", Success, testID)
+	})
+
+	t.Run("Sharding", func(t *testing.T) {
+		testID := 14
+		var blocks []ethclient.Block
+		for i := 1000; i < 1020; i++ {
+			blocks = append(blocks, ethclient.Block{
+				Number:    hexInt(i),
+				Timestamp: hexInt(1760000000 + i),
+				Transactions: []ethclient.Transaction{
+					{Type: "0x2", Hash: hexHash(i), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"},
+				},
+			})
+		}
+		node := newFakeNode(t, blocks...)
+		store := &listingStore{Database: inmemorydb.New()}
+
+		var workers []*txparser.Service
+		for _, id := range []string{"w1", "w2", "w3"} {
+			workers = append(workers, txparser.NewWithStore(context.Background(), store, node.URL, 999, txparser.WithSharding(id, 4, time.Minute)))
+		}
+		workers[0].Subscribe(alice)
+
+		scanned := make(map[int]int)
+		lists := -1
+		for idle := 0; idle < len(workers); {
+			if lists < 0 && len(scanned) > 0 {
+				lists = store.Lists()
+			}
+			idle = 0
+			for _, w := range workers {
+				block, err := w.Run()
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould scan the claimed range : %v", Failed, testID, err)
+				}
+				if block == 0 {
+					idle++
+					continue
+				}
+				scanned[block]++
+			}
+		}
+		if len(scanned) != 20 {
+			t.Fatalf("\t%s\tTest %d:\tShould scan every block : Got %d", Failed, testID, len(scanned))
+		}
+		for block, n := range scanned {
+			if n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould scan every block once : Got %d scans of %d", Failed, testID, n, block)
+			}
+		}
+		if got := workers[2].GetTransactions(alice); len(got) != 20 {
+			t.Fatalf("\t%s\tTest %d:\tShould share the histories between workers : Got %d", Failed, testID, len(got))
+		}
+		if got := store.Lists(); got != lists {
+			t.Fatalf("\t%s\tTest %d:\tShould find the block ranges without listing the store : Got %d listings", Failed, testID, got-lists)
+		}
+		keys, _ := store.List()
+		for _, key := range keys {
+			if strings.HasPrefix(key, "shard:range:") {
+				t.Fatalf("\t%s\tTest %d:\tShould prune the block ranges below the checkpoint : Got %s", Failed, testID, key)
+			}
+		}
+		reader := txparser.NewWithStore(context.Background(), store, node.URL, 0, txparser.WithLeaderElection("reader", time.Minute))
+		if block := reader.GetCurrentBlock(); block != 1019 {
+			t.Fatalf("\t%s\tTest %d:\tShould move the checkpoint past every scanned block : Got %d", Failed, testID, block)
+		}
+		if node.Calls(ethclient.GetBalance) == 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould reconcile the balances as the checkpoint moves", Failed, testID)
+		}
+
+		// Workers saving entries concurrently share the rollups of every
+		// address, and the history of the address saved by all of them.
+		var wg sync.WaitGroup
+		for i, owner := range []string{alice, bob, token} {
+			wg.Add(1)
+			go func(w *txparser.Service, i int, owner string) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x2000 + i*0x100 + j), From: address(owner), BlockNumber: svc.Uint64(1100 + j), Timestamp: 1760001100}
+					shared := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x3000 + j), From: address(token), To: recipient(alice), BlockNumber: svc.Uint64(1100 + j), TransactionIndex: 1, Timestamp: 1760001100}
+					w.SaveTxs(map[string][]svc.Transaction{owner: {tx}})
+					w.SaveTxs(map[string][]svc.Transaction{alice: {shared}})
+				}
+			}(workers[i], i, owner)
+		}
+		wg.Wait()
+		day := time.Unix(1760001100, 0)
+		if total := workers[0].GetTotalRollups(svc.Daily, day, day); len(total) != 1 || total[0].Count != 100 {
+			t.Fatalf("\t%s\tTest %d:\tShould count the entries saved concurrently : Got %+v", Failed, testID, total)
+		}
+		if stats := workers[1].GetStats(alice); stats.Transactions != 60 || stats.Counterparties != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould count the entries saved by several workers once : Got %+v", Failed, testID, stats)
+		}
+		history := workers[2].GetTransactions(alice)
+		if len(history) != 60 {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the entries saved concurrently : Got %d", Failed, testID, len(history))
+		}
+		for i := 1; i < len(history); i++ {
+			if history[i].Position().Less(history[i-1].Position()) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the history ordered : Got %+v before %+v", Failed, testID, history[i-1].Position(), history[i].Position())
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould split block ranges between workers", Success, testID)
+	})
+
+	t.Run("ShardTakeover", func(t *testing.T) {
+		testID := 15
+		var blocks []ethclient.Block
+		for i := 1100; i < 1104; i++ {
+			blocks = append(blocks, ethclient.Block{Number: hexInt(i), Timestamp: hexInt(1760000000 + i)})
+		}
+		node := newFakeNode(t, blocks...)
+		store := inmemorydb.New()
+
+		lease := 50 * time.Millisecond
+		w1 := txparser.NewWithStore(context.Background(), store, node.URL, 1099, txparser.WithSharding("w1", 4, lease))
+		w2 := txparser.NewWithStore(context.Background(), store, node.URL, 1099, txparser.WithSharding("w2", 4, lease))
+		if block, _ := w1.Run(); block != 1100 {
+			t.Fatalf("\t%s\tTest %d:\tShould claim the first range : Got %d", Failed, testID, block)
+		}
+		if block, _ := w2.Run(); block != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not scan a leased range : Got %d", Failed, testID, block)
+		}
+
+		// w1 stops, its lease expires.
+		time.Sleep(2 * lease)
+		for want := 1101; want < 1104; want++ {
+			if block, _ := w2.Run(); block != want {
+				t.Fatalf("\t%s\tTest %d:\tShould take over the expired range : Got %d, want %d", Failed, testID, block, want)
+			}
+		}
+		if block, err := w1.Run(); err != nil || block != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not resume a range taken over and pruned : Got %d, %v", Failed, testID, block, err)
+		}
+
+		transfer := ethclient.Block{
+			Number:       hexInt(1104),
+			Timestamp:    hexInt(1760001104),
+			Transactions: []ethclient.Transaction{{Hash: hexHash(1104), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"}},
+		}
+		node.AddBlock(transfer)
+		other := newFakeNode(t, append(blocks, transfer)...)
+
+		// A worker failing to save a block scans it again.
+		failing := &failingStore{Database: inmemorydb.New(), address: alice, fail: true}
+		w3 := txparser.NewWithStore(context.Background(), failing, other.URL, 1103, txparser.WithSharding("w3", 4, time.Minute))
+		w3.Subscribe(alice)
+		if block, err := w3.Run(); err == nil || block != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould report the block which was not saved : Got %d, %v", Failed, testID, block, err)
+		}
+		failing.fail = false
+		if block, err := w3.Run(); err != nil || block != 1104 || len(w3.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould scan the block again : Got %d, %v", Failed, testID, block, err)
+		}
+
+		// The lease of w4 expires while it scans a block, and w5 takes the
+		// range over meanwhile: w4 leaves the block to w5.
+		shared := inmemorydb.New()
+		w4 := txparser.NewWithStore(context.Background(), shared, node.URL, 1103, txparser.WithSharding("w4", 4, lease))
+		w5 := txparser.NewWithStore(context.Background(), shared, other.URL, 1103, txparser.WithSharding("w5", 4, lease))
+		w4.Subscribe(alice)
+		fetch := node.methods[ethclient.GetBlockByNumber]
+		taken := 0
+		node.Handle(ethclient.GetBlockByNumber, func(params []json.RawMessage) (interface{}, error) {
+			time.Sleep(2 * lease)
+			taken, _ = w5.Run()
+			return fetch(params)
+		})
+		if block, err := w4.Run(); !errors.Is(err, txparser.ErrRangeLost) || block != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not save a block once the range is lost : Got %d, %v", Failed, testID, block, err)
+		}
+		if taken != 1104 || len(w4.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould leave the block to the new owner : Got %d, %d entries", Failed, testID, taken, len(w4.GetTransactions(alice)))
+		}
+		t.Logf("\t%s\tTest %d:\tShould take over the range of a stopped worker", Success, testID)
+	})
+
+	t.Run("LeaderElection", func(t *testing.T) {
+		testID := 16
+		var blocks []ethclient.Block
+		for i := 1200; i < 1204; i++ {
+			blocks = append(blocks, ethclient.Block{
+				Number:       hexInt(i),
+				Timestamp:    hexInt(1760000000 + i),
+				Transactions: []ethclient.Transaction{{Type: "0x2", Hash: hexHash(i), From: alice, To: bob, Value: "0x1", GasPrice: "0x1"}},
+			})
+		}
+		node := newFakeNode(t, blocks...)
+		store := inmemorydb.New()
+
+		lease := 50 * time.Millisecond
+		active := txparser.NewWithStore(context.Background(), store, node.URL, 1199, txparser.WithLeaderElection("a", lease))
+		standby := txparser.NewWithStore(context.Background(), store, node.URL, 1199, txparser.WithLeaderElection("b", lease))
+		if !active.Campaign() || standby.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould elect a single leader", Failed, testID)
+		}
+
+		active.Subscribe(alice)
+		active.Run()
+		active.Run()
+		if block := standby.GetCurrentBlock(); block != 1201 || len(standby.GetTransactions(alice)) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould serve reads from the standby : Got block %d", Failed, testID, block)
+		}
+		if block, err := standby.Run(); block != 0 || err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould not scan from the standby : Got %d, %v", Failed, testID, block, err)
+		}
+
+		// The leader stops renewing its lease while scanning a block.
+		time.Sleep(2 * lease)
+		if !standby.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould elect the standby once the lease expired", Failed, testID)
+		}
+		if _, err := active.Run(); !errors.Is(err, txparser.ErrNotLeader) || len(active.GetTransactions(alice)) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould not save blocks once the lease is lost : Got %v", Failed, testID, err)
+		}
+		if active.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the new leader", Failed, testID)
+		}
+		if block, _ := standby.Run(); block != 1202 {
+			t.Fatalf("\t%s\tTest %d:\tShould resume from the checkpoint of the previous leader : Got %d", Failed, testID, block)
+		}
+
+		standby.Resign()
+		if !active.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould take over right away once the leader resigned", Failed, testID)
+		}
+		if block, _ := active.Run(); block != 1203 || len(active.GetTransactions(alice)) != 4 {
+			t.Fatalf("\t%s\tTest %d:\tShould not write blocks twice : Got block %d", Failed, testID, block)
+		}
+
+		// Copies in separate processes share their state and the lease
+		// through files, as the CLI does with -store and -lockfile.
+		dir := t.TempDir()
+		leases := filepath.Join(dir, "leases.json")
+		open := func(name string) *txparser.Service {
+			return txparser.NewWithStore(context.Background(), filedb.New(filepath.Join(dir, "store.json")), node.URL, 1199, txparser.WithLeaderElection(name, time.Minute), txparser.WithLeaseStore(filedb.New(leases)))
+		}
+		first, second := open("a"), open("b")
+		if !first.Campaign() || second.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould elect a single leader through the lease file", Failed, testID)
+		}
+		first.Subscribe(alice)
+		first.Run()
+		first.Campaign()
+		if block := second.GetCurrentBlock(); block != 1200 || len(second.GetTransactions(alice)) != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould serve the data of the leader from the shared store : Got block %d", Failed, testID, block)
+		}
+		first.Resign()
+		if !second.Campaign() {
+			t.Fatalf("\t%s\tTest %d:\tShould take over through the lease file", Failed, testID)
+		}
+		if block, _ := second.Run(); block != 1201 || len(second.GetTransactions(alice)) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould resume from the checkpoint of the previous leader and keep its data : Got %d", Failed, testID, block)
+		}
+		t.Logf("\t%s\tTest %d:\tShould fail over to a standby", Success, testID)
+	})
+
+	t.Run("ParserV2", func(t *testing.T) {
+		testID := 17
+		store := inmemorydb.New()
+		service := txparser.NewWithStore(context.Background(), store, "http://127.0.0.1:0", 1300)
+		parser := service.V2()
+		ctx := context.Background()
+
+		if err := parser.Subscribe(ctx, "0x1234"); !errors.Is(err, svc.ErrInvalidAddress) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed addresses : Got %v", Failed, testID, err)
+		}
+		if _, err := parser.GetTransactions(ctx, alice); !errors.Is(err, svc.ErrNotSubscribed) {
+			t.Fatalf("\t%s\tTest %d:\tShould report unknown addresses : Got %v", Failed, testID, err)
+		}
+		if err := parser.Subscribe(ctx, alice); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould subscribe the address : %v", Failed, testID, err)
+		}
+		if txs, err := parser.GetTransactions(ctx, alice); err != nil || len(txs) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould return an empty history : Got %v, %v", Failed, testID, txs, err)
+		}
+		if total, err := parser.GetFees(ctx, svc.Checksummed(alice)); err != nil || total.Sign() != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould return the fees of the address in any case : Got %v, %v", Failed, testID, total, err)
+		}
+		if _, err := parser.GetFees(ctx, "0x1234"); !errors.Is(err, svc.ErrInvalidAddress) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed addresses when summing fees : Got %v", Failed, testID, err)
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := parser.GetBalance(canceled, alice); !errors.Is(err, context.Canceled) {
+			t.Fatalf("\t%s\tTest %d:\tShould honor the context : Got %v", Failed, testID, err)
+		}
+
+		store.Close()
+		if _, err := parser.GetTransactions(ctx, alice); !errors.Is(err, svc.ErrStoreUnavailable) {
+			t.Fatalf("\t%s\tTest %d:\tShould report an unavailable store : Got %v", Failed, testID, err)
+		}
+		if service.GetTransactions(alice) != nil || service.Subscribe(bob) {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the v1 adapter behavior on failure", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould report typed errors from the v2 API", Success, testID)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		testID := 18
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1400)
+		service.Subscribe(alice)
+
+		entry := func(block, index int) svc.Transaction {
+			return svc.Transaction{Kind: svc.KindTransaction, Hash: hash(block<<8 | index), From: address(alice), To: recipient(bob), BlockNumber: svc.Uint64(block), TransactionIndex: svc.Uint64(index)}
+		}
+		// Blocks saved out of order, as when they are rescanned or sharded.
+		service.SaveTxs(map[string][]svc.Transaction{alice: {entry(1403, 1), entry(1403, 0)}})
+		service.SaveTxs(map[string][]svc.Transaction{alice: {entry(1401, 2), entry(1401, 5)}})
+		service.SaveTxs(map[string][]svc.Transaction{alice: {entry(1402, 0)}})
+
+		var hashes []svc.Hash
+		cursor := ""
+		for pages := 0; ; pages++ {
+			page, err := service.V2().ListTransactions(context.Background(), alice, svc.WithLimit(2), svc.WithCursor(cursor))
+			if err != nil || pages > 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the next page : %v", Failed, testID, err)
+			}
+			for _, tx := range page.Transactions {
+				hashes = append(hashes, tx.Hash)
+			}
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		want := []svc.Hash{hash(0x57902), hash(0x57905), hash(0x57a00), hash(0x57b00), hash(0x57b01)}
+		if got := fmt.Sprint(hashes); got != fmt.Sprint(want) {
+			t.Fatalf("\t%s\tTest %d:\tShould page through the history in ascending order : Got %s", Failed, testID, got)
+		}
+
+		page, err := service.V2().ListTransactions(context.Background(), alice, svc.WithOrder(svc.Descending), svc.WithLimit(2), svc.ToBlock(1402))
+		if err != nil || len(page.Transactions) != 2 || page.Transactions[0].Hash != hash(0x57a00) || page.Transactions[1].Hash != hash(0x57905) {
+			t.Fatalf("\t%s\tTest %d:\tShould list in descending order : Got %+v, %v", Failed, testID, page, err)
+		}
+		page, err = service.V2().ListTransactions(context.Background(), alice, svc.WithOrder(svc.Descending), svc.WithCursor(page.NextCursor), svc.ToBlock(1402))
+		if err != nil || len(page.Transactions) != 1 || page.Transactions[0].Hash != hash(0x57902) || page.NextCursor != "" {
+			t.Fatalf("\t%s\tTest %d:\tShould resume the descending listing : Got %+v, %v", Failed, testID, page, err)
+		}
+
+		if _, err := service.V2().ListTransactions(context.Background(), alice, svc.WithCursor("!")); !errors.Is(err, svc.ErrInvalidCursor) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed cursors : Got %v", Failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould page through ordered histories", Success, testID)
+	})
+
+	t.Run("QueryFilters", func(t *testing.T) {
+		testID := 19
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1500)
+		service.Subscribe(alice)
+
+		eth := big.NewInt(1e18)
+		entries := service.Pull([]svc.Transaction{
+			{Kind: svc.KindTransaction, Hash: hash(0xc0), From: address(bob), To: recipient(alice), Value: svc.NewBig(new(big.Int).Mul(eth, big.NewInt(2))), BlockNumber: 1501, Receipt: &svc.Receipt{Status: 1}},
+			{Kind: svc.KindTransaction, Hash: hash(0xc1), From: address(token), To: recipient(alice), Value: svc.NewBig(new(big.Int).Mul(eth, big.NewInt(3))), BlockNumber: 1502, Receipt: &svc.Receipt{Status: 1}},
+			{Kind: svc.KindTransaction, Hash: hash(0xc2), From: address(alice), To: recipient(token), Value: quantity(0), BlockNumber: 1503, Receipt: &svc.Receipt{Status: 0}, Input: data("0xa9059cbb" + word(bob[2:]) + word("1"))},
+			{Kind: svc.KindWithdrawal, To: recipient(alice), Value: svc.NewBig(eth), BlockNumber: 1504, Withdrawal: &svc.Withdrawal{Index: 1}},
+		})
+		service.SaveTxs(entries)
+
+		hashes := func(opts ...svc.QueryOption) string {
+			var got []string
+			for _, tx := range service.GetTransactions(alice, opts...) {
+				got = append(got, tx.ID())
+			}
+			return strings.Join(got, ",")
+		}
+		id := func(n int) string { return hexHash(n) + ":transaction:0" }
+		cases := []struct {
+			name string
+			opts []svc.QueryOption
+			want string
+		}{
+			{"incoming from counterparty above 1 ETH", []svc.QueryOption{svc.WithDirection(svc.Incoming), svc.WithCounterparty(bob), svc.MinValue(eth), svc.FromBlock(1501), svc.ToBlock(1503)}, id(0xc0)},
+			{"outgoing", []svc.QueryOption{svc.WithDirection(svc.Outgoing)}, id(0xc2)},
+			{"value bounds", []svc.QueryOption{svc.MinValue(eth), svc.MaxValue(new(big.Int).Mul(eth, big.NewInt(2)))}, id(0xc0) + ",withdrawal:1"},
+			{"kind", []svc.QueryOption{svc.WithKinds(svc.KindWithdrawal)}, "withdrawal:1"},
+			{"status", []svc.QueryOption{svc.WithStatus(svc.StatusFailed)}, id(0xc2)},
+			{"method selector", []svc.QueryOption{svc.WithMethod("0xA9059CBB")}, id(0xc2)},
+			{"method name", []svc.QueryOption{svc.WithMethod("transfer"), svc.WithStatus(svc.StatusFailed)}, id(0xc2)},
+			{"query object", []svc.QueryOption{svc.WithQuery(svc.Query{Direction: svc.Incoming, Kinds: []string{svc.KindTransaction}, Order: svc.Descending})}, id(0xc1) + "," + id(0xc0)},
+		}
+		for _, c := range cases {
+			if got := hashes(c.opts...); got != c.want {
+				t.Fatalf("\t%s\tTest %d:\tShould filter by %s : Got %s, want %s", Failed, testID, c.name, got, c.want)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould filter transactions with structured queries", Success, testID)
+	})
+
+	t.Run("LookupByHash", func(t *testing.T) {
+		testID := 20
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1600)
+		service.Subscribe(alice)
+		service.Subscribe(bob)
+
+		tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0xd0), From: address(alice), To: recipient(bob), Value: quantity(1), BlockNumber: 1601}
+		other := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0xd1), From: address(alice), To: recipient(token), Value: quantity(1), BlockNumber: 1602}
+		service.SaveTxs(service.Pull([]svc.Transaction{tx, other}))
+
+		lookup, ok := service.GetTransaction(strings.ToUpper(hexHash(0xd0)))
+		if !ok || lookup.Transaction.Hash != hash(0xd0) || len(lookup.Addresses) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould find the transaction and the addresses it touched : Got %+v", Failed, testID, lookup)
+		}
+		if _, err := service.V2().GetTransaction(context.Background(), hexHash(0xd9)); !errors.Is(err, svc.ErrTransactionNotFound) {
+			t.Fatalf("\t%s\tTest %d:\tShould report unknown hashes : Got %v", Failed, testID, err)
+		}
+		if _, err := service.V2().GetTransaction(context.Background(), "0xd0"); !errors.Is(err, svc.ErrInvalidHash) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject malformed hashes : Got %v", Failed, testID, err)
+		}
+
+		service.Unsubscribe(bob, svc.UnsubscribeOptions{Retention: svc.PurgeHistory})
+		if lookup, _ := service.GetTransaction(hexHash(0xd0)); len(lookup.Addresses) != 1 || lookup.Addresses[0] != svc.Checksummed(alice) {
+			t.Fatalf("\t%s\tTest %d:\tShould drop purged addresses from the index : Got %+v", Failed, testID, lookup)
+		}
+		t.Logf("\t%s\tTest %d:\tShould look transactions up by hash", Success, testID)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		testID := 21
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1700)
+		service.Subscribe(alice)
+
+		failed := &svc.Receipt{Status: 0}
+		txs := []svc.Transaction{
+			{Kind: svc.KindTransaction, Hash: hash(0xe0), From: address(bob), To: recipient(alice), Value: quantity(100), BlockNumber: 1703},
+			{Kind: svc.KindTransaction, Hash: hash(0xe1), From: address(alice), To: recipient(token), Value: quantity(30), Fee: quantity(2), BlockNumber: 1705},
+			{Kind: svc.KindTransaction, Hash: hash(0xe2), From: address(alice), To: recipient(bob), Value: quantity(50), Fee: quantity(3), Receipt: failed, BlockNumber: 1701},
+		}
+		service.SaveTxs(service.Pull(txs))
+		service.SaveTxs(service.Pull(txs[:1]))
+
+		stats := service.GetStats(alice)
+		if stats.Transactions != 3 || stats.Incoming != 1 || stats.Outgoing != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould count the saved entries once : Got %+v", Failed, testID, stats)
+		}
+		if stats.ValueIn.Int64() != 100 || stats.ValueOut.Int64() != 30 || stats.Fees.Int64() != 5 {
+			t.Fatalf("\t%s\tTest %d:\tShould sum values and fees : Got in %v, out %v, fees %v", Failed, testID, stats.ValueIn, stats.ValueOut, stats.Fees)
+		}
+		if stats.FirstBlock != 1701 || stats.LastBlock != 1705 || stats.Counterparties != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould track blocks and distinct counterparties : Got %+v", Failed, testID, stats)
+		}
+
+		if _, err := service.DedupeTxs(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould rebuild the statistics : %v", Failed, testID, err)
+		}
+		if rebuilt := service.GetStats(alice); rebuilt.Transactions != 3 || rebuilt.Counterparties != 2 || rebuilt.Fees.Int64() != 5 {
+			t.Fatalf("\t%s\tTest %d:\tShould rebuild the same statistics : Got %+v", Failed, testID, rebuilt)
+		}
+		t.Logf("\t%s\tTest %d:\tShould maintain per-address statistics", Success, testID)
+	})
+
+	t.Run("Rollups", func(t *testing.T) {
+		testID := 22
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1800)
+		service.Subscribe(alice)
+		service.Subscribe(bob)
+
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		at := func(d time.Duration) svc.Uint64 { return svc.Uint64(day.Add(d).Unix()) }
+		txs := []svc.Transaction{
+			{Kind: svc.KindTransaction, Hash: hash(0xf0), From: address(alice), To: recipient(bob), Value: quantity(10), Fee: quantity(1), BlockNumber: 1801, Timestamp: at(10 * time.Minute)},
+			{Kind: svc.KindTransaction, Hash: hash(0xf1), From: address(alice), To: recipient(token), Value: quantity(20), Fee: quantity(2), BlockNumber: 1802, Timestamp: at(150 * time.Minute)},
+			{Kind: svc.KindTransaction, Hash: hash(0xf2), From: address(bob), To: recipient(alice), Value: quantity(5), Fee: quantity(1), BlockNumber: 1803, Timestamp: at(26 * time.Hour)},
+		}
+		service.SaveTxs(service.Pull(txs))
+
+		hourly := service.GetRollups(alice, svc.Hourly, day, day.Add(3*time.Hour))
+		if len(hourly) != 4 || hourly[0].Count != 1 || hourly[1].Count != 0 || hourly[2].Count != 1 || hourly[2].ValueOut.Int64() != 20 {
+			t.Fatalf("\t%s\tTest %d:\tShould roll up the address per hour, empty buckets included : Got %+v", Failed, testID, hourly)
+		}
+
+		daily := service.GetRollups(alice, svc.Daily, day, day.Add(24*time.Hour))
+		if len(daily) != 2 || daily[0].Count != 2 || daily[0].ValueOut.Int64() != 30 || daily[0].Fees.Int64() != 3 || daily[1].ValueIn.Int64() != 5 {
+			t.Fatalf("\t%s\tTest %d:\tShould roll up the address per day : Got %+v", Failed, testID, daily)
+		}
+
+		total := service.GetTotalRollups(svc.Daily, day, day)
+		if len(total) != 1 || total[0].Count != 2 || total[0].ValueIn.Int64() != 10 || total[0].ValueOut.Int64() != 30 {
+			t.Fatalf("\t%s\tTest %d:\tShould roll up every address, counting entries between them once : Got %+v", Failed, testID, total)
+		}
+
+		if _, err := service.DedupeTxs(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould rebuild the rollups : %v", Failed, testID, err)
+		}
+		if rebuilt := service.GetRollups(alice, svc.Daily, day, day); len(rebuilt) != 1 || rebuilt[0].Count != 2 || rebuilt[0].ValueOut.Int64() != 30 {
+			t.Fatalf("\t%s\tTest %d:\tShould rebuild the rollups of the address : Got %+v", Failed, testID, rebuilt)
+		}
+		if kept := service.GetTotalRollups(svc.Daily, day, day); len(kept) != 1 || kept[0].Count != 2 || kept[0].ValueOut.Int64() != 30 {
+			t.Fatalf("\t%s\tTest %d:\tShould keep the rollups of every address : Got %+v", Failed, testID, kept)
+		}
+
+		if _, err := service.V2().GetTotalRollups(context.Background(), svc.Hourly, day, day.Add(-time.Hour)); !errors.Is(err, svc.ErrInvalidRange) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject empty ranges : Got %v", Failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould maintain time-bucketed rollups", Success, testID)
+	})
+
+	t.Run("SubscribeMany", func(t *testing.T) {
+		testID := 23
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 1900)
+
+		results := service.SubscribeMany([]svc.Subscription{
+			{Address: alice, Labels: []string{"hot"}},
+			{Address: "0x1234"},
+			{Address: strings.ToUpper(alice[2:])},
+			{Address: "0x" + strings.ToUpper(alice[2:])},
+			{Address: bob},
+		})
+		if len(results) != 5 || results[0].Err != nil || results[4].Err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould subscribe the valid entries : Got %+v", Failed, testID, results)
+		}
+		if !errors.Is(results[1].Err, svc.ErrInvalidAddress) || !errors.Is(results[2].Err, svc.ErrInvalidAddress) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject invalid addresses : Got %v, %v", Failed, testID, results[1].Err, results[2].Err)
+		}
+		if !errors.Is(results[3].Err, svc.ErrDuplicateSubscription) {
+			t.Fatalf("\t%s\tTest %d:\tShould reject duplicated addresses : Got %v", Failed, testID, results[3].Err)
+		}
+
+		subs := service.ListSubscriptions(svc.SubscriptionFilter{})
+		if len(subs) != 2 || subs[0].Address != svc.Checksummed(alice) || !subs[0].HasLabel("hot") {
+			t.Fatalf("\t%s\tTest %d:\tShould list the subscribed entries : Got %+v", Failed, testID, subs)
+		}
+		t.Logf("\t%s\tTest %d:\tShould subscribe addresses in bulk", Success, testID)
+	})
+
+	t.Run("ChecksummedAddresses", func(t *testing.T) {
+		testID := 24
+		for _, want := range []string{
+			"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+			"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+			"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+			"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+		} {
+			a, err := svc.ParseAddress(strings.ToLower(want))
+			if err != nil || a.Hex() != want {
+				t.Fatalf("\t%s\tTest %d:\tShould render the EIP-55 checksum : Got %s, %v, want %s", Failed, testID, a, err, want)
+			}
+			if _, err := svc.ParseAddress(want); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a valid checksum : %v", Failed, testID, err)
+			}
+			i := strings.IndexAny(want[2:], "abcdef") + 2
+			bad := want[:i] + strings.ToUpper(want[i:i+1]) + want[i+1:]
+			if _, err := svc.ParseAddress(bad); !errors.Is(err, svc.ErrInvalidAddress) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a bad checksum %s : Got %v", Failed, testID, bad, err)
+			}
+		}
+
+		service := txparser.New(context.Background(), "http://127.0.0.1:0", 2000)
+		checksummed := svc.Checksummed(alice)
+		if service.Subscribe("0x388c818CA8B9251b393131c08a736a67ccb19297") {
+			t.Fatalf("\t%s\tTest %d:\tShould refuse addresses with a bad checksum", Failed, testID)
+		}
+		if !service.Subscribe(checksummed) {
+			t.Fatalf("\t%s\tTest %d:\tShould subscribe checksummed addresses", Failed, testID)
+		}
+
+		tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0xa0), From: address(bob), To: recipient(alice), Value: quantity(1), BlockNumber: 2001}
+		service.SaveTxs(service.Pull([]svc.Transaction{tx}))
+		got := service.GetTransactions(strings.ToLower(alice))
+		if text, _ := json.Marshal(got); len(got) != 1 || !strings.Contains(string(text), `"to":"`+checksummed+`"`) {
+			t.Fatalf("\t%s\tTest %d:\tShould match addresses in any case and render them checksummed : Got %+v", Failed, testID, got)
+		}
+		if sub, ok := service.GetSubscription(strings.ToLower(alice)); !ok || sub.Address != checksummed {
+			t.Fatalf("\t%s\tTest %d:\tShould render subscriptions checksummed : Got %+v", Failed, testID, sub)
+		}
+		t.Logf("\t%s\tTest %d:\tShould validate and render EIP-55 addresses", Success, testID)
+	})
+
+	t.Run("TypedJSON", func(t *testing.T) {
+		testID := 25
+		tx := svc.Transaction{Kind: svc.KindTransaction, Hash: hash(0x1b), From: address(alice), To: recipient(bob), Value: quantity(1e9), BlockNumber: 2101, Input: data("0xa9059cbb"), BalanceAfter: quantity(-16)}
+		text, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould encode the transaction : %v", Failed, testID, err)
+		}
+		for _, want := range []string{`"hash":"` + hexHash(0x1b) + `"`, `"blockNumber":"0x835"`, `"value":"0x3b9aca00"`, `"input":"0xa9059cbb"`, `"to":"` + svc.Checksummed(bob) + `"`, `"balanceAfter":"-0x10"`} {
+			if !strings.Contains(string(text), want) {
+				t.Fatalf("\t%s\tTest %d:\tShould encode %s : Got %s", Failed, testID, want, text)
+			}
+		}
+		var decoded svc.Transaction
+		if err := json.Unmarshal(text, &decoded); err != nil || decoded.ID() != tx.ID() || decoded.BalanceAfter.ToInt().Int64() != -16 || decoded.To.Canonical() != bob {
+			t.Fatalf("\t%s\tTest %d:\tShould decode its own encoding : Got %+v, %v", Failed, testID, decoded, err)
+		}
+		if err := json.Unmarshal([]byte(`{"blockNumber":2101,"value":1000000000,"hash":""}`), &decoded); err != nil || decoded.BlockNumber != 2101 || decoded.Value.ToInt().Int64() != 1e9 {
+			t.Fatalf("\t%s\tTest %d:\tShould decode histories stored in decimal : Got %+v, %v", Failed, testID, decoded, err)
+		}
+		for _, malformed := range []string{`{"value":"0xzz"}`, `{"value":"0x01"}`, `{"blockNumber":"0x00"}`, `{"value":"0x"}`} {
+			if err := json.Unmarshal([]byte(malformed), &decoded); !errors.Is(err, svc.ErrInvalidHex) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject malformed quantity %s : Got %v", Failed, testID, malformed, err)
+			}
+		}
+		// Contract creations were stored by earlier versions with an empty
+		// recipient.
+		for _, creation := range []string{`{"to":""}`, `{"to":null}`, `{}`} {
+			decoded = svc.Transaction{}
+			if err := json.Unmarshal([]byte(creation), &decoded); err != nil || decoded.To != nil || decoded.Recipient() != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould decode %s as a contract creation : Got %v, %v", Failed, testID, creation, decoded.To, err)
+			}
+		}
+		legacy := txparser.New(context.Background(), "http://127.0.0.1:0", 2100)
+		legacy.Subscribe(alice)
+		var creation svc.Transaction
+		json.Unmarshal([]byte(`{"kind":"transaction","hash":"`+hexHash(0x1e)+`","from":"`+alice+`","to":"","blockNumber":"0x835","value":"0x0"}`), &creation)
+		legacy.SaveTxs(legacy.Pull([]svc.Transaction{creation}))
+		if got := legacy.GetTransactions(alice, svc.WithCounterparty("0x0000000000000000000000000000000000000000")); len(got) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not match contract creations as transfers to the zero address : Got %+v", Failed, testID, got)
+		}
+		if stats := legacy.GetStats(alice); stats.Transactions != 1 || stats.Counterparties != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould not count the zero address as the counterparty of contract creations : Got %+v", Failed, testID, stats)
+		}
+		if err := json.Unmarshal([]byte(`{"value":"0x0","blockNumber":"0x10"}`), &decoded); err != nil || decoded.Value.ToInt().Sign() != 0 || decoded.BlockNumber != 16 {
+			t.Fatalf("\t%s\tTest %d:\tShould decode quantities without leading zeros : Got %+v, %v", Failed, testID, decoded, err)
+		}
+
+		node := newFakeNode(t, ethclient.Block{
+			Number:       hexInt(2101),
+			Timestamp:    hexInt(1760000000),
+			Transactions: []ethclient.Transaction{{Hash: "0x1b", From: alice, To: bob, Value: "0x1"}},
+		})
+		service := txparser.New(context.Background(), node.URL, 2100)
+		service.Subscribe(alice)
+		if _, err := service.Run(); !errors.Is(err, svc.ErrInvalidHex) {
+			t.Fatalf("\t%s\tTest %d:\tShould refuse to index malformed node data : Got %v", Failed, testID, err)
+		}
+		if block := service.GetCurrentBlock(); block != 2100 {
+			t.Fatalf("\t%s\tTest %d:\tShould retry the block : Got %d", Failed, testID, block)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		scanning := txparser.New(ctx, node.URL, 2100)
+		scanning.Subscribe(alice)
+		calls := node.Calls("eth_getBlockByNumber")
+		scanning.StartScan(5 * time.Millisecond)
+		time.Sleep(150 * time.Millisecond)
+		cancel()
+		if n := node.Calls("eth_getBlockByNumber") - calls; n == 0 || n > 8 {
+			t.Fatalf("\t%s\tTest %d:\tShould back off while the block keeps failing : Got %d attempts", Failed, testID, n)
+		}
+		if status := scanning.Status(); !strings.Contains(status.LastError, "invalid hex") || status.CurrentBlock != 2100 {
+			t.Fatalf("\t%s\tTest %d:\tShould report the failing block : Got %+v", Failed, testID, status)
+		}
+
+		zero := "0x0000000000000000000000000000000000000000"
+		minted := service.Pull([]svc.Transaction{
+			{Kind: svc.KindTransaction, Hash: hash(0x1c), From: address(zero), To: recipient(alice), Value: quantity(5), BlockNumber: 2102, Receipt: &svc.Receipt{Status: 1}},
+			{Kind: svc.KindTransaction, Hash: hash(0x1d), From: address(alice), To: recipient(zero), Value: quantity(2), BlockNumber: 2103, Receipt: &svc.Receipt{Status: 1}},
+		})
+		service.SaveTxs(minted)
+		if got := service.GetTransactions(alice, svc.WithCounterparty(zero)); len(got) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould match the zero address as a counterparty : Got %+v", Failed, testID, got)
+		}
+		if stats := service.GetStats(alice); stats.Counterparties != 1 || stats.Incoming != 1 || stats.Outgoing != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould count the zero address as a counterparty : Got %+v", Failed, testID, stats)
+		}
+		t.Logf("\t%s\tTest %d:\tShould encode transactions as Ethereum JSON and decode node data strictly", Success, testID)
+	})
+}
@@ -0,0 +1,54 @@
+package txparser
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/abi"
+)
+
+// DecodeCall decodes the transaction input against the given registry. It
+// returns nil for plain transfers and for unknown or malformed calldata.
+func DecodeCall(reg *abi.Registry, input svc.Bytes) *svc.Call {
+	if len(input) < 4 {
+		return nil
+	}
+	call, err := reg.Decode(input)
+	if err != nil {
+		return nil
+	}
+
+	args := make([]svc.CallArg, len(call.Args))
+	for i, v := range call.Args {
+		args[i] = svc.CallArg{
+			Name:  v.Name,
+			Type:  v.Type.String(),
+			Value: formatValue(v.Data),
+		}
+	}
+	return &svc.Call{
+		Selector:  call.Method.Selector.String(),
+		Method:    call.Method.Name,
+		Signature: call.Method.Signature(),
+		Args:      args,
+	}
+}
+
+// formatValue converts a decoded ABI value into a representation that
+// survives a JSON round-trip through the key-value store unchanged.
+func formatValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case []abi.Value:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = formatValue(item.Data)
+		}
+		return items
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package txparser
+
+import (
+	"fmt"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// decoder decodes the hex fields of a node response. It keeps the first
+// error, so that the fields of a whole object are decoded before checking
+// it once.
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(field, value string, err error) {
+	if d.err == nil {
+		d.err = fmt.Errorf("error decoding %s %q: %w", field, value, err)
+	}
+}
+
+func (d *decoder) big(field, value string) *svc.Big {
+	n, err := svc.ParseBig(value)
+	if err != nil {
+		d.fail(field, value, err)
+	}
+	return n
+}
+
+// optionalBig decodes a field absent from some transaction types or
+// forks, returning nil when it is.
+func (d *decoder) optionalBig(field, value string) *svc.Big {
+	if value == "" {
+		return nil
+	}
+	return d.big(field, value)
+}
+
+func (d *decoder) uint64(field, value string) svc.Uint64 {
+	n, err := svc.ParseUint64(value)
+	if err != nil {
+		d.fail(field, value, err)
+	}
+	return n
+}
+
+func (d *decoder) hash(field, value string) svc.Hash {
+	h, err := svc.ParseHash(value)
+	if err != nil {
+		d.fail(field, value, err)
+	}
+	return h
+}
+
+func (d *decoder) hashes(field string, values []string) []svc.Hash {
+	if len(values) == 0 {
+		return nil
+	}
+	hashes := make([]svc.Hash, len(values))
+	for i, v := range values {
+		hashes[i] = d.hash(field, v)
+	}
+	return hashes
+}
+
+func (d *decoder) address(field, value string) svc.Address {
+	a, err := svc.ParseAddress(value)
+	if err != nil {
+		d.fail(field, value, err)
+	}
+	return a
+}
+
+// optionalAddress decodes the recipient of a transaction, nil for
+// contract creations.
+func (d *decoder) optionalAddress(field, value string) *svc.Address {
+	if value == "" {
+		return nil
+	}
+	a := d.address(field, value)
+	return &a
+}
+
+func (d *decoder) bytes(field, value string) svc.Bytes {
+	b, err := svc.ParseBytes(value)
+	if err != nil {
+		d.fail(field, value, err)
+	}
+	return b
+}
@@ -0,0 +1,221 @@
+package txparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// Settings of the deliveries to the tenant targets.
+const (
+	// DeliveryTimeout bounds the time spent posting to a delivery target.
+	DeliveryTimeout = 5 * time.Second
+
+	// DeliveryInterval is the time between two runs of the delivery
+	// worker started by StartScan.
+	DeliveryInterval = time.Second
+
+	// DeliveryRetryDelay is the delay before the first retry of a failed
+	// delivery, doubled with every attempt up to MaxDeliveryRetryDelay.
+	DeliveryRetryDelay    = 5 * time.Second
+	MaxDeliveryRetryDelay = time.Hour
+
+	// MaxDeliveryAttempts is the number of attempts after which a
+	// delivery is dropped.
+	MaxDeliveryAttempts = 10
+)
+
+var deliveryClient = &http.Client{Timeout: DeliveryTimeout}
+
+// outboxSeq tells apart the outbox keys created at the same time.
+var outboxSeq uint64
+
+// Delivery is the payload posted to the delivery targets of a tenant when
+// new entries of one of its addresses are stored.
+type Delivery struct {
+	Tenant       string            `json:"tenant"`
+	Address      string            `json:"address"`
+	Transactions []svc.Transaction `json:"transactions"`
+}
+
+// outboxEntry is a delivery waiting to be posted to one target. Attempts
+// counts the posts tried so far, and NextAttempt is the time of the next
+// one, moved forward by the worker posting it so that other workers leave
+// it alone meanwhile.
+type outboxEntry struct {
+	Target      string          `json:"target"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+// deliver queues the new entries of the address for the delivery targets
+// of the tenant. They are posted by DeliverPending, away from the scanning.
+func (b *Blockscan) deliver(address string, txs []svc.Transaction) {
+	if b.tenant == nil || len(b.tenant.DeliveryTargets) == 0 {
+		return
+	}
+	body, err := json.Marshal(Delivery{
+		Tenant:       b.tenant.ID,
+		Address:      svc.Checksummed(address),
+		Transactions: txs,
+	})
+	if err != nil {
+		fmt.Println("error encoding delivery: ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, target := range b.tenant.DeliveryTargets {
+		// Targets saved by earlier versions were not checked.
+		if err := checkDeliveryTarget(target); err != nil {
+			fmt.Println("error queuing delivery: ", err)
+			continue
+		}
+		value, err := json.Marshal(outboxEntry{Target: target, Body: body, NextAttempt: now})
+		if err != nil {
+			fmt.Println("error encoding delivery: ", err)
+			continue
+		}
+		key := outboxKey(now, atomic.AddUint64(&outboxSeq, 1))
+		if _, err := b.kvstate.CompareAndSwap(key, nil, value); err != nil {
+			fmt.Println("error queuing delivery: ", err)
+		}
+	}
+}
+
+// runDeliveries posts the queued deliveries at the given interval until the
+// context is done.
+func (b *Blockscan) runDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := b.DeliverPending(time.Now()); err != nil {
+				fmt.Println("error delivering transactions: ", err)
+			}
+		}
+	}
+}
+
+// DeliverPending posts the queued deliveries of every tenant which are due
+// at the given time, oldest first. Delivered entries leave the queue;
+// failed ones are retried with an exponential backoff, and dropped after
+// MaxDeliveryAttempts. It returns the number of delivered entries.
+func (b *Blockscan) DeliverPending(now time.Time) (int, error) {
+	delivered := 0
+	for _, s := range b.scanners() {
+		if s.tenant == nil {
+			continue
+		}
+		n, err := s.deliverPending(now)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+func (b *Blockscan) deliverPending(now time.Time) (int, error) {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return 0, fmt.Errorf("error listing deliveries: %w", err)
+	}
+	sort.Strings(keys)
+
+	delivered := 0
+	for _, key := range keys {
+		if !strings.HasPrefix(key, outboxPrefix) {
+			continue
+		}
+		entry, ok := b.claimDelivery(key, now)
+		if !ok {
+			continue
+		}
+		if err := post(entry.Target, entry.Body); err != nil {
+			if entry.Attempts < MaxDeliveryAttempts {
+				fmt.Printf("error delivering transactions, attempt %d: %s\n", entry.Attempts, err)
+				continue
+			}
+			fmt.Printf("error delivering transactions, dropped after %d attempts: %s\n", entry.Attempts, err)
+		} else {
+			delivered++
+		}
+		if err := b.kvstate.Delete(key); err != nil {
+			return delivered, fmt.Errorf("error removing delivery: %w", err)
+		}
+	}
+	return delivered, nil
+}
+
+// claimDelivery returns the queued delivery if it is due, after counting
+// the attempt and scheduling the next one in the store. It reports false
+// when the delivery is not due or was claimed by another worker.
+func (b *Blockscan) claimDelivery(key string, now time.Time) (outboxEntry, bool) {
+	raw, err := b.current(key)
+	if err != nil || raw == nil {
+		return outboxEntry{}, false
+	}
+	var entry outboxEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		fmt.Println("error unmarshaling delivery: ", err)
+		return outboxEntry{}, false
+	}
+	if now.Before(entry.NextAttempt) {
+		return outboxEntry{}, false
+	}
+
+	delay := DeliveryRetryDelay << entry.Attempts
+	if delay <= 0 || delay > MaxDeliveryRetryDelay {
+		delay = MaxDeliveryRetryDelay
+	}
+	entry.Attempts++
+	entry.NextAttempt = now.Add(delay)
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return outboxEntry{}, false
+	}
+	if ok, err := b.kvstate.CompareAndSwap(key, raw, value); err != nil || !ok {
+		return outboxEntry{}, false
+	}
+	return entry, true
+}
+
+// checkDeliveryTarget fails unless the target is an absolute http or https
+// URL with a host.
+func checkDeliveryTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid delivery target %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Hostname() == "" {
+		return fmt.Errorf("invalid delivery target %q: expected an http or https URL", target)
+	}
+	return nil
+}
+
+// post sends the body to the target, failing unless it responds with a
+// 2xx status code.
+func post(target string, body []byte) error {
+	r, err := deliveryClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return fmt.Errorf("%s responded with status code %d", target, r.StatusCode)
+	}
+	return nil
+}
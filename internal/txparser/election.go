@@ -0,0 +1,209 @@
+package txparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
+)
+
+// DefaultLeaderLeaseTTL is the default time after which a standby takes
+// over from a leader which stopped renewing its lease.
+const DefaultLeaderLeaseTTL = 30 * time.Second
+
+// ErrNotLeader is returned by Run when the leadership was lost while the
+// block was scanned. Nothing of the block is saved.
+var ErrNotLeader = errors.New("not the leader")
+
+// election is the leader election state of a process.
+type election struct {
+	node string
+	ttl  time.Duration
+
+	lock   sync.Mutex
+	leader bool
+}
+
+// leaderLease is the lease of the leader, stored in the shared store.
+// Block is the last block scanned by the holder when the lease was
+// renewed, from which the next leader resumes when the lease is kept apart
+// from the store.
+type leaderLease struct {
+	Holder string    `json:"holder"`
+	Until  time.Time `json:"until"`
+	Block  int       `json:"block,omitempty"`
+}
+
+// WithLeaderElection runs the scanner of several copies sharing the store
+// on a single elected leader, identified by node. The leader renews its
+// lease while scanning; standbys serve reads and take over once the lease
+// is not renewed for ttl, that is within ttl plus the scan interval.
+func WithLeaderElection(node string, ttl time.Duration) Option {
+	return func(b *Blockscan) {
+		if ttl <= 0 {
+			ttl = DefaultLeaderLeaseTTL
+		}
+		b.election = &election{node: node, ttl: ttl}
+	}
+}
+
+// WithLeaseStore keeps the leader lease in kv rather than in the store of
+// the parser, so copies which don't share their store, such as the CLI
+// with its in-memory store, still elect a single leader. Standbys then
+// resume from the last block the leader recorded in its lease.
+func WithLeaseStore(kv state.KeyValueStorer) Option {
+	return func(b *Blockscan) {
+		b.leases = kv
+	}
+}
+
+// leaseStore returns the store holding the leader lease.
+func (b *Blockscan) leaseStore() state.KeyValueStorer {
+	if b.leases != nil {
+		return b.leases
+	}
+	return b.kvstate
+}
+
+// Campaign acquires or renews the leadership. It reports whether the
+// process is the leader, which is always the case without leader
+// election. A newly elected leader resumes scanning from the checkpoint
+// of the previous one.
+func (b *Blockscan) Campaign() bool {
+	e := b.election
+	if e == nil {
+		return true
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := time.Now()
+	current, raw, err := b.loadLeaderLease()
+	if err != nil {
+		fmt.Println("error campaigning: ", err)
+		e.leader = false
+		return false
+	}
+	if current.Holder != e.node && now.Before(current.Until) {
+		e.leader = false
+		return false
+	}
+
+	if !e.leader {
+		if block, ok, err := b.leaderCheckpoint(current); err != nil {
+			fmt.Println("error resuming from checkpoint: ", err)
+		} else if ok {
+			b.setScanned(block)
+		}
+	}
+
+	value, err := json.Marshal(leaderLease{Holder: e.node, Until: now.Add(e.ttl), Block: b.scanned()})
+	if err != nil {
+		fmt.Println("error campaigning: ", err)
+		return false
+	}
+	if ok, err := b.leaseStore().CompareAndSwap(leaderKey, raw, value); err != nil || !ok {
+		e.leader = false
+		return false
+	}
+
+	if !e.leader {
+		fmt.Printf("%s elected leader at block %d\n", e.node, b.scanned())
+	}
+	e.leader = true
+	return true
+}
+
+// leaderCheckpoint returns the last block scanned by the leader holding
+// the lease, or its predecessors: the checkpoint saved in the store, or
+// the block recorded in the lease if it is further, as when the lease is
+// kept apart from the store.
+func (b *Blockscan) leaderCheckpoint(lease leaderLease) (int, bool, error) {
+	block, ok, err := b.loadCheckpoint()
+	if err != nil {
+		return 0, false, err
+	}
+	if lease.Block > block {
+		return lease.Block, true, nil
+	}
+	return block, ok, nil
+}
+
+// fence renews the lease before the entries of a scanned block are saved,
+// so a leader whose lease expired while it scanned the block, and was
+// taken over, never writes behind its successor. It returns ErrNotLeader
+// once the lease is lost.
+func (b *Blockscan) fence() error {
+	if b.election == nil {
+		return nil
+	}
+	if !b.IsLeader() || !b.Campaign() {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// IsLeader reports whether the process is the leader, which is always the
+// case without leader election.
+func (b *Blockscan) IsLeader() bool {
+	e := b.election
+	if e == nil {
+		return true
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.leader
+}
+
+// Resign releases the leadership, so a standby takes over without waiting
+// for the lease to expire.
+func (b *Blockscan) Resign() {
+	e := b.election
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	current, raw, err := b.loadLeaderLease()
+	if err != nil || current.Holder != e.node {
+		return
+	}
+	value, err := json.Marshal(leaderLease{Holder: e.node, Block: b.scanned()})
+	if err != nil {
+		return
+	}
+	if _, err := b.leaseStore().CompareAndSwap(leaderKey, raw, value); err != nil {
+		fmt.Println("error resigning: ", err)
+	}
+}
+
+// loadLeaderLease returns the current lease with its raw value, nil if
+// there was never a leader.
+func (b *Blockscan) loadLeaderLease() (leaderLease, []byte, error) {
+	leases := b.leaseStore()
+	if exist, _ := leases.Has(leaderKey); !exist {
+		return leaderLease{}, nil, nil
+	}
+	values, err := leases.Get(leaderKey)
+	if err != nil {
+		return leaderLease{}, nil, fmt.Errorf("error getting leader lease: %w", err)
+	}
+	if len(values) == 0 {
+		return leaderLease{}, nil, nil
+	}
+	raw := values[len(values)-1]
+	var l leaderLease
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return leaderLease{}, nil, fmt.Errorf("error unmarshaling leader lease: %w", err)
+	}
+	return l, raw, nil
+}
@@ -0,0 +1,270 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// appendTxs adds the entries to the history of the address, which is kept
+// ordered by position in the chain. Entries following the stored ones, as
+// when blocks are scanned in order, are appended. Others are merged by
+// rewriting the history, leaving out those already in it. Both are swapped
+// in only if the history did not change meanwhile, and retried otherwise,
+// so entries appended concurrently by other workers are neither lost,
+// misplaced nor stored twice. It returns the entries it added.
+func (b *Blockscan) appendTxs(address string, txs []svc.Transaction) ([]svc.Transaction, error) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Position().Less(txs[j].Position())
+	})
+	batch := make([][]byte, len(txs))
+	for i, tx := range txs {
+		value, err := json.Marshal(tx)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling transaction: %w", err)
+		}
+		batch[i] = value
+	}
+
+	for {
+		n, err := b.kvstate.Len(address)
+		if err != nil {
+			return nil, fmt.Errorf("error getting transactions: %w", err)
+		}
+		added := txs
+		var ok bool
+		if n == 0 {
+			ok, err = b.kvstate.CompareAndReplace(address, 0, nil, batch)
+		} else {
+			var last [][]byte
+			if last, err = b.kvstate.GetRange(address, n-1, n); err != nil {
+				return nil, fmt.Errorf("error getting transactions: %w", err)
+			}
+			if len(last) == 0 {
+				continue
+			}
+			if !decodePosition(last[0]).Less(txs[0].Position()) {
+				added, ok, err = b.mergeTxs(address, txs, batch)
+			} else {
+				ok, err = b.kvstate.CompareAndReplace(address, n-1, last, append(last, batch...))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving transactions: %w", err)
+		}
+		if ok {
+			return added, nil
+		}
+	}
+}
+
+// mergeTxs rewrites the history of the address with the entries, encoded
+// in batch, merged in if not already there, provided it did not change
+// meanwhile. It returns the entries it added.
+func (b *Blockscan) mergeTxs(address string, txs []svc.Transaction, batch [][]byte) ([]svc.Transaction, bool, error) {
+	values, err := b.kvstate.Get(address)
+	if err != nil {
+		return nil, false, err
+	}
+	stored := make(map[string]bool, len(values))
+	for _, v := range values {
+		stored[decodePosition(v).ID] = true
+	}
+
+	var added []svc.Transaction
+	merged := append([][]byte{}, values...)
+	for i, tx := range txs {
+		if !stored[tx.ID()] {
+			added = append(added, tx)
+			merged = append(merged, batch[i])
+		}
+	}
+	if len(added) == 0 {
+		return nil, true, nil
+	}
+	merged, _ = sortHistory(merged)
+	ok, err := b.kvstate.CompareAndReplace(address, 0, values, merged)
+	return added, ok, err
+}
+
+// sortHistory orders the encoded entries by position. Entries which can't
+// be decoded are kept first rather than lost. It reports whether the order
+// changed.
+func sortHistory(values [][]byte) ([][]byte, bool) {
+	positions := make([]svc.Position, len(values))
+	for i, v := range values {
+		positions[i] = decodePosition(v)
+	}
+	indexes := make([]int, len(values))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return positions[indexes[i]].Less(positions[indexes[j]])
+	})
+
+	sorted := make([][]byte, len(values))
+	changed := false
+	for i, idx := range indexes {
+		sorted[i] = values[idx]
+		changed = changed || i != idx
+	}
+	return sorted, changed
+}
+
+func decodePosition(value []byte) svc.Position {
+	var tx svc.Transaction
+	if err := json.Unmarshal(value, &tx); err != nil {
+		return svc.Position{}
+	}
+	return tx.Position()
+}
+
+// txAt returns the entry at the given index of the history of the address.
+// It reports false for an entry which can't be decoded.
+func (b *Blockscan) txAt(address string, i int) (svc.Transaction, bool, error) {
+	values, err := b.kvstate.GetRange(address, i, i+1)
+	if err != nil {
+		return svc.Transaction{}, false, fmt.Errorf("error getting transactions: %w", err)
+	}
+	if len(values) == 0 {
+		return svc.Transaction{}, false, fmt.Errorf("error getting transactions: index %d out of range", i)
+	}
+	var tx svc.Transaction
+	if err := json.Unmarshal(values[0], &tx); err != nil {
+		fmt.Println("error unmarshaling transaction: ", err)
+		return svc.Transaction{}, false, nil
+	}
+	return tx, true, nil
+}
+
+// positionAt returns the position of the entry at the given index of the
+// history of the address.
+func (b *Blockscan) positionAt(address string, i int) (svc.Position, error) {
+	values, err := b.kvstate.GetRange(address, i, i+1)
+	if err != nil {
+		return svc.Position{}, fmt.Errorf("error getting transactions: %w", err)
+	}
+	if len(values) == 0 {
+		return svc.Position{}, fmt.Errorf("error getting transactions: index %d out of range", i)
+	}
+	return decodePosition(values[0]), nil
+}
+
+// history is an ordered transaction history read one entry at a time.
+type history struct {
+	len int
+	at  func(i int) (svc.Transaction, bool, error)
+	pos func(i int) (svc.Position, error)
+}
+
+// storedHistory reads the history of the address from the store, without
+// loading the entries which are not needed.
+func (b *Blockscan) storedHistory(address string) (history, error) {
+	n, err := b.kvstate.Len(address)
+	if err != nil {
+		return history{}, fmt.Errorf("error getting transactions: %w", err)
+	}
+	return history{
+		len: n,
+		at:  func(i int) (svc.Transaction, bool, error) { return b.txAt(address, i) },
+		pos: func(i int) (svc.Position, error) { return b.positionAt(address, i) },
+	}, nil
+}
+
+// loadedHistory reads a history already in memory.
+func loadedHistory(txs []svc.Transaction) history {
+	return history{
+		len: len(txs),
+		at:  func(i int) (svc.Transaction, bool, error) { return txs[i], true, nil },
+		pos: func(i int) (svc.Position, error) { return txs[i].Position(), nil },
+	}
+}
+
+// search returns the index of the first entry of the history for which f
+// is true, f being false and then true over the history.
+func (h history) search(f func(svc.Position) bool) (int, error) {
+	var err error
+	i := sort.Search(h.len, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		p, e := h.pos(i)
+		if e != nil {
+			err = e
+			return true
+		}
+		return f(p)
+	})
+	return i, err
+}
+
+// page returns the entries of the history of the address matching the
+// query, in the query order, starting after its cursor and limited to its
+// limit. The block range and the cursor are located by binary search, so
+// only the entries in the range are read.
+func (h history) page(address string, query svc.Query) (svc.TransactionPage, error) {
+	lo, hi := 0, h.len
+	if query.FromBlock != 0 {
+		i, err := h.search(func(p svc.Position) bool { return p.Block >= query.FromBlock })
+		if err != nil {
+			return svc.TransactionPage{}, err
+		}
+		lo = i
+	}
+	if query.ToBlock != 0 {
+		i, err := h.search(func(p svc.Position) bool { return p.Block > query.ToBlock })
+		if err != nil {
+			return svc.TransactionPage{}, err
+		}
+		hi = i
+	}
+	if query.Cursor != "" {
+		cursor, err := svc.ParseCursor(query.Cursor)
+		if err != nil {
+			return svc.TransactionPage{}, err
+		}
+		if query.Order == svc.Descending {
+			i, err := h.search(func(p svc.Position) bool { return !p.Less(cursor) })
+			if err != nil {
+				return svc.TransactionPage{}, err
+			}
+			if i < hi {
+				hi = i
+			}
+		} else {
+			i, err := h.search(func(p svc.Position) bool { return cursor.Less(p) })
+			if err != nil {
+				return svc.TransactionPage{}, err
+			}
+			if i > lo {
+				lo = i
+			}
+		}
+	}
+
+	page := svc.TransactionPage{Transactions: []svc.Transaction{}}
+	for n := 0; n < hi-lo; n++ {
+		i := lo + n
+		if query.Order == svc.Descending {
+			i = hi - 1 - n
+		}
+		tx, ok, err := h.at(i)
+		if err != nil {
+			return svc.TransactionPage{}, err
+		}
+		if !ok || !query.MatchFor(address, tx) {
+			continue
+		}
+		page.Transactions = append(page.Transactions, tx)
+		if query.Limit > 0 && len(page.Transactions) == query.Limit {
+			if n < hi-lo-1 {
+				page.NextCursor = tx.Position().Cursor()
+			}
+			break
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,128 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// indexMembers returns the members of the index held at key, sorted. The
+// index of a store written before it existed, or restored from such a
+// snapshot, is built once from the keys with the given prefix.
+func (b *Blockscan) indexMembers(key, prefix string) ([]string, error) {
+	raw, err := b.current(key)
+	if err != nil {
+		return nil, fmt.Errorf("error getting index: %w", err)
+	}
+	if raw == nil {
+		if err := b.buildIndex(key, prefix); err != nil {
+			return nil, err
+		}
+		if raw, err = b.current(key); err != nil {
+			return nil, fmt.Errorf("error getting index: %w", err)
+		}
+	}
+	members, err := decodeIndex(raw)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(members))
+	for member := range members {
+		result = append(result, member)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// addToIndex adds the member to the index held at key.
+func (b *Blockscan) addToIndex(key, prefix, member string) error {
+	return b.updateIndex(key, prefix, func(members map[string]bool) bool {
+		if members[member] {
+			return false
+		}
+		members[member] = true
+		return true
+	})
+}
+
+// removeFromIndex removes the member from the index held at key.
+func (b *Blockscan) removeFromIndex(key, prefix, member string) error {
+	return b.updateIndex(key, prefix, func(members map[string]bool) bool {
+		if !members[member] {
+			return false
+		}
+		delete(members, member)
+		return true
+	})
+}
+
+// updateIndex saves the members of the index held at key changed by fn,
+// which reports whether it changed them. The index is built first if it
+// is missing, so the members it would be built from are never left out.
+func (b *Blockscan) updateIndex(key, prefix string, fn func(members map[string]bool) bool) error {
+	if exist, _ := b.kvstate.Has(key); !exist {
+		if err := b.buildIndex(key, prefix); err != nil {
+			return err
+		}
+	}
+	return b.update(key, func(old []byte) ([]byte, error) {
+		members, err := decodeIndex(old)
+		if err != nil {
+			return nil, err
+		}
+		if !fn(members) {
+			return nil, nil
+		}
+		return encodeIndex(members)
+	})
+}
+
+// buildIndex saves the index held at key from the keys with the given
+// prefix, unless it was built meanwhile.
+func (b *Blockscan) buildIndex(key, prefix string) error {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return fmt.Errorf("error listing keys: %w", err)
+	}
+	members := make(map[string]bool)
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			members[strings.TrimPrefix(k, prefix)] = true
+		}
+	}
+	return b.update(key, func(old []byte) ([]byte, error) {
+		if old != nil {
+			return nil, nil
+		}
+		return encodeIndex(members)
+	})
+}
+
+func decodeIndex(raw []byte) (map[string]bool, error) {
+	members := make(map[string]bool)
+	if raw == nil {
+		return members, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("error unmarshaling index: %w", err)
+	}
+	for _, member := range list {
+		members[member] = true
+	}
+	return members, nil
+}
+
+func encodeIndex(members map[string]bool) ([]byte, error) {
+	list := make([]string, 0, len(members))
+	for member := range members {
+		list = append(list, member)
+	}
+	sort.Strings(list)
+	value, err := json.Marshal(list)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling index: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,146 @@
+package txparser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// Key layout of the key-value store. Subscribed addresses are stored as
+// bare keys holding their transaction history; every other record lives
+// under a prefix so it can never collide with an address.
+const (
+	seenPrefix   = "seen:"
+	subPrefix    = "sub:"
+	purgePrefix  = "purge:"
+	ledgerPrefix = "ledger:"
+	noncePrefix  = "nonce:"
+	hashPrefix   = "hash:"
+	statsPrefix  = "stats:"
+	peerPrefix   = "peer:"
+	rollupPrefix = "rollup:"
+	totalPrefix  = "total:"
+	tenantPrefix = "tenants:"
+	outboxPrefix = "outbox:"
+
+	// checkpointKey holds the last scanned block.
+	checkpointKey = "scan:checkpoint"
+
+	// shardNextKey holds the first block of the next block range to be
+	// claimed by a worker.
+	shardNextKey     = "shard:next"
+	shardRangePrefix = "shard:range:"
+
+	// shardFirstKey holds the first block of the first block range not
+	// pruned. Ranges are contiguous, so the others follow from it.
+	shardFirstKey = "shard:first"
+
+	// subIndexKey lists the subscribed addresses, so the scanning finds
+	// them without listing every key of the store.
+	subIndexKey = "index:subs"
+
+	// tenantIndexKey lists the registered tenants.
+	tenantIndexKey = "index:tenants"
+
+	// leaderKey holds the lease of the process running the scanner when
+	// several copies share the store.
+	leaderKey = "ha:leader"
+
+	// allScope is the rollup scope of every address.
+	allScope = "all"
+)
+
+// subKey holds the registry entry of the subscribed address. The address
+// history outlives the subscription when it is kept on unsubscribe.
+func subKey(address string) string {
+	return subPrefix + address
+}
+
+// purgeKey holds the unix time after which the history of an
+// unsubscribed address is deleted.
+func purgeKey(address string) string {
+	return purgePrefix + address
+}
+
+// seenKey marks the entry with the given ID as stored in the address
+// history.
+func seenKey(address, id string) string {
+	return seenPrefix + address + ":" + id
+}
+
+// ledgerKey holds the balance ledger of the address.
+func ledgerKey(address string) string {
+	return ledgerPrefix + address
+}
+
+// nonceKey holds the outgoing nonce tracker of the address.
+func nonceKey(address string) string {
+	return noncePrefix + address
+}
+
+// statsKey holds the aggregates of the address history.
+func statsKey(address string) string {
+	return statsPrefix + address
+}
+
+// peerKey marks the counterparty as counted in the statistics of the
+// address.
+func peerKey(address, counterparty string) string {
+	return peerPrefix + address + ":" + counterparty
+}
+
+// rollupKey holds the rollup of the bucket starting at the given time, for
+// the address or allScope. Keys are padded to list in time order.
+func rollupKey(scope string, bucket svc.Bucket, start time.Time) string {
+	return fmt.Sprintf("%s%s:%s:%012d", rollupPrefix, scope, bucket, start.Unix())
+}
+
+// totalKey marks the entry with the given ID as counted in the rollups of
+// every address, so an entry between two subscribed addresses is counted
+// once.
+func totalKey(id string) string {
+	return totalPrefix + id
+}
+
+// hashKey indexes the entries with the given transaction hash, one value
+// per entry, by address and position in the address history.
+func hashKey(hash svc.Hash) string {
+	return hashPrefix + hash.Hex()
+}
+
+// tenantKey holds the registry entry of the tenant.
+func tenantKey(id string) string {
+	return tenantPrefix + id
+}
+
+// outboxKey holds a delivery queued at the given time. Keys are padded to
+// list in queuing order.
+func outboxKey(at time.Time, seq uint64) string {
+	return fmt.Sprintf("%s%020d:%012d", outboxPrefix, at.UnixNano(), seq)
+}
+
+// tenantNamespace prefixes every key of the tenant, so its subscriptions
+// and histories are isolated from the ones of the other tenants.
+func tenantNamespace(id string) string {
+	return "tenant:" + id + ":"
+}
+
+// shardRangeKey holds the progress and the lease of the block range
+// starting at the given block. Keys are padded to list in block order.
+func shardRangeKey(start int) string {
+	return fmt.Sprintf("%s%012d", shardRangePrefix, start)
+}
+
+// isAddressKey reports whether the key holds an address history.
+func isAddressKey(key string) bool {
+	return !strings.Contains(key, ":")
+}
+
+// isLeaseKey reports whether the key holds a lease of the process or
+// worker scanning blocks. Leases belong to the running copies and are
+// left out of snapshots.
+func isLeaseKey(key string) bool {
+	return key == leaderKey || key == shardNextKey || key == shardFirstKey || strings.HasPrefix(key, shardRangePrefix)
+}
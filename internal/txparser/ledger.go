@@ -0,0 +1,234 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// DefaultReconcileInterval is the number of blocks between two
+// reconciliations of the ledgers against on-chain balances.
+const DefaultReconcileInterval = 100
+
+// WithReconcileInterval sets the number of blocks between two
+// reconciliations of the ledgers. Zero disables reconciliation.
+func WithReconcileInterval(blocks int) Option {
+	return func(b *Blockscan) {
+		b.reconcileEvery = blocks
+	}
+}
+
+// ledger anchors the balance history of an address to the chain. The
+// balance after an entry is the opening balance plus the deltas of every
+// entry up to it, plus the corrections of the mismatches found at the
+// end of earlier blocks.
+type ledger struct {
+	Opening    *big.Int              `json:"opening"`
+	Mismatches []svc.BalanceMismatch `json:"mismatches"`
+}
+
+// Delta returns the change in balance of the address caused by the entry:
+// the value received or sent, and the fee paid as sender. Failed
+// transactions transfer no value but are still charged. Internal transfers
+// are only indexed when they succeeded, and charge no fee.
+func Delta(address string, tx svc.Transaction) *big.Int {
+	delta := new(big.Int)
+	address = strings.ToLower(address)
+
+	switch tx.Kind {
+	case svc.KindWithdrawal:
+		if tx.Recipient() == address && tx.Value != nil {
+			delta.Add(delta, tx.Value.ToInt())
+		}
+	case svc.KindInternal:
+		if tx.Value != nil {
+			if tx.Recipient() == address {
+				delta.Add(delta, tx.Value.ToInt())
+			}
+			if tx.Sender() == address {
+				delta.Sub(delta, tx.Value.ToInt())
+			}
+		}
+	case svc.KindTransaction, "":
+		succeeded := tx.Receipt == nil || tx.Receipt.Status == 1
+		if succeeded && tx.Value != nil {
+			if tx.Recipient() == address {
+				delta.Add(delta, tx.Value.ToInt())
+			}
+			if tx.Sender() == address {
+				delta.Sub(delta, tx.Value.ToInt())
+			}
+		}
+		if tx.Sender() == address && tx.Fee != nil {
+			delta.Sub(delta, tx.Fee.ToInt())
+		}
+	}
+	return delta
+}
+
+// opening returns the opening balance, zero until the ledger is anchored.
+func (l ledger) opening() *big.Int {
+	if l.Opening == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(l.Opening)
+}
+
+// balance returns the balance of the address at the end of its history.
+func (l ledger) balance(address string, txs []svc.Transaction) *big.Int {
+	balance := l.opening()
+	for _, tx := range txs {
+		balance.Add(balance, Delta(address, tx))
+	}
+	for _, m := range l.Mismatches {
+		balance.Add(balance, m.Diff())
+	}
+	return balance
+}
+
+// applyBalances sets the running balance of the address after each entry
+// of its history. Mismatches are applied as corrections at the end of the
+// block they were found in.
+func (l ledger) applyBalances(address string, txs []svc.Transaction) {
+	balance := l.opening()
+	corrections := l.Mismatches
+	for i := range txs {
+		for len(corrections) > 0 && corrections[0].Block < uint64(txs[i].BlockNumber) {
+			balance.Add(balance, corrections[0].Diff())
+			corrections = corrections[1:]
+		}
+		balance.Add(balance, Delta(address, txs[i]))
+		txs[i].BalanceAfter = svc.NewBig(new(big.Int).Set(balance))
+	}
+}
+
+// Reconcile compares the indexed balance of every subscribed address with
+// its on-chain balance at the given block, which must be the last scanned
+// one. The first reconciliation of an address anchors its ledger; later
+// ones record a mismatch when the balances differ, which then corrects the
+// indexed balance.
+func (b *Blockscan) Reconcile(block int) error {
+	return b.eachSubscription(func(address string) error {
+		return b.reconcile(address, block)
+	})
+}
+
+// anchorLedgers reconciles the addresses whose ledger was never anchored,
+// so balances are available without waiting for the next reconciliation.
+func (b *Blockscan) anchorLedgers(block int) error {
+	return b.eachSubscription(func(address string) error {
+		if exist, _ := b.kvstate.Has(ledgerKey(address)); exist {
+			return nil
+		}
+		return b.reconcile(address, block)
+	})
+}
+
+func (b *Blockscan) reconcile(address string, block int) error {
+	actual, err := b.clt.BalanceAt(address, block)
+	if err != nil {
+		return fmt.Errorf("error querying balance of %s: %w", address, err)
+	}
+	txs, err := b.loadTxs(address)
+	if err != nil {
+		return err
+	}
+	// Sharded workers may have indexed blocks past the reconciled one.
+	txs = txs[:sort.Search(len(txs), func(i int) bool { return uint64(txs[i].BlockNumber) > uint64(block) })]
+
+	return b.update(ledgerKey(address), func(old []byte) ([]byte, error) {
+		var l ledger
+		if old != nil {
+			if err := json.Unmarshal(old, &l); err != nil {
+				return nil, fmt.Errorf("error unmarshaling ledger: %w", err)
+			}
+		}
+
+		expected := l.balance(address, txs)
+		if l.Opening == nil {
+			l.Opening = new(big.Int).Sub(actual, expected)
+		} else if expected.Cmp(actual) != 0 {
+			fmt.Printf("balance mismatch for %s at block %d: indexed %s, on-chain %s\n", address, block, expected, actual)
+			l.Mismatches = append(l.Mismatches, svc.BalanceMismatch{Block: uint64(block), Expected: expected, Actual: actual})
+		} else {
+			return nil, nil
+		}
+
+		value, err := json.Marshal(l)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling ledger: %w", err)
+		}
+		return value, nil
+	})
+}
+
+func (b *Blockscan) loadLedger(address string) (ledger, error) {
+	var l ledger
+	if exist, _ := b.kvstate.Has(ledgerKey(address)); !exist {
+		return l, nil
+	}
+	values, err := b.kvstate.Get(ledgerKey(address))
+	if err != nil {
+		return l, fmt.Errorf("error getting ledger: %w", err)
+	}
+	if len(values) == 0 {
+		return l, nil
+	}
+	if err := json.Unmarshal(values[len(values)-1], &l); err != nil {
+		return l, fmt.Errorf("error unmarshaling ledger: %w", err)
+	}
+	return l, nil
+}
+
+// set replaces the value of a single-valued key. The value is swapped in
+// atomically, so concurrent readers never see the key missing.
+func (b *Blockscan) set(key string, value []byte) error {
+	return b.update(key, func([]byte) ([]byte, error) {
+		return value, nil
+	})
+}
+
+// update replaces the value of a single-valued key with the one fn derives
+// from its current value, nil if it is absent. The value is swapped in only
+// if the key was not changed meanwhile, otherwise fn is called again with
+// the new value, so updates made concurrently by other workers are never
+// lost. A nil value returned by fn leaves the key unchanged.
+func (b *Blockscan) update(key string, fn func(old []byte) ([]byte, error)) error {
+	for {
+		old, err := b.current(key)
+		if err != nil {
+			return fmt.Errorf("error replacing %s: %w", key, err)
+		}
+		value, err := fn(old)
+		if err != nil || value == nil {
+			return err
+		}
+		ok, err := b.kvstate.CompareAndSwap(key, old, value)
+		if err != nil {
+			return fmt.Errorf("error replacing %s: %w", key, err)
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// current returns the value of a single-valued key, nil if it is absent.
+// A key holding no value can't be swapped, so it is deleted.
+func (b *Blockscan) current(key string) ([]byte, error) {
+	if exist, _ := b.kvstate.Has(key); !exist {
+		return nil, nil
+	}
+	values, err := b.kvstate.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, b.kvstate.Delete(key)
+	}
+	return values[len(values)-1], nil
+}
@@ -0,0 +1,162 @@
+package txparser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// hashEntry locates an entry of a transaction in an address history.
+type hashEntry struct {
+	Address string `json:"address"`
+	Cursor  string `json:"cursor"`
+}
+
+// indexHashes adds the entries saved for the address to the hash index.
+func (b *Blockscan) indexHashes(address string, txs []svc.Transaction) error {
+	for _, tx := range txs {
+		if tx.Hash.IsZero() {
+			continue
+		}
+		value, err := json.Marshal(hashEntry{Address: address, Cursor: tx.Position().Cursor()})
+		if err != nil {
+			return fmt.Errorf("error marshaling hash index entry: %w", err)
+		}
+		if err := b.kvstate.Put(hashKey(tx.Hash), [][]byte{value}); err != nil {
+			return fmt.Errorf("error indexing transaction hash: %w", err)
+		}
+	}
+	return nil
+}
+
+// unindexHashes removes the entries of the address from the hash index.
+func (b *Blockscan) unindexHashes(address string) error {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return fmt.Errorf("error listing keys: %w", err)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, hashPrefix) {
+			continue
+		}
+		values, err := b.kvstate.Get(key)
+		if err != nil {
+			return fmt.Errorf("error getting hash index: %w", err)
+		}
+		var kept [][]byte
+		for _, v := range values {
+			var e hashEntry
+			if err := json.Unmarshal(v, &e); err == nil && e.Address == address {
+				continue
+			}
+			kept = append(kept, v)
+		}
+		if len(kept) == len(values) {
+			continue
+		}
+		if err := b.kvstate.Delete(key); err != nil {
+			return fmt.Errorf("error rewriting hash index: %w", err)
+		}
+		if len(kept) > 0 {
+			if err := b.kvstate.Put(key, kept); err != nil {
+				return fmt.Errorf("error rewriting hash index: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetTransaction returns the transaction with the given hash, as indexed
+// for the subscribed addresses, and the addresses it touched.
+func (s *Service) GetTransaction(hash string) (svc.TransactionLookup, bool) {
+	lookup, err := s.V2().GetTransaction(context.Background(), hash)
+	if err != nil {
+		if !errors.Is(err, svc.ErrTransactionNotFound) && !errors.Is(err, svc.ErrInvalidHash) {
+			fmt.Println("error getting transaction: ", err)
+		}
+		return svc.TransactionLookup{}, false
+	}
+	return lookup, true
+}
+
+// GetTransaction returns the transaction with the given hash, as indexed
+// for the subscribed addresses, and the addresses it touched. When the
+// hash was only indexed through an EIP-7702 authorization, the
+// authorization entry is returned.
+func (v *ServiceV2) GetTransaction(ctx context.Context, hash string) (svc.TransactionLookup, error) {
+	if err := ctx.Err(); err != nil {
+		return svc.TransactionLookup{}, err
+	}
+	h, err := svc.ParseHash(hash)
+	if err != nil {
+		return svc.TransactionLookup{}, fmt.Errorf("%w: %q", svc.ErrInvalidHash, hash)
+	}
+	exist, err := v.s.kvstate.Has(hashKey(h))
+	if err != nil {
+		return svc.TransactionLookup{}, unavailable(err)
+	}
+	if !exist {
+		return svc.TransactionLookup{}, fmt.Errorf("%w: %s", svc.ErrTransactionNotFound, hash)
+	}
+	values, err := v.s.kvstate.Get(hashKey(h))
+	if err != nil {
+		return svc.TransactionLookup{}, unavailable(err)
+	}
+
+	var (
+		lookup svc.TransactionLookup
+		found  bool
+		seen   = make(map[string]bool)
+	)
+	for _, value := range values {
+		var e hashEntry
+		if err := json.Unmarshal(value, &e); err != nil {
+			fmt.Println("error unmarshaling hash index entry: ", err)
+			continue
+		}
+		if !seen[e.Address] {
+			seen[e.Address] = true
+			lookup.Addresses = append(lookup.Addresses, svc.Checksummed(e.Address))
+		}
+		if found && lookup.Transaction.Kind == svc.KindTransaction {
+			continue
+		}
+		tx, ok, err := v.s.entryAt(e.Address, e.Cursor)
+		if err != nil {
+			return svc.TransactionLookup{}, unavailable(err)
+		}
+		if ok && (!found || tx.Kind == svc.KindTransaction) {
+			lookup.Transaction, found = tx, true
+		}
+	}
+	if !found {
+		return svc.TransactionLookup{}, fmt.Errorf("%w: %s", svc.ErrTransactionNotFound, hash)
+	}
+	return lookup, nil
+}
+
+// entryAt returns the entry at the position encoded by the cursor in the
+// history of the address, located by binary search.
+func (b *Blockscan) entryAt(address, cursor string) (svc.Transaction, bool, error) {
+	pos, err := svc.ParseCursor(cursor)
+	if err != nil {
+		return svc.Transaction{}, false, err
+	}
+	h, err := b.storedHistory(address)
+	if err != nil {
+		return svc.Transaction{}, false, err
+	}
+	i, err := h.search(func(p svc.Position) bool { return !p.Less(pos) })
+	if err != nil || i == h.len {
+		return svc.Transaction{}, false, err
+	}
+	tx, ok, err := h.at(i)
+	if err != nil || !ok || tx.ID() != pos.ID {
+		return svc.Transaction{}, false, err
+	}
+	return tx, true, nil
+}
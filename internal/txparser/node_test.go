@@ -0,0 +1,305 @@
+package txparser_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
+)
+
+// fakeNode serves the JSON-RPC methods used by ethclient from an in-memory
+// chain, so the scanner can be tested without network access.
+type fakeNode struct {
+	URL string
+
+	lock     sync.Mutex
+	head     int
+	blocks   map[int]ethclient.Block
+	receipts map[string]ethclient.Receipt
+	traces   map[string]ethclient.CallFrame
+	balances map[string]map[int]*big.Int
+	methods  map[string]func(params []json.RawMessage) (interface{}, error)
+	calls    map[string]int
+}
+
+func newFakeNode(t *testing.T, blocks ...ethclient.Block) *fakeNode {
+	n := &fakeNode{
+		blocks:   make(map[int]ethclient.Block),
+		receipts: make(map[string]ethclient.Receipt),
+		traces:   make(map[string]ethclient.CallFrame),
+		balances: make(map[string]map[int]*big.Int),
+		methods:  make(map[string]func(params []json.RawMessage) (interface{}, error)),
+		calls:    make(map[string]int),
+	}
+	for _, b := range blocks {
+		n.AddBlock(b)
+	}
+
+	n.Handle(ethclient.GetBlocknumberMethod, func([]json.RawMessage) (interface{}, error) {
+		return fmt.Sprintf("0x%x", n.head), nil
+	})
+	n.Handle(ethclient.GetBlockByNumber, func(params []json.RawMessage) (interface{}, error) {
+		number, err := hexParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		block, ok := n.blocks[int(number)]
+		if !ok {
+			return nil, nil
+		}
+		return block, nil
+	})
+	n.Handle(ethclient.GetBlockReceipts, func(params []json.RawMessage) (interface{}, error) {
+		number, err := hexParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		block, ok := n.blocks[int(number)]
+		if !ok {
+			return nil, nil
+		}
+		receipts := make([]ethclient.Receipt, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			receipts[i] = n.receipts[tx.Hash]
+		}
+		return receipts, nil
+	})
+	n.Handle(ethclient.TraceBlockByNumber, func(params []json.RawMessage) (interface{}, error) {
+		number, err := hexParam(params[0])
+		if err != nil {
+			return nil, err
+		}
+		block, ok := n.blocks[int(number)]
+		if !ok {
+			return nil, fmt.Errorf("block %d not found", number)
+		}
+		traces := make([]ethclient.TransactionTrace, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			trace, ok := n.traces[tx.Hash]
+			if !ok {
+				trace = ethclient.CallFrame{Type: "CALL", From: tx.From, To: tx.To, Value: tx.Value}
+			}
+			traces[i] = ethclient.TransactionTrace{TxHash: tx.Hash, Result: trace}
+		}
+		return traces, nil
+	})
+	n.Handle(ethclient.GetBalance, func(params []json.RawMessage) (interface{}, error) {
+		var address string
+		if err := json.Unmarshal(params[0], &address); err != nil {
+			return nil, err
+		}
+		number, err := hexParam(params[1])
+		if err != nil {
+			return nil, err
+		}
+		balance, at := new(big.Int), -1
+		for block, b := range n.balances[address] {
+			if block <= int(number) && block > at {
+				balance, at = b, block
+			}
+		}
+		return fmt.Sprintf("0x%x", balance), nil
+	})
+	n.Handle(ethclient.GetTransactionCount, func(params []json.RawMessage) (interface{}, error) {
+		var address string
+		if err := json.Unmarshal(params[0], &address); err != nil {
+			return nil, err
+		}
+		number, err := hexParam(params[1])
+		if err != nil {
+			return nil, err
+		}
+		var count uint64
+		for block, b := range n.blocks {
+			if block > int(number) {
+				continue
+			}
+			for _, tx := range b.Transactions {
+				nonce, _ := strconv.ParseUint(strings.TrimPrefix(tx.Nonce, "0x"), 16, 64)
+				if tx.From == address && nonce+1 > count {
+					count = nonce + 1
+				}
+			}
+		}
+		return fmt.Sprintf("0x%x", count), nil
+	})
+	n.Handle(ethclient.GetTxReceipt, func(params []json.RawMessage) (interface{}, error) {
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		r, ok := n.receipts[hash]
+		if !ok {
+			return nil, nil
+		}
+		return r, nil
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(srv.Close)
+	n.URL = srv.URL
+	return n
+}
+
+// AddBlock adds the block to the chain, moving the head forward if needed.
+func (n *fakeNode) AddBlock(b ethclient.Block) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	b = complete(b)
+	number, _ := strconv.ParseInt(strings.TrimPrefix(b.Number, "0x"), 16, 64)
+	n.blocks[int(number)] = b
+	for i, tx := range b.Transactions {
+		if _, ok := n.receipts[tx.Hash]; ok {
+			continue
+		}
+		price := tx.GasPrice
+		if price == "" {
+			price = "0x1"
+		}
+		n.receipts[tx.Hash] = ethclient.Receipt{
+			TransactionHash:   tx.Hash,
+			TransactionIndex:  hexInt(i),
+			BlockNumber:       b.Number,
+			From:              tx.From,
+			To:                tx.To,
+			Status:            "0x1",
+			GasUsed:           "0x5208",
+			EffectiveGasPrice: price,
+		}
+	}
+	if int(number) > n.head {
+		n.head = int(number)
+	}
+}
+
+// SetReceipt overrides the receipt of a transaction. Receipts of added
+// blocks default to a successful 21000 gas transfer.
+func (n *fakeNode) SetReceipt(r ethclient.Receipt) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.receipts[r.TransactionHash] = r
+}
+
+// SetTrace overrides the call trace of a transaction. Transactions of
+// added blocks default to a call making no other call.
+func (n *fakeNode) SetTrace(hash string, trace ethclient.CallFrame) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.traces[hash] = trace
+}
+
+// SetBalance sets the balance of the address from the given block on.
+func (n *fakeNode) SetBalance(address string, block int, balance int64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.balances[address] == nil {
+		n.balances[address] = make(map[int]*big.Int)
+	}
+	n.balances[address][block] = big.NewInt(balance)
+}
+
+// Handle registers the handler of a JSON-RPC method.
+func (n *fakeNode) Handle(method string, h func(params []json.RawMessage) (interface{}, error)) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.methods[method] = h
+}
+
+// Calls returns the number of requests received for the JSON-RPC method.
+func (n *fakeNode) Calls(method string) int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.calls[method]
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int               `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.lock.Lock()
+	n.calls[req.Method]++
+	h, ok := n.methods[req.Method]
+	var (
+		result interface{}
+		err    error
+	)
+	if ok {
+		result, err = h(req.Params)
+	}
+	n.lock.Unlock()
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch {
+	case !ok:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	case err != nil:
+		resp["error"] = map[string]interface{}{"code": -32000, "message": err.Error()}
+	default:
+		resp["result"] = result
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// complete fills the transaction fields left out by the test blocks with
+// those of a plain transfer, as nodes always return them.
+func complete(b ethclient.Block) ethclient.Block {
+	txs := make([]ethclient.Transaction, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		if tx.BlockNumber == "" {
+			tx.BlockNumber = b.Number
+		}
+		if tx.TransactionIndex == "" {
+			tx.TransactionIndex = hexInt(i)
+		}
+		if tx.Type == "" {
+			tx.Type = "0x0"
+		}
+		if tx.Nonce == "" {
+			tx.Nonce = "0x0"
+		}
+		if tx.Gas == "" {
+			tx.Gas = "0x5208"
+		}
+		if tx.Value == "" {
+			tx.Value = "0x0"
+		}
+		if tx.Input == "" {
+			tx.Input = "0x"
+		}
+		txs[i] = tx
+	}
+	b.Transactions = txs
+	return b
+}
+
+func hexParam(raw json.RawMessage) (uint64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func hexInt(n int) string {
+	return fmt.Sprintf("0x%x", n)
+}
@@ -0,0 +1,270 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// DefaultNonceCheckInterval is the number of blocks between two checks of
+// the indexed outgoing nonces against on-chain transaction counts.
+const DefaultNonceCheckInterval = 100
+
+// WithNonceCheckInterval sets the number of blocks between two checks of
+// the outgoing nonces. Zero disables nonce tracking.
+func WithNonceCheckInterval(blocks int) Option {
+	return func(b *Blockscan) {
+		b.nonceCheckEvery = blocks
+	}
+}
+
+// nonceTracker records the outgoing nonces indexed for a sender since it
+// was anchored on the chain. Nonces below the transaction count at the
+// anchor block predate the subscription and are never reported.
+type nonceTracker struct {
+	AnchorBlock uint64 `json:"anchorBlock"`
+
+	// Next is the lowest nonce not known to be indexed: every nonce below
+	// it is indexed or predates the anchor.
+	Next uint64 `json:"next"`
+
+	// Seen holds the indexed nonces above Next, in ascending order.
+	Seen []uint64 `json:"seen"`
+
+	Highest   *big.Int       `json:"highest"`
+	Count     uint64         `json:"count"`
+	CheckedAt uint64         `json:"checkedAt"`
+	Gaps      []svc.NonceGap `json:"gaps"`
+}
+
+// record marks the nonce as indexed.
+func (t *nonceTracker) record(nonce *big.Int) {
+	if t.Highest == nil || nonce.Cmp(t.Highest) > 0 {
+		t.Highest = new(big.Int).Set(nonce)
+	}
+	if !nonce.IsUint64() || nonce.Uint64() < t.Next {
+		return
+	}
+	n := nonce.Uint64()
+	i := sort.Search(len(t.Seen), func(i int) bool { return t.Seen[i] >= n })
+	if i < len(t.Seen) && t.Seen[i] == n {
+		return
+	}
+	t.Seen = append(t.Seen, 0)
+	copy(t.Seen[i+1:], t.Seen[i:])
+	t.Seen[i] = n
+
+	for len(t.Seen) > 0 && t.Seen[0] == t.Next {
+		t.Seen = t.Seen[1:]
+		t.Next++
+	}
+	for i := 0; i < len(t.Gaps); i++ {
+		if t.Gaps[i].Nonce == n {
+			t.Gaps = append(t.Gaps[:i], t.Gaps[i+1:]...)
+			i--
+		}
+	}
+}
+
+// missing returns the nonces below count that were not indexed.
+func (t *nonceTracker) missing(count uint64) []uint64 {
+	var result []uint64
+	seen := t.Seen
+	for n := t.Next; n < count; n++ {
+		if len(seen) > 0 && seen[0] == n {
+			seen = seen[1:]
+			continue
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// trackNonces records the nonces of the outgoing transactions in the
+// batch, once the tracker of the address is anchored. The tracker is
+// swapped in atomically, so nonces recorded concurrently are never lost.
+func (b *Blockscan) trackNonces(address string, txs []svc.Transaction) error {
+	if b.nonceCheckEvery <= 0 {
+		return nil
+	}
+	return b.update(nonceKey(address), func(old []byte) ([]byte, error) {
+		if old == nil {
+			return nil, nil
+		}
+		var t nonceTracker
+		if err := json.Unmarshal(old, &t); err != nil {
+			return nil, fmt.Errorf("error unmarshaling nonce tracker: %w", err)
+		}
+
+		changed := false
+		for _, tx := range txs {
+			if tx.Kind == svc.KindTransaction && tx.Sender() == address && tx.Nonce != nil {
+				t.record(tx.Nonce.ToInt())
+				changed = true
+			}
+		}
+		if !changed {
+			return nil, nil
+		}
+		return marshalNonceTracker(t)
+	})
+}
+
+// CheckNonces compares the outgoing nonces indexed for every subscribed
+// address with its on-chain transaction count at the given block, which
+// must be the last scanned one. Each missing nonce is located by a binary
+// search over historical transaction counts and its block is rescanned.
+// Nonces still missing afterwards are reported as gaps.
+func (b *Blockscan) CheckNonces(block int) error {
+	return b.eachSubscription(func(address string) error {
+		return b.checkNonces(address, block)
+	})
+}
+
+// anchorNonceTrackers anchors the trackers of new subscriptions, so gaps
+// are detected from the first scanned block on.
+func (b *Blockscan) anchorNonceTrackers(block int) error {
+	return b.eachSubscription(func(address string) error {
+		if exist, _ := b.kvstate.Has(nonceKey(address)); exist {
+			return nil
+		}
+		return b.checkNonces(address, block)
+	})
+}
+
+func (b *Blockscan) checkNonces(address string, block int) error {
+	count, err := b.clt.TransactionCount(address, block)
+	if err != nil {
+		return fmt.Errorf("error querying transaction count of %s: %w", address, err)
+	}
+
+	t, ok, err := b.loadNonceTracker(address)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		t = nonceTracker{AnchorBlock: uint64(block), Next: count}
+		if txs, err := b.loadTxs(address); err == nil {
+			for _, tx := range txs {
+				if tx.Kind == svc.KindTransaction && tx.Sender() == address && tx.Nonce != nil {
+					t.record(tx.Nonce.ToInt())
+				}
+			}
+		}
+	}
+
+	located := make(map[uint64]uint64)
+	if missing := t.missing(count); len(missing) > 0 {
+		rescanned := make(map[uint64]bool)
+		for _, n := range missing {
+			at, err := b.locateNonce(address, n, t.AnchorBlock, uint64(block))
+			if err != nil {
+				fmt.Printf("error locating nonce %d of %s: %s\n", n, address, err)
+				continue
+			}
+			located[n] = at
+			if rescanned[at] {
+				continue
+			}
+			rescanned[at] = true
+
+			fmt.Printf("nonce gap for %s: rescanning block %d for nonce %d\n", address, at, n)
+			txs, err := b.ScanBlock(int(at))
+			if err != nil {
+				fmt.Printf("error rescanning block %d: %s\n", at, err)
+				continue
+			}
+			if err := b.SaveTxs(txs); err != nil {
+				fmt.Printf("error saving rescanned block %d: %s\n", at, err)
+			}
+		}
+	}
+
+	// The rescans, as well as the blocks saved meanwhile, recorded what
+	// they found in the stored tracker.
+	return b.update(nonceKey(address), func(old []byte) ([]byte, error) {
+		current := t
+		if old != nil {
+			current = nonceTracker{}
+			if err := json.Unmarshal(old, &current); err != nil {
+				return nil, fmt.Errorf("error unmarshaling nonce tracker: %w", err)
+			}
+		}
+		current.Gaps = nil
+		for _, n := range current.missing(count) {
+			current.Gaps = append(current.Gaps, svc.NonceGap{Nonce: n, Block: located[n]})
+		}
+		current.Count = count
+		current.CheckedAt = uint64(block)
+		return marshalNonceTracker(current)
+	})
+}
+
+// locateNonce returns the block in (low, high] whose transactions include
+// the given nonce of the address, that is the first block at which its
+// transaction count exceeds the nonce.
+func (b *Blockscan) locateNonce(address string, nonce, low, high uint64) (uint64, error) {
+	for low+1 < high {
+		mid := low + (high-low)/2
+		count, err := b.clt.TransactionCount(address, int(mid))
+		if err != nil {
+			return 0, err
+		}
+		if count > nonce {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high, nil
+}
+
+// eachSubscription calls fn with every subscribed address, in the order
+// of the subscription index.
+func (b *Blockscan) eachSubscription(fn func(address string) error) error {
+	addresses, err := b.indexMembers(subIndexKey, subPrefix)
+	if err != nil {
+		return fmt.Errorf("error listing subscriptions: %w", err)
+	}
+	for _, address := range addresses {
+		// The index is updated before subscribing and after
+		// unsubscribing, so it may list an address no longer
+		// subscribed.
+		if exist, _ := b.kvstate.Has(subKey(address)); !exist {
+			continue
+		}
+		if err := fn(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Blockscan) loadNonceTracker(address string) (nonceTracker, bool, error) {
+	var t nonceTracker
+	if exist, _ := b.kvstate.Has(nonceKey(address)); !exist {
+		return t, false, nil
+	}
+	values, err := b.kvstate.Get(nonceKey(address))
+	if err != nil {
+		return t, false, fmt.Errorf("error getting nonce tracker: %w", err)
+	}
+	if len(values) == 0 {
+		return t, false, nil
+	}
+	if err := json.Unmarshal(values[len(values)-1], &t); err != nil {
+		return t, false, fmt.Errorf("error unmarshaling nonce tracker: %w", err)
+	}
+	return t, true, nil
+}
+
+func marshalNonceTracker(t nonceTracker) ([]byte, error) {
+	value, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling nonce tracker: %w", err)
+	}
+	return value, nil
+}
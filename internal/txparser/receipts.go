@@ -0,0 +1,121 @@
+package txparser
+
+import (
+	"fmt"
+	"math/big"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
+)
+
+// receiptCache holds the receipts fetched for a block, so that they are
+// fetched once when the block is indexed for several tenants. It also
+// holds the authorizations of the block applied for each authority.
+type receiptCache struct {
+	block          bool
+	receipts       map[svc.Hash]ethclient.Receipt
+	authorizations map[svc.Address]map[string]bool
+}
+
+func newReceiptCache() *receiptCache {
+	return &receiptCache{
+		receipts:       make(map[svc.Hash]ethclient.Receipt),
+		authorizations: make(map[svc.Address]map[string]bool),
+	}
+}
+
+// attachReceipts sets the receipt and the fee paid on the matched
+// transactions of the block. Block receipts are fetched in one call when
+// the endpoint supports it, and one by one otherwise.
+func (b *Blockscan) attachReceipts(blockNumber int, matched map[string][]svc.Transaction, cache *receiptCache) error {
+	hashes := make(map[svc.Hash]bool)
+	for _, txs := range matched {
+		for _, tx := range txs {
+			if tx.Kind == svc.KindTransaction {
+				hashes[tx.Hash] = true
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	receipts := cache.receipts
+	if !cache.block {
+		cache.block = true
+		if all, err := b.clt.BlockReceipts(blockNumber); err == nil {
+			for _, r := range all {
+				// Receipts with a malformed hash are fetched one by one.
+				if hash, err := svc.ParseHash(r.TransactionHash); err == nil {
+					receipts[hash] = r
+				}
+			}
+		}
+	}
+	for hash := range hashes {
+		if _, ok := receipts[hash]; ok {
+			continue
+		}
+		r, err := b.clt.TransactionReceipt(hash.Hex())
+		if err != nil {
+			return fmt.Errorf("receipt of %s: %w", hash, err)
+		}
+		receipts[hash] = r
+	}
+
+	for _, txs := range matched {
+		for i := range txs {
+			r, ok := receipts[txs[i].Hash]
+			if !ok || txs[i].Kind != svc.KindTransaction {
+				continue
+			}
+			receipt, err := parseReceipt(r)
+			if err != nil {
+				return fmt.Errorf("receipt of %s: %w", txs[i].Hash, err)
+			}
+			txs[i].Receipt = receipt
+			txs[i].Fee = svc.NewBig(Fee(txs[i]))
+		}
+	}
+	return nil
+}
+
+func parseReceipt(r ethclient.Receipt) (*svc.Receipt, error) {
+	var d decoder
+	receipt := &svc.Receipt{
+		Status:            d.uint64("status", r.Status),
+		GasUsed:           d.big("gas used", r.GasUsed),
+		EffectiveGasPrice: d.optionalBig("effective gas price", r.EffectiveGasPrice),
+		BlobGasUsed:       d.optionalBig("blob gas used", r.BlobGasUsed),
+		BlobGasPrice:      d.optionalBig("blob gas price", r.BlobGasPrice),
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return receipt, nil
+}
+
+// Fee returns the amount charged to the sender of the transaction: the
+// gas used at the effective gas price, plus the blob gas used at the blob
+// gas price. It returns nil if the receipt is unknown.
+func Fee(tx svc.Transaction) *big.Int {
+	r := tx.Receipt
+	if r == nil || r.GasUsed == nil {
+		return nil
+	}
+	price := r.EffectiveGasPrice
+	if price == nil {
+		// Receipts predating London don't carry the effective price,
+		// which was then always the gas price.
+		price = tx.GasPrice
+	}
+	if price == nil {
+		return nil
+	}
+
+	fee := new(big.Int).Mul(r.GasUsed.ToInt(), price.ToInt())
+	if r.BlobGasUsed != nil && r.BlobGasPrice != nil {
+		fee.Add(fee, new(big.Int).Mul(r.BlobGasUsed.ToInt(), r.BlobGasPrice.ToInt()))
+	}
+	return fee
+}
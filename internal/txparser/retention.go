@@ -0,0 +1,89 @@
+package txparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PurgeExpired deletes the histories of unsubscribed addresses whose grace
+// period is over at the given time. It returns the number of purged
+// addresses.
+func (b *Blockscan) PurgeExpired(now time.Time) (int, error) {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return 0, fmt.Errorf("error listing keys: %w", err)
+	}
+
+	purged := 0
+	for _, key := range keys {
+		if !strings.HasPrefix(key, purgePrefix) {
+			continue
+		}
+		value, err := b.kvstate.Get(key)
+		if err != nil || len(value) == 0 {
+			continue
+		}
+		deadline, err := strconv.ParseInt(string(value[len(value)-1]), 10, 64)
+		if err != nil {
+			return purged, fmt.Errorf("error parsing deletion time of %s: %w", key, err)
+		}
+		if now.Unix() < deadline {
+			continue
+		}
+
+		if err := b.purgeHistory(strings.TrimPrefix(key, purgePrefix)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeHistory deletes the transaction history of the address along with
+// the records derived from it.
+func (b *Blockscan) purgeHistory(address string) error {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return fmt.Errorf("error listing keys: %w", err)
+	}
+
+	// The rollups of every address keep the activity of purged ones.
+	prefixes := []string{seenPrefix + address + ":", peerPrefix + address + ":", rollupPrefix + address + ":"}
+	for _, key := range keys {
+		if hasAnyPrefix(key, prefixes) {
+			if err := b.kvstate.Delete(key); err != nil {
+				return fmt.Errorf("error deleting %s: %w", key, err)
+			}
+		}
+	}
+	if err := b.kvstate.Delete(address); err != nil {
+		return fmt.Errorf("error deleting history: %w", err)
+	}
+	if err := b.kvstate.Delete(purgeKey(address)); err != nil {
+		return fmt.Errorf("error deleting history: %w", err)
+	}
+	if err := b.kvstate.Delete(ledgerKey(address)); err != nil {
+		return fmt.Errorf("error deleting ledger: %w", err)
+	}
+	if err := b.kvstate.Delete(nonceKey(address)); err != nil {
+		return fmt.Errorf("error deleting nonce tracker: %w", err)
+	}
+	if err := b.kvstate.Delete(statsKey(address)); err != nil {
+		return fmt.Errorf("error deleting statistics: %w", err)
+	}
+	if err := b.unindexHashes(address); err != nil {
+		return err
+	}
+	return nil
+}
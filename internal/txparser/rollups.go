@@ -0,0 +1,139 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// MaxRollupBuckets is the number of buckets a rollup query may span.
+const MaxRollupBuckets = 10000
+
+// rollupBuckets are the bucket sizes rolled up as entries are saved.
+var rollupBuckets = []svc.Bucket{svc.Hourly, svc.Daily}
+
+// updateRollups adds the entries, newly saved to the history of the
+// address, to the rollups of the address and, if total is set, of every
+// address. Entries without a block timestamp are left out. The rollups of
+// every address count an entry once, the first time it is saved for one
+// of the subscribed addresses, and sum the value received and sent by each
+// of them. Each rollup is swapped in atomically, so concurrent workers
+// never lose each other's counts.
+func (b *Blockscan) updateRollups(address string, txs []svc.Transaction, total bool) error {
+	type change struct {
+		start time.Time
+		added svc.Rollup
+	}
+	changed := make(map[string]*change)
+	for _, tx := range txs {
+		if tx.Timestamp == 0 {
+			continue
+		}
+		counted := false
+		if total {
+			ok, err := b.kvstate.CompareAndSwap(totalKey(tx.ID()), nil, nil)
+			if err != nil {
+				return fmt.Errorf("error marking rolled up entry: %w", err)
+			}
+			counted = !ok
+		}
+
+		f := flowOf(address, tx)
+		for _, bucket := range rollupBuckets {
+			start := bucket.Start(tx.Time())
+			keys := []string{rollupKey(address, bucket, start)}
+			if total {
+				keys = append(keys, rollupKey(allScope, bucket, start))
+			}
+			for i, key := range keys {
+				c, ok := changed[key]
+				if !ok {
+					c = &change{start: start, added: emptyRollup(start)}
+					changed[key] = c
+				}
+				if i == 0 || !counted {
+					c.added.Count++
+				}
+				c.added.ValueIn.Add(c.added.ValueIn, f.in)
+				c.added.ValueOut.Add(c.added.ValueOut, f.out)
+				c.added.Fees.Add(c.added.Fees, f.fee)
+			}
+		}
+	}
+
+	for key, c := range changed {
+		err := b.update(key, func(old []byte) ([]byte, error) {
+			r := emptyRollup(c.start)
+			if old != nil {
+				if err := json.Unmarshal(old, &r); err != nil {
+					return nil, fmt.Errorf("error unmarshaling rollup: %w", err)
+				}
+			}
+			r.Count += c.added.Count
+			r.ValueIn.Add(r.ValueIn, c.added.ValueIn)
+			r.ValueOut.Add(r.ValueOut, c.added.ValueOut)
+			r.Fees.Add(r.Fees, c.added.Fees)
+			value, err := json.Marshal(r)
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling rollup: %w", err)
+			}
+			return value, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollups returns the rollups of the scope for every bucket overlapping
+// the time range, including the empty ones.
+func (b *Blockscan) rollups(scope string, bucket svc.Bucket, from, to time.Time) ([]svc.Rollup, error) {
+	d := bucket.Duration()
+	if d == 0 {
+		return nil, fmt.Errorf("%w: unknown bucket size %q", svc.ErrInvalidRange, bucket)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: %s is before %s", svc.ErrInvalidRange, to, from)
+	}
+	start, end := bucket.Start(from), bucket.Start(to)
+	if n := end.Sub(start)/d + 1; n > MaxRollupBuckets {
+		return nil, fmt.Errorf("%w: %d buckets, at most %d", svc.ErrInvalidRange, n, MaxRollupBuckets)
+	}
+
+	var result []svc.Rollup
+	for t := start; !t.After(end); t = t.Add(d) {
+		r, err := b.loadRollup(rollupKey(scope, bucket, t), t)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// loadRollup returns the rollup stored at key, empty if none was saved.
+func (b *Blockscan) loadRollup(key string, start time.Time) (svc.Rollup, error) {
+	r := emptyRollup(start)
+	if exist, _ := b.kvstate.Has(key); !exist {
+		return r, nil
+	}
+	values, err := b.kvstate.Get(key)
+	if err != nil {
+		return r, fmt.Errorf("error getting rollup: %w", err)
+	}
+	if len(values) == 0 {
+		return r, nil
+	}
+	if err := json.Unmarshal(values[len(values)-1], &r); err != nil {
+		return r, fmt.Errorf("error unmarshaling rollup: %w", err)
+	}
+	return r, nil
+}
+
+func emptyRollup(start time.Time) svc.Rollup {
+	return svc.Rollup{Start: start, ValueIn: new(big.Int), ValueOut: new(big.Int), Fees: new(big.Int)}
+}
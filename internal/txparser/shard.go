@@ -0,0 +1,454 @@
+package txparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRangeLost is returned by Run when the lease of the block range of the
+// worker was taken over by another worker. The block is left to it.
+var ErrRangeLost = errors.New("block range lease lost")
+
+// Default settings of sharded scanning.
+const (
+	DefaultShardRangeSize = 100
+	DefaultShardLeaseTTL  = time.Minute
+)
+
+// shard is the sharding state of a worker.
+type shard struct {
+	worker    string
+	rangeSize int
+	leaseTTL  time.Duration
+
+	// held is the key of the block range leased by the worker, empty
+	// if none.
+	held string
+}
+
+// blockRange is a range of blocks scanned by one worker at a time. The
+// worker holds a lease on the range, renewed with every scanned block.
+// Once the lease expires the range is taken over by another worker.
+type blockRange struct {
+	Start      int       `json:"start"`
+	End        int       `json:"end"`
+	Scanned    int       `json:"scanned"`
+	Owner      string    `json:"owner"`
+	LeaseUntil time.Time `json:"leaseUntil"`
+}
+
+func (r blockRange) done() bool {
+	return r.Scanned >= r.End
+}
+
+// WithSharding splits the scanning between the workers sharing the store.
+// Workers claim ranges of rangeSize blocks, leased for leaseTTL and renewed
+// with every scanned block, so that a range is taken over by another
+// worker when its owner stops. Blocks are indexed out of order: the
+// checkpoint follows the last block up to which every block is scanned,
+// and the balance reconciliation and the nonce checks run as it moves.
+func WithSharding(worker string, rangeSize int, leaseTTL time.Duration) Option {
+	return func(b *Blockscan) {
+		if rangeSize <= 0 {
+			rangeSize = DefaultShardRangeSize
+		}
+		if leaseTTL <= 0 {
+			leaseTTL = DefaultShardLeaseTTL
+		}
+		b.shard = &shard{
+			worker:    worker,
+			rangeSize: rangeSize,
+			leaseTTL:  leaseTTL,
+		}
+	}
+}
+
+// runShard scans the next block of the range leased by the worker,
+// claiming a range first if it holds none. It returns 0 when there is no
+// block to scan. The lease is renewed before the entries of the block are
+// saved, and the block recorded as scanned in the range only once they
+// are, so a range taken over meanwhile is never written behind its new
+// owner and a block which failed is scanned again. It fails with
+// ErrRangeLost when the lease was lost.
+func (b *Blockscan) runShard() (int, error) {
+	headBlock, err := b.clt.BlockNumber()
+	if err != nil {
+		fmt.Println("error querying head block number: ", err)
+		return 0, err
+	}
+
+	key, r, raw, err := b.claimRange(headBlock)
+	if err != nil || key == "" {
+		return 0, err
+	}
+	next := r.Scanned + 1
+	if next > headBlock {
+		return 0, nil
+	}
+
+	renew := func() error {
+		if err := b.fence(); err != nil {
+			return err
+		}
+		renewed := r
+		renewed.LeaseUntil = time.Now().Add(b.shard.leaseTTL)
+		ok, err := b.swapRange(key, raw, renewed)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			b.shard.held = ""
+			return fmt.Errorf("%w: blocks %d-%d", ErrRangeLost, r.Start, r.End)
+		}
+		r = renewed
+		raw, err = json.Marshal(r)
+		return err
+	}
+	if _, err := b.index(next, renew); err != nil {
+		return 0, err
+	}
+
+	r.Scanned = next
+	r.LeaseUntil = time.Now().Add(b.shard.leaseTTL)
+	ok, err := b.swapRange(key, raw, r)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		// The entries are saved, and saved again by the new owner.
+		b.shard.held = ""
+		return 0, fmt.Errorf("%w: blocks %d-%d", ErrRangeLost, r.Start, r.End)
+	}
+	b.setScanned(next)
+	if r.done() {
+		b.shard.held = ""
+	}
+
+	from, to, err := b.advanceCheckpoint()
+	if err != nil {
+		fmt.Println("error saving checkpoint: ", err)
+	}
+	if to > from {
+		if err := b.pruneRanges(to); err != nil {
+			fmt.Println("error pruning block ranges: ", err)
+		}
+	}
+	for block := from + 1; block <= to; block++ {
+		for _, s := range b.scanners() {
+			s.afterBlock(block)
+		}
+	}
+	return next, nil
+}
+
+// advanceCheckpoint moves the checkpoint up to the low-water mark of the
+// block ranges, the last block up to which every block is scanned, so the
+// scanning resumes from there without sharding. It returns the previous
+// and the new checkpoint, equal when it did not move.
+func (b *Blockscan) advanceCheckpoint() (int, int, error) {
+	mark, ok, err := b.lowWaterMark()
+	if err != nil || !ok || mark <= 0 {
+		return 0, 0, err
+	}
+
+	from := mark
+	err = b.update(checkpointKey, func(old []byte) ([]byte, error) {
+		from = mark - 1
+		if old != nil {
+			checkpoint, err := strconv.Atoi(string(old))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing checkpoint: %w", err)
+			}
+			if checkpoint >= mark {
+				from = mark
+				return nil, nil
+			}
+			from = checkpoint
+		}
+		return []byte(strconv.Itoa(mark)), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, mark, nil
+}
+
+// lowWaterMark returns the last block up to which every block of the
+// claimed ranges is scanned. It reports false when no range was claimed
+// since the last pruning.
+func (b *Blockscan) lowWaterMark() (int, bool, error) {
+	mark, found := 0, false
+	err := b.eachRange(func(key string, r blockRange, raw []byte) (bool, error) {
+		// Ranges are contiguous, so the first one not done holds the mark.
+		if !r.done() {
+			mark, found = r.Scanned, true
+			return false, nil
+		}
+		mark, found = r.End, true
+		return true, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return mark, found, nil
+}
+
+// eachRange calls fn with the block ranges not pruned, in block order,
+// until fn returns false. Each range starts after the end of the previous
+// one, so they are found without listing the store.
+func (b *Blockscan) eachRange(fn func(key string, r blockRange, raw []byte) (bool, error)) error {
+	start, err := b.firstRange()
+	if err != nil || start == 0 {
+		return err
+	}
+	for {
+		key := shardRangeKey(start)
+		if exist, _ := b.kvstate.Has(key); !exist {
+			return nil
+		}
+		r, raw, err := b.loadRange(key)
+		if err != nil {
+			return err
+		}
+		if more, err := fn(key, r, raw); err != nil || !more {
+			return err
+		}
+		start = r.End + 1
+	}
+}
+
+// firstRange returns the first block of the first block range not pruned,
+// 0 if no range was claimed. Stores written before it was kept get it
+// from their ranges once.
+func (b *Blockscan) firstRange() (int, error) {
+	raw, err := b.current(shardFirstKey)
+	if err != nil {
+		return 0, fmt.Errorf("error getting first block range: %w", err)
+	}
+	if raw == nil {
+		if exist, _ := b.kvstate.Has(shardNextKey); !exist {
+			return 0, nil
+		}
+		if raw, err = b.initFirstRange(); err != nil {
+			return 0, err
+		}
+	}
+	start, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing first block range: %w", err)
+	}
+	return start, nil
+}
+
+// initFirstRange saves the first block of the lowest block range stored,
+// or of the next range if there is none, and returns the saved value.
+func (b *Blockscan) initFirstRange() ([]byte, error) {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing block ranges: %w", err)
+	}
+	sort.Strings(keys)
+	first := ""
+	for _, key := range keys {
+		if strings.HasPrefix(key, shardRangePrefix) {
+			start, err := strconv.Atoi(strings.TrimPrefix(key, shardRangePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing block range key: %w", err)
+			}
+			first = strconv.Itoa(start)
+			break
+		}
+	}
+	if first == "" {
+		values, err := b.kvstate.Get(shardNextKey)
+		if err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("error getting next block range: %v", err)
+		}
+		first = string(values[len(values)-1])
+	}
+	if _, err := b.kvstate.CompareAndSwap(shardFirstKey, nil, []byte(first)); err != nil {
+		return nil, fmt.Errorf("error saving first block range: %w", err)
+	}
+	return b.current(shardFirstKey)
+}
+
+// pruneRanges deletes the block ranges scanned up to the checkpoint. The
+// first range is moved past them before they are deleted, so only the
+// worker moving it deletes them, and ranges are never looked up from a
+// deleted one.
+func (b *Blockscan) pruneRanges(checkpoint int) error {
+	first, err := b.firstRange()
+	if err != nil || first == 0 {
+		return err
+	}
+	var pruned []string
+	next := first
+	err = b.eachRange(func(key string, r blockRange, raw []byte) (bool, error) {
+		if !r.done() || r.End > checkpoint {
+			return false, nil
+		}
+		pruned = append(pruned, key)
+		next = r.End + 1
+		return true, nil
+	})
+	if err != nil || len(pruned) == 0 {
+		return err
+	}
+	ok, err := b.kvstate.CompareAndSwap(shardFirstKey, []byte(strconv.Itoa(first)), []byte(strconv.Itoa(next)))
+	if err != nil {
+		return fmt.Errorf("error moving first block range: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	for _, key := range pruned {
+		if err := b.kvstate.Delete(key); err != nil {
+			return fmt.Errorf("error deleting block range: %w", err)
+		}
+	}
+	return nil
+}
+
+// claimRange returns the block range leased by the worker, with its raw
+// value. The lease of the held range is renewed, otherwise an expired
+// range is taken over or a new range is claimed. It returns an empty key
+// when no range is available.
+func (b *Blockscan) claimRange(headBlock int) (string, blockRange, []byte, error) {
+	now := time.Now()
+	lease := func(key string, r blockRange, raw []byte) (string, blockRange, []byte, error) {
+		r.Owner = b.shard.worker
+		r.LeaseUntil = now.Add(b.shard.leaseTTL)
+		ok, err := b.swapRange(key, raw, r)
+		if err != nil || !ok {
+			return "", blockRange{}, nil, err
+		}
+		b.shard.held = key
+		value, _ := json.Marshal(r)
+		return key, r, value, nil
+	}
+
+	// The held range is pruned once taken over and scanned by another
+	// worker.
+	if key := b.shard.held; key != "" {
+		if exist, _ := b.kvstate.Has(key); !exist {
+			b.shard.held = ""
+		}
+	}
+	if key := b.shard.held; key != "" {
+		r, raw, err := b.loadRange(key)
+		if err != nil {
+			return "", blockRange{}, nil, err
+		}
+		if r.Owner == b.shard.worker && !r.done() {
+			return lease(key, r, raw)
+		}
+		b.shard.held = ""
+	}
+
+	var (
+		claimed string
+		r       blockRange
+		raw     []byte
+	)
+	err := b.eachRange(func(key string, open blockRange, openRaw []byte) (bool, error) {
+		if open.done() || !now.After(open.LeaseUntil) {
+			return true, nil
+		}
+		var err error
+		claimed, r, raw, err = lease(key, open, openRaw)
+		return claimed == "", err
+	})
+	if err != nil || claimed != "" {
+		return claimed, r, raw, err
+	}
+
+	return b.newRange(headBlock, lease)
+}
+
+// newRange claims the range starting at the next unclaimed block, if it
+// is not past the head block.
+func (b *Blockscan) newRange(headBlock int, lease func(string, blockRange, []byte) (string, blockRange, []byte, error)) (string, blockRange, []byte, error) {
+	var start int
+	var raw []byte
+	if exist, _ := b.kvstate.Has(shardNextKey); exist {
+		values, err := b.kvstate.Get(shardNextKey)
+		if err != nil || len(values) == 0 {
+			return "", blockRange{}, nil, fmt.Errorf("error getting next block range: %v", err)
+		}
+		raw = values[len(values)-1]
+		if start, err = strconv.Atoi(string(raw)); err != nil {
+			return "", blockRange{}, nil, fmt.Errorf("error parsing next block range: %w", err)
+		}
+	} else {
+		start = nextBlock(b.scanned(), headBlock)
+	}
+	if start == 0 || start > headBlock {
+		return "", blockRange{}, nil, nil
+	}
+	if raw == nil {
+		// The first range ever claimed is the first one of the walk.
+		if _, err := b.kvstate.CompareAndSwap(shardFirstKey, nil, []byte(strconv.Itoa(start))); err != nil {
+			return "", blockRange{}, nil, fmt.Errorf("error saving first block range: %w", err)
+		}
+	}
+
+	// The range is created before the next range is moved past it, so a
+	// worker stopping in between never leaves blocks unclaimed: the other
+	// workers move it when they fail to create the same range.
+	r := blockRange{Start: start, End: start + b.shard.rangeSize - 1, Scanned: start - 1}
+	key, r, value, err := lease(shardRangeKey(start), r, nil)
+	if err != nil {
+		return "", blockRange{}, nil, err
+	}
+	if key != "" && raw != nil {
+		// The range was created again after being scanned and pruned
+		// while this worker was reading the next range.
+		checkpoint, ok, err := b.loadCheckpoint()
+		if err != nil {
+			return "", blockRange{}, nil, err
+		}
+		if ok && checkpoint >= start {
+			b.shard.held = ""
+			if err := b.kvstate.Delete(key); err != nil {
+				return "", blockRange{}, nil, fmt.Errorf("error deleting block range: %w", err)
+			}
+			return "", blockRange{}, nil, nil
+		}
+	}
+	if _, err := b.kvstate.CompareAndSwap(shardNextKey, raw, []byte(strconv.Itoa(start+b.shard.rangeSize))); err != nil {
+		return "", blockRange{}, nil, fmt.Errorf("error moving next block range: %w", err)
+	}
+	return key, r, value, nil
+}
+
+// swapRange replaces the block range stored at key if its value is still
+// raw, nil meaning it does not exist yet.
+func (b *Blockscan) swapRange(key string, raw []byte, r blockRange) (bool, error) {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return false, fmt.Errorf("error marshaling block range: %w", err)
+	}
+	ok, err := b.kvstate.CompareAndSwap(key, raw, value)
+	if err != nil {
+		return false, fmt.Errorf("error leasing block range: %w", err)
+	}
+	return ok, nil
+}
+
+func (b *Blockscan) loadRange(key string) (blockRange, []byte, error) {
+	values, err := b.kvstate.Get(key)
+	if err != nil || len(values) == 0 {
+		return blockRange{}, nil, fmt.Errorf("error getting block range: %v", err)
+	}
+	raw := values[len(values)-1]
+	var r blockRange
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return blockRange{}, nil, fmt.Errorf("error unmarshaling block range: %w", err)
+	}
+	return r, raw, nil
+}
@@ -0,0 +1,75 @@
+package txparser
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
+)
+
+// Export writes a snapshot of the store to w: subscriptions, histories,
+// tenants and the scan checkpoint. The leases of the scanning copies and
+// workers are left out. Scanning is paused meanwhile, so the checkpoint,
+// markers and statistics of the snapshot match its histories. It returns
+// the number of keys written.
+func (s *Service) Export(w io.Writer) (int, error) {
+	lock := s.pauseLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	return state.Export(w, s.kvstate, isLeaseKey)
+}
+
+// Import replaces the contents of the store with the snapshot read from r
+// and resumes scanning from its checkpoint. The leases held in the store
+// are kept. Scanning is paused meanwhile, so no block is saved into a half
+// restored store. It returns the number of keys restored.
+func (s *Service) Import(r io.ReadSeeker) (int, error) {
+	lock := s.pauseLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	n, err := state.Import(r, s.kvstate, isLeaseKey)
+	if err != nil {
+		return n, err
+	}
+
+	block, ok, err := s.loadCheckpoint()
+	if err != nil {
+		return n, err
+	}
+	if ok {
+		s.setScanned(block)
+	}
+	return n, nil
+}
+
+// pauseLock returns the lock held while blocks are scanned, the one of the
+// parent for tenant scanners.
+func (b *Blockscan) pauseLock() *sync.Mutex {
+	if b.parent != nil {
+		return &b.parent.scanLock
+	}
+	return &b.scanLock
+}
+
+// loadCheckpoint returns the last scanned block saved in the store.
+func (b *Blockscan) loadCheckpoint() (int, bool, error) {
+	if exist, _ := b.kvstate.Has(checkpointKey); !exist {
+		return 0, false, nil
+	}
+	values, err := b.kvstate.Get(checkpointKey)
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting checkpoint: %w", err)
+	}
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	block, err := strconv.Atoi(string(values[len(values)-1]))
+	if err != nil {
+		return 0, false, fmt.Errorf("error parsing checkpoint: %w", err)
+	}
+	return block, true, nil
+}
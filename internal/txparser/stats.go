@@ -0,0 +1,164 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// updateStats adds the entries, newly saved to the history of the address,
+// to its statistics. Counterparties are counted once, the ones already
+// counted being marked under the address. Markers are claimed and the
+// statistics swapped in atomically, so workers saving entries of the same
+// address concurrently never lose each other's counts.
+func (b *Blockscan) updateStats(address string, txs []svc.Transaction) error {
+	var counterparties uint64
+	for _, tx := range txs {
+		counterparty := flowOf(address, tx).counterparty
+		if counterparty == "" {
+			continue
+		}
+		ok, err := b.kvstate.CompareAndSwap(peerKey(address, counterparty), nil, nil)
+		if err != nil {
+			return fmt.Errorf("error marking counterparty: %w", err)
+		}
+		if ok {
+			counterparties++
+		}
+	}
+
+	return b.update(statsKey(address), func(old []byte) ([]byte, error) {
+		stats := newStats()
+		if old != nil {
+			if err := json.Unmarshal(old, &stats); err != nil {
+				return nil, fmt.Errorf("error unmarshaling statistics: %w", err)
+			}
+		}
+		for _, tx := range txs {
+			addToStats(&stats, address, tx)
+		}
+		stats.Counterparties += counterparties
+		value, err := json.Marshal(stats)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling statistics: %w", err)
+		}
+		return value, nil
+	})
+}
+
+// rebuildStats recomputes the statistics of the address from its whole
+// history.
+func (b *Blockscan) rebuildStats(address string, txs []svc.Transaction) error {
+	keys, err := b.kvstate.List()
+	if err != nil {
+		return fmt.Errorf("error listing keys: %w", err)
+	}
+	prefix := peerPrefix + address + ":"
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			if err := b.kvstate.Delete(key); err != nil {
+				return fmt.Errorf("error deleting %s: %w", key, err)
+			}
+		}
+	}
+	if err := b.kvstate.Delete(statsKey(address)); err != nil {
+		return fmt.Errorf("error deleting statistics: %w", err)
+	}
+	return b.updateStats(address, txs)
+}
+
+// addToStats adds the entry to the statistics of the address, except for
+// the counterparties. It returns the counterparty of the entry, empty if
+// it has none.
+func addToStats(stats *svc.Stats, address string, tx svc.Transaction) string {
+	f := flowOf(address, tx)
+	stats.Transactions++
+	if tx.BlockNumber != 0 {
+		block := uint64(tx.BlockNumber)
+		if stats.FirstBlock == 0 || block < stats.FirstBlock {
+			stats.FirstBlock = block
+		}
+		if block > stats.LastBlock {
+			stats.LastBlock = block
+		}
+	}
+	if f.incoming {
+		stats.Incoming++
+	}
+	if f.outgoing {
+		stats.Outgoing++
+	}
+	stats.ValueIn.Add(stats.ValueIn, f.in)
+	stats.ValueOut.Add(stats.ValueOut, f.out)
+	stats.Fees.Add(stats.Fees, f.fee)
+	return f.counterparty
+}
+
+// flow is what an entry moves in and out of an address.
+type flow struct {
+	incoming, outgoing bool
+	in, out, fee       *big.Int
+
+	// counterparty is the other side of the entry, empty if none.
+	counterparty string
+}
+
+// flowOf returns the flow of the entry for the address. Failed
+// transactions transfer no value but are still charged, as in Delta.
+func flowOf(address string, tx svc.Transaction) flow {
+	address = strings.ToLower(address)
+	from, to := tx.Sender(), tx.Recipient()
+	f := flow{in: new(big.Int), out: new(big.Int), fee: new(big.Int)}
+
+	isTransaction := tx.Kind == svc.KindTransaction || tx.Kind == ""
+	succeeded := tx.Receipt == nil || tx.Receipt.Status == 1
+	transfers := tx.Value != nil && (tx.Kind == svc.KindWithdrawal || tx.Kind == svc.KindInternal || (isTransaction && succeeded))
+	if to == address {
+		f.incoming = true
+		if transfers {
+			f.in.Set(tx.Value.ToInt())
+		}
+		f.counterparty = from
+	}
+	if from == address {
+		f.outgoing = true
+		if transfers {
+			f.out.Set(tx.Value.ToInt())
+		}
+		if isTransaction && tx.Fee != nil {
+			f.fee.Set(tx.Fee.ToInt())
+		}
+		f.counterparty = to
+	}
+	if f.counterparty == address {
+		f.counterparty = ""
+	}
+	return f
+}
+
+// loadStats returns the statistics of the address, zero if none were
+// saved.
+func (b *Blockscan) loadStats(address string) (svc.Stats, error) {
+	stats := newStats()
+	if exist, _ := b.kvstate.Has(statsKey(address)); !exist {
+		return stats, nil
+	}
+	values, err := b.kvstate.Get(statsKey(address))
+	if err != nil {
+		return stats, fmt.Errorf("error getting statistics: %w", err)
+	}
+	if len(values) == 0 {
+		return stats, nil
+	}
+	if err := json.Unmarshal(values[len(values)-1], &stats); err != nil {
+		return stats, fmt.Errorf("error unmarshaling statistics: %w", err)
+	}
+	return stats, nil
+}
+
+func newStats() svc.Stats {
+	return svc.Stats{ValueIn: new(big.Int), ValueOut: new(big.Int), Fees: new(big.Int)}
+}
@@ -0,0 +1,82 @@
+package txparser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// GetSubscription returns the registry details of the subscribed address.
+func (s *Service) GetSubscription(address string) (svc.Subscription, bool) {
+	sub, err := s.V2().GetSubscription(context.Background(), address)
+	if err != nil {
+		if !errors.Is(err, svc.ErrNotSubscribed) {
+			fmt.Println("error getting subscription: ", err)
+		}
+		return svc.Subscription{}, false
+	}
+	return sub, true
+}
+
+// ListSubscriptions returns the subscriptions matching the filter, sorted
+// by address. The zero filter returns every active subscription.
+func (s *Service) ListSubscriptions(filter svc.SubscriptionFilter) []svc.Subscription {
+	subs, err := s.V2().ListSubscriptions(context.Background(), filter)
+	if err != nil {
+		fmt.Println("error listing subscriptions: ", err)
+		return nil
+	}
+	return subs
+}
+
+// subscribed reports whether transactions of the address are scanned: it
+// has a subscription which is not expired.
+func (b *Blockscan) subscribed(address string) bool {
+	if exist, _ := b.kvstate.Has(subKey(address)); !exist {
+		return false
+	}
+	sub, ok, err := b.loadSubscription(address)
+	if err != nil || !ok {
+		return false
+	}
+	return !sub.Expired(time.Now())
+}
+
+// loadSubscription returns the registry entry of the address. Addresses
+// subscribed before the registry existed get a bare entry.
+func (b *Blockscan) loadSubscription(address string) (svc.Subscription, bool, error) {
+	exist, err := b.kvstate.Has(subKey(address))
+	if err != nil {
+		return svc.Subscription{}, false, fmt.Errorf("error getting subscription: %w", err)
+	}
+	if !exist {
+		return svc.Subscription{}, false, nil
+	}
+	values, err := b.kvstate.Get(subKey(address))
+	if err != nil {
+		return svc.Subscription{}, false, fmt.Errorf("error getting subscription: %w", err)
+	}
+	sub := svc.Subscription{Address: address}
+	if len(values) == 0 || len(values[len(values)-1]) == 0 {
+		return sub, true, nil
+	}
+	if err := json.Unmarshal(values[len(values)-1], &sub); err != nil {
+		return svc.Subscription{}, false, fmt.Errorf("error unmarshaling subscription: %w", err)
+	}
+	return sub, true, nil
+}
+
+func (b *Blockscan) saveSubscription(sub svc.Subscription) error {
+	value, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("error marshaling subscription: %w", err)
+	}
+	if err := b.addToIndex(subIndexKey, subPrefix, sub.Address); err != nil {
+		return fmt.Errorf("error indexing subscription: %w", err)
+	}
+	return b.set(subKey(sub.Address), value)
+}
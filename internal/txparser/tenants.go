@@ -0,0 +1,221 @@
+package txparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
+)
+
+// validTenantID restricts tenant IDs to characters that can't be mistaken
+// for a key separator.
+var validTenantID = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// CreateTenant registers the tenant, or replaces its filters and delivery
+// targets if it already exists. Returns false if the ID is invalid, if a
+// delivery target is not an http or https URL, or when called on the
+// parser of a tenant.
+func (s *Service) CreateTenant(t svc.Tenant) bool {
+	t.ID = strings.ToLower(t.ID)
+	if s.parent != nil || !validTenantID.MatchString(t.ID) {
+		return false
+	}
+	for _, target := range t.DeliveryTargets {
+		if err := checkDeliveryTarget(target); err != nil {
+			fmt.Println("error saving tenant: ", err)
+			return false
+		}
+	}
+	if prev, ok, _ := s.loadTenant(t.ID); ok {
+		t.CreatedAt = prev.CreatedAt
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC()
+	}
+
+	value, err := json.Marshal(t)
+	if err != nil {
+		fmt.Println("error marshaling tenant: ", err)
+		return false
+	}
+	if err := s.addToIndex(tenantIndexKey, tenantPrefix, t.ID); err != nil {
+		fmt.Println("error indexing tenant: ", err)
+		return false
+	}
+	if err := s.set(tenantKey(t.ID), value); err != nil {
+		fmt.Println("error saving tenant: ", err)
+		return false
+	}
+	s.tenantScanner(t)
+	return true
+}
+
+// GetTenant returns the registry details of the tenant.
+func (s *Service) GetTenant(id string) (svc.Tenant, bool) {
+	if s.parent != nil {
+		return svc.Tenant{}, false
+	}
+	t, ok, err := s.loadTenant(strings.ToLower(id))
+	if err != nil {
+		fmt.Println(err)
+		return svc.Tenant{}, false
+	}
+	return t, ok
+}
+
+// ListTenants returns the registered tenants sorted by ID.
+func (s *Service) ListTenants() []svc.Tenant {
+	if s.parent != nil {
+		return nil
+	}
+	tenants, err := s.loadTenants()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return tenants
+}
+
+// DeleteTenant removes the tenant along with its subscriptions and
+// histories. Returns false if the tenant does not exist.
+func (s *Service) DeleteTenant(id string) bool {
+	id = strings.ToLower(id)
+	if _, ok := s.GetTenant(id); !ok {
+		return false
+	}
+	if err := s.kvstate.Delete(tenantKey(id)); err != nil {
+		fmt.Println("error deleting tenant: ", err)
+		return false
+	}
+	if err := s.removeFromIndex(tenantIndexKey, tenantPrefix, id); err != nil {
+		fmt.Println("error unindexing tenant: ", err)
+		return false
+	}
+
+	s.tenantsLock.Lock()
+	delete(s.tenants, id)
+	s.tenantsLock.Unlock()
+
+	keys, err := s.kvstate.List()
+	if err != nil {
+		fmt.Println("error listing keys: ", err)
+		return false
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, tenantNamespace(id)) {
+			if err := s.kvstate.Delete(key); err != nil {
+				fmt.Println("error deleting tenant data: ", err)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Tenant returns the parser of the tenant. Its calls only see the
+// subscriptions and histories of the tenant, while scanning is still
+// done once by the shared parser.
+func (s *Service) Tenant(id string) (*Service, bool) {
+	t, ok := s.GetTenant(id)
+	if !ok {
+		return nil, false
+	}
+	child := s.tenantScanner(t)
+	return &Service{
+		kvstate:   child.kvstate,
+		Blockscan: child,
+	}, true
+}
+
+// tenantScanner returns the scanner of the tenant, creating it on first
+// use. The scanner works on the tenant namespace of the store.
+func (b *Blockscan) tenantScanner(t svc.Tenant) *Blockscan {
+	b.tenantsLock.Lock()
+	defer b.tenantsLock.Unlock()
+
+	if b.tenants == nil {
+		b.tenants = make(map[string]*Blockscan)
+	}
+	child, ok := b.tenants[t.ID]
+	if !ok {
+		child = &Blockscan{
+			ctx:             b.ctx,
+			kvstate:         state.NewPrefixed(b.kvstate, tenantNamespace(t.ID)),
+			clt:             b.clt,
+			abis:            b.abis,
+			reconcileEvery:  b.reconcileEvery,
+			nonceCheckEvery: b.nonceCheckEvery,
+			parent:          b,
+		}
+		b.tenants[t.ID] = child
+	}
+	child.tenant = &t
+	return child
+}
+
+// scanners returns the scanners a block is indexed for: this one followed
+// by the scanners of the registered tenants.
+func (b *Blockscan) scanners() []*Blockscan {
+	result := []*Blockscan{b}
+	tenants, err := b.loadTenants()
+	if err != nil {
+		fmt.Println(err)
+		return result
+	}
+
+	active := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		active[t.ID] = true
+		result = append(result, b.tenantScanner(t))
+	}
+
+	b.tenantsLock.Lock()
+	for id := range b.tenants {
+		if !active[id] {
+			delete(b.tenants, id)
+		}
+	}
+	b.tenantsLock.Unlock()
+	return result
+}
+
+// loadTenants returns the tenants of the tenant index, sorted by ID.
+func (b *Blockscan) loadTenants() ([]svc.Tenant, error) {
+	ids, err := b.indexMembers(tenantIndexKey, tenantPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tenants: %w", err)
+	}
+	var tenants []svc.Tenant
+	for _, id := range ids {
+		t, ok, err := b.loadTenant(id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tenants = append(tenants, t)
+		}
+	}
+	return tenants, nil
+}
+
+func (b *Blockscan) loadTenant(id string) (svc.Tenant, bool, error) {
+	if exist, _ := b.kvstate.Has(tenantKey(id)); !exist {
+		return svc.Tenant{}, false, nil
+	}
+	values, err := b.kvstate.Get(tenantKey(id))
+	if err != nil {
+		return svc.Tenant{}, false, fmt.Errorf("error getting tenant: %w", err)
+	}
+	if len(values) == 0 {
+		return svc.Tenant{}, false, nil
+	}
+	var t svc.Tenant
+	if err := json.Unmarshal(values[len(values)-1], &t); err != nil {
+		return svc.Tenant{}, false, fmt.Errorf("error unmarshaling tenant: %w", err)
+	}
+	return t, true, nil
+}
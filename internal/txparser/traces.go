@@ -0,0 +1,134 @@
+package txparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/ethclient"
+)
+
+// rpcMethodNotFound is the JSON-RPC error code of unknown methods.
+const rpcMethodNotFound = -32601
+
+// WithInternalTransfers sets whether the value transfers made by contracts
+// are indexed, from the call traces of the blocks. It is enabled by
+// default and needs an endpoint exposing debug_traceBlockByNumber: the
+// first block traced probes the endpoint, and any error returned by it
+// turns the tracing off, as many endpoints refuse the method with errors
+// of their own. Without it, the balance changes caused by internal
+// transfers are not indexed and the reconciliation reports them as
+// mismatches.
+func WithInternalTransfers(enabled bool) Option {
+	return func(b *Blockscan) {
+		b.traceInternal.Store(enabled)
+	}
+}
+
+// internalTransfers returns the value transfers made by contracts in the
+// block, as entries of kind internal going from the contract. Once the
+// endpoint traced a block, only an unknown method turns the tracing off;
+// other errors fail the block, so it is scanned again.
+func (b *Blockscan) internalTransfers(blockNumber int, block ethclient.Block) ([]svc.Transaction, error) {
+	if !b.traceInternal.Load() || len(block.Transactions) == 0 {
+		return nil, nil
+	}
+	traces, err := b.clt.TraceBlock(blockNumber)
+	if err != nil && refused(err, !b.traceProbed.Load()) {
+		if b.traceInternal.CompareAndSwap(true, false) {
+			fmt.Println("endpoint can't trace blocks, internal transfers are not indexed: ", err)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error tracing block %d: %w", blockNumber, err)
+	}
+	b.traceProbed.Store(true)
+	return parseInternalTransfers(block, traces)
+}
+
+// refused reports whether the error is the endpoint refusing to trace
+// blocks: any response of the node when probing, and an unknown method
+// afterwards. Errors reaching the node are not.
+func refused(err error, probing bool) bool {
+	var rpcErr *ethclient.RPCError
+	if errors.As(err, &rpcErr) {
+		return probing || rpcErr.Code == rpcMethodNotFound
+	}
+	var httpErr *ethclient.HTTPError
+	return probing && errors.As(err, &httpErr)
+}
+
+// parseInternalTransfers converts the calls moving value found in the
+// traces of the block transactions into entries of kind internal. The
+// transaction itself, at the top of its trace, is left out, as are the
+// calls which reverted, directly or with one of their parents.
+func parseInternalTransfers(block ethclient.Block, traces []ethclient.TransactionTrace) ([]svc.Transaction, error) {
+	h, err := parseBlockHeader(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) != len(block.Transactions) {
+		return nil, fmt.Errorf("error parsing traces of block %s: %d traces for %d transactions", block.Number, len(traces), len(block.Transactions))
+	}
+
+	var (
+		d       decoder
+		entries []svc.Transaction
+	)
+	for i, trace := range traces {
+		tx := block.Transactions[i]
+		if trace.TxHash != "" && !strings.EqualFold(trace.TxHash, tx.Hash) {
+			return nil, fmt.Errorf("error parsing traces of block %s: trace of %s at the place of %s", block.Number, trace.TxHash, tx.Hash)
+		}
+
+		index := 0
+		var walk func(call ethclient.CallFrame, depth int, reverted bool)
+		walk = func(call ethclient.CallFrame, depth int, reverted bool) {
+			i := index
+			index++
+			reverted = reverted || call.Error != ""
+			if depth > 0 && !reverted && movesValue(call.Type) && call.Value != "" {
+				value := d.big("internal transfer value", call.Value)
+				if value != nil && value.ToInt().Sign() > 0 {
+					to := d.address("internal transfer recipient", call.To)
+					entries = append(entries, svc.Transaction{
+						Kind:             svc.KindInternal,
+						BlockNumber:      h.number,
+						Hash:             d.hash("hash", tx.Hash),
+						From:             d.address("internal transfer sender", call.From),
+						To:               &to,
+						Value:            value,
+						Timestamp:        h.timestamp,
+						Type:             d.uint64("type", tx.Type),
+						TransactionIndex: d.uint64("transaction index", tx.TransactionIndex),
+						Internal: &svc.Internal{
+							Index: i,
+							Type:  strings.ToUpper(call.Type),
+							Depth: depth,
+						},
+					})
+				}
+			}
+			for _, c := range call.Calls {
+				walk(c, depth+1, reverted)
+			}
+		}
+		walk(trace.Result, 0, false)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("error parsing traces of block %s: %w", block.Number, d.err)
+	}
+	return entries, nil
+}
+
+// movesValue reports whether a call of the given type transfers its value
+// to another account. Delegate calls and calls to own code keep it.
+func movesValue(callType string) bool {
+	switch strings.ToUpper(callType) {
+	case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+		return true
+	}
+	return false
+}
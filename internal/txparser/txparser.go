@@ -2,9 +2,9 @@ package txparser
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"strings"
+	"math/big"
+	"time"
 
 	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
 	"github.com/danielmbirochi/trustwallet-assignment/internal/state"
@@ -17,12 +17,17 @@ type Service struct {
 	*Blockscan
 }
 
-func New(ctx context.Context, endpoint string, startAtBlock int) *Service {
-	datastore := db.New()
+func New(ctx context.Context, endpoint string, startAtBlock int, opts ...Option) *Service {
+	return NewWithStore(ctx, db.New(), endpoint, startAtBlock, opts...)
+}
+
+// NewWithStore returns a Service backed by the given store, which may be
+// shared with other processes, such as sharded workers.
+func NewWithStore(ctx context.Context, kvstate state.KeyValueStorer, endpoint string, startAtBlock int, opts ...Option) *Service {
 	ethclt := ethclient.New(endpoint)
-	scan := NewScan(ctx, datastore, ethclt, startAtBlock)
+	scan := NewScan(ctx, kvstate, ethclt, startAtBlock, opts...)
 	return &Service{
-		kvstate:   datastore,
+		kvstate:   kvstate,
 		Blockscan: scan,
 	}
 }
@@ -30,29 +35,129 @@ func New(ctx context.Context, endpoint string, startAtBlock int) *Service {
 // Subscribe adds the address to the list of addresses to be scanned
 // for transactions. Returns true if the address was added successfully.
 // It will return true if the address is already subscribed.
+// A pending history deletion scheduled by Unsubscribe is cancelled.
 func (s *Service) Subscribe(address string) bool {
-	if err := s.kvstate.Put(strings.ToLower(address), [][]byte{}); err != nil {
+	if err := s.V2().Subscribe(context.Background(), address); err != nil {
+		fmt.Println("error subscribing address: ", err)
+		return false
+	}
+	return true
+}
+
+// SubscribeWith adds the address of the subscription to the list of
+// addresses to be scanned, recording its registry details. Subscribing an
+// address again replaces its details but keeps its creation time and
+// start block.
+func (s *Service) SubscribeWith(sub svc.Subscription) bool {
+	if err := s.V2().SubscribeWith(context.Background(), sub); err != nil {
 		fmt.Println("error subscribing address: ", err)
 		return false
 	}
 	return true
 }
 
-// GetTransactions return a list of scanned transactions for the given address.
-func (s *Service) GetTransactions(address string) []svc.Transaction {
-	txs, err := s.kvstate.Get(strings.ToLower(address))
+// SubscribeMany subscribes every address of the batch, returning the
+// outcome for each entry in order. Invalid and duplicated entries are
+// reported without stopping the others.
+func (s *Service) SubscribeMany(subs []svc.Subscription) []svc.SubscribeResult {
+	results, _ := s.V2().SubscribeMany(context.Background(), subs)
+	return results
+}
+
+// Unsubscribe stops scanning transactions for the address. Its history is
+// kept, purged, or scheduled for deletion after the grace period depending
+// on the retention policy. Returns false if the address is not subscribed.
+func (s *Service) Unsubscribe(address string, opts svc.UnsubscribeOptions) bool {
+	if err := s.V2().Unsubscribe(context.Background(), address, opts); err != nil {
+		fmt.Println("error unsubscribing address: ", err)
+		return false
+	}
+	return true
+}
+
+// GetTransactions return a list of scanned transactions for the given address
+// matching the given query options.
+func (s *Service) GetTransactions(address string, opts ...svc.QueryOption) []svc.Transaction {
+	txs, err := s.V2().GetTransactions(context.Background(), address, opts...)
 	if err != nil {
 		fmt.Println("error getting transactions: ", err)
 		return nil
 	}
-	transactions := make([]svc.Transaction, len(txs))
-	for i, v := range txs {
-		var tx svc.Transaction
-		if err := json.Unmarshal(v, &tx); err != nil {
-			fmt.Println("error unmarshaling transaction: ", err)
-			continue
-		}
-		transactions[i] = tx
+	return txs
+}
+
+// GetFees returns the total fees paid by the address on its outgoing
+// transactions matching the given query options, in wei.
+func (s *Service) GetFees(address string, opts ...svc.QueryOption) *big.Int {
+	fees, err := s.V2().GetFees(context.Background(), address, opts...)
+	if err != nil {
+		fmt.Println("error getting fees: ", err)
+		return new(big.Int)
+	}
+	return fees
+}
+
+// GetBalance returns the balance of the address according to its indexed
+// history, anchored on the chain by the last reconciliation.
+func (s *Service) GetBalance(address string) *big.Int {
+	balance, err := s.V2().GetBalance(context.Background(), address)
+	if err != nil {
+		fmt.Println("error getting balance: ", err)
+		return nil
+	}
+	return balance
+}
+
+// GetBalanceMismatches returns the reconciliations where the indexed
+// balance of the address differed from its on-chain balance.
+func (s *Service) GetBalanceMismatches(address string) []svc.BalanceMismatch {
+	mismatches, err := s.V2().GetBalanceMismatches(context.Background(), address)
+	if err != nil {
+		fmt.Println("error getting balance mismatches: ", err)
+		return nil
+	}
+	return mismatches
+}
+
+// GetNonceStatus returns the outgoing nonces indexed for the address and
+// the gaps found when comparing them with its on-chain transaction count.
+func (s *Service) GetNonceStatus(address string) svc.NonceStatus {
+	status, err := s.V2().GetNonceStatus(context.Background(), address)
+	if err != nil {
+		fmt.Println("error getting nonce status: ", err)
+		return svc.NonceStatus{}
+	}
+	return status
+}
+
+// GetStats returns the aggregates of the indexed history of the address.
+func (s *Service) GetStats(address string) svc.Stats {
+	stats, err := s.V2().GetStats(context.Background(), address)
+	if err != nil {
+		fmt.Println("error getting statistics: ", err)
+		return svc.Stats{}
+	}
+	return stats
+}
+
+// GetRollups returns the activity of the address per bucket over the time
+// range.
+func (s *Service) GetRollups(address string, bucket svc.Bucket, from, to time.Time) []svc.Rollup {
+	rollups, err := s.V2().GetRollups(context.Background(), address, bucket, from, to)
+	if err != nil {
+		fmt.Println("error getting rollups: ", err)
+		return nil
+	}
+	return rollups
+}
+
+// GetTotalRollups returns the activity of every subscribed address per
+// bucket over the time range.
+func (s *Service) GetTotalRollups(bucket svc.Bucket, from, to time.Time) []svc.Rollup {
+	rollups, err := s.V2().GetTotalRollups(context.Background(), bucket, from, to)
+	if err != nil {
+		fmt.Println("error getting rollups: ", err)
+		return nil
 	}
-	return transactions
+	return rollups
 }
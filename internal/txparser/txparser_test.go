@@ -93,8 +93,17 @@ func makeSampleDataset(t *testing.T, ethclt *ethclient.Client, initialBlock, fin
 			t.Fatal("error generating sample data: ", err)
 		}
 		for _, tx := range block.Transactions {
-			dataset[tx.To] = append(dataset[tx.To], txparser.ParseTx(tx))
-			dataset[tx.From] = append(dataset[tx.From], txparser.ParseTx(tx))
+			parsed, err := txparser.ParseTx(tx)
+			if err != nil {
+				t.Fatal("error generating sample data: ", err)
+			}
+			// Self-transfers are stored once, and contract creations
+			// have no recipient.
+			from, to := parsed.Sender(), parsed.Recipient()
+			dataset[from] = append(dataset[from], parsed)
+			if to != "" && to != from {
+				dataset[to] = append(dataset[to], parsed)
+			}
 		}
 	}
 	return dataset
@@ -0,0 +1,415 @@
+package txparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	svc "github.com/danielmbirochi/trustwallet-assignment/internal"
+)
+
+// ServiceV2 implements service.ParserV2 on top of a Service. The methods
+// of Service are adapters of the ones of ServiceV2 that log the errors.
+type ServiceV2 struct {
+	s *Service
+}
+
+var _ svc.ParserV2 = (*ServiceV2)(nil)
+
+// V2 returns the API of the service reporting failures as typed errors.
+func (s *Service) V2() *ServiceV2 {
+	return &ServiceV2{s: s}
+}
+
+// normalize validates the address, checking its EIP-55 checksum when it
+// is in mixed case, and returns its canonical form, used for keys.
+func normalize(address string) (string, error) {
+	a, err := svc.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return a.Canonical(), nil
+}
+
+func checksummedSubscription(sub svc.Subscription) svc.Subscription {
+	sub.Address = svc.Checksummed(sub.Address)
+	return sub
+}
+
+// unavailable wraps an error of the store.
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", svc.ErrStoreUnavailable, err)
+}
+
+// known validates the address and checks that it is subscribed or has a
+// kept history. It returns the normalized address.
+func (v *ServiceV2) known(ctx context.Context, address string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	address, err := normalize(address)
+	if err != nil {
+		return "", err
+	}
+	exist, err := v.s.kvstate.Has(address)
+	if err != nil {
+		return "", unavailable(err)
+	}
+	if !exist {
+		return "", fmt.Errorf("%w: %s", svc.ErrNotSubscribed, address)
+	}
+	return address, nil
+}
+
+// GetCurrentBlock returns the last scanned block.
+func (v *ServiceV2) GetCurrentBlock(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return v.s.GetCurrentBlock(), nil
+}
+
+// Subscribe adds the address to the list of addresses to be scanned. The
+// details of an address already subscribed are kept, and a pending
+// history deletion scheduled by Unsubscribe is cancelled.
+func (v *ServiceV2) Subscribe(ctx context.Context, address string) error {
+	sub, err := v.GetSubscription(ctx, address)
+	switch {
+	case err == nil:
+		return v.SubscribeWith(ctx, sub)
+	case errors.Is(err, svc.ErrNotSubscribed):
+		return v.SubscribeWith(ctx, svc.Subscription{Address: address})
+	default:
+		return err
+	}
+}
+
+// SubscribeWith adds the address of the subscription to the list of
+// addresses to be scanned, recording its registry details. Subscribing an
+// address again replaces its details but keeps its creation time and
+// start block.
+func (v *ServiceV2) SubscribeWith(ctx context.Context, sub svc.Subscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	address, err := normalize(sub.Address)
+	if err != nil {
+		return err
+	}
+	sub.Address = address
+
+	prev, ok, err := v.s.loadSubscription(sub.Address)
+	if err != nil {
+		return unavailable(err)
+	}
+	if ok {
+		sub.CreatedAt, sub.StartBlock = prev.CreatedAt, prev.StartBlock
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+	if sub.StartBlock == 0 {
+		sub.StartBlock = uint64(v.s.GetCurrentBlock() + 1)
+	}
+
+	if err := v.s.kvstate.Put(sub.Address, [][]byte{}); err != nil {
+		return unavailable(fmt.Errorf("error subscribing address: %w", err))
+	}
+	if err := v.s.saveSubscription(sub); err != nil {
+		return unavailable(err)
+	}
+	if err := v.s.kvstate.Delete(purgeKey(sub.Address)); err != nil {
+		return unavailable(fmt.Errorf("error cancelling history deletion: %w", err))
+	}
+	return nil
+}
+
+// SubscribeMany subscribes every address of the batch as SubscribeWith
+// does. It returns the outcome for each entry, in order: entries with an
+// invalid address or an address already given earlier in the batch are
+// rejected without stopping the others. It fails only when the context is
+// done before the end of the batch.
+func (v *ServiceV2) SubscribeMany(ctx context.Context, subs []svc.Subscription) ([]svc.SubscribeResult, error) {
+	results := make([]svc.SubscribeResult, len(subs))
+	first := make(map[string]int, len(subs))
+	for i, sub := range subs {
+		results[i].Address = sub.Address
+		address, err := normalize(sub.Address)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Address = svc.Checksummed(address)
+		if j, dup := first[address]; dup {
+			results[i].Err = fmt.Errorf("%w: %s, first given in entry %d", svc.ErrDuplicateSubscription, address, j+1)
+			continue
+		}
+		first[address] = i
+		results[i].Err = v.SubscribeWith(ctx, sub)
+	}
+	return results, ctx.Err()
+}
+
+// GetSubscription returns the registry details of the subscribed address.
+func (v *ServiceV2) GetSubscription(ctx context.Context, address string) (svc.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return svc.Subscription{}, err
+	}
+	address, err := normalize(address)
+	if err != nil {
+		return svc.Subscription{}, err
+	}
+	sub, ok, err := v.s.loadSubscription(address)
+	if err != nil {
+		return svc.Subscription{}, unavailable(err)
+	}
+	if !ok {
+		return svc.Subscription{}, fmt.Errorf("%w: %s", svc.ErrNotSubscribed, address)
+	}
+	return checksummedSubscription(sub), nil
+}
+
+// ListSubscriptions returns the subscriptions matching the filter, sorted
+// by address. The zero filter returns every active subscription.
+func (v *ServiceV2) ListSubscriptions(ctx context.Context, filter svc.SubscriptionFilter) ([]svc.Subscription, error) {
+	now := time.Now()
+	var result []svc.Subscription
+	err := v.s.eachSubscription(func(address string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sub, ok, err := v.s.loadSubscription(address)
+		if err != nil {
+			return unavailable(err)
+		}
+		if ok && filter.Match(sub, now) {
+			result = append(result, checksummedSubscription(sub))
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, svc.ErrStoreUnavailable) {
+			return nil, err
+		}
+		return nil, unavailable(err)
+	}
+	sort.Slice(result, func(i, j int) bool { return strings.ToLower(result[i].Address) < strings.ToLower(result[j].Address) })
+	return result, nil
+}
+
+// Unsubscribe stops scanning transactions for the address. Its history is
+// kept, purged, or scheduled for deletion after the grace period depending
+// on the retention policy.
+func (v *ServiceV2) Unsubscribe(ctx context.Context, address string, opts svc.UnsubscribeOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	address, err := normalize(address)
+	if err != nil {
+		return err
+	}
+	exist, err := v.s.kvstate.Has(subKey(address))
+	if err != nil {
+		return unavailable(err)
+	}
+	if !exist {
+		return fmt.Errorf("%w: %s", svc.ErrNotSubscribed, address)
+	}
+	if err := v.s.kvstate.Delete(subKey(address)); err != nil {
+		return unavailable(fmt.Errorf("error unsubscribing address: %w", err))
+	}
+	if err := v.s.removeFromIndex(subIndexKey, subPrefix, address); err != nil {
+		return unavailable(fmt.Errorf("error unindexing subscription: %w", err))
+	}
+
+	switch opts.Retention {
+	case svc.PurgeHistory:
+		if err := v.s.purgeHistory(address); err != nil {
+			return unavailable(err)
+		}
+	case svc.ExpireHistory:
+		deadline := time.Now().Add(opts.GracePeriod).Unix()
+		if err := v.s.kvstate.Put(purgeKey(address), [][]byte{[]byte(strconv.FormatInt(deadline, 10))}); err != nil {
+			return unavailable(fmt.Errorf("error scheduling history deletion: %w", err))
+		}
+	}
+	return nil
+}
+
+// GetTransactions return a list of scanned transactions for the given address
+// matching the given query options.
+func (v *ServiceV2) GetTransactions(ctx context.Context, address string, opts ...svc.QueryOption) ([]svc.Transaction, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	page, err := v.page(address, svc.NewQuery(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return page.Transactions, nil
+}
+
+// ListTransactions returns a page of the transactions of the address
+// matching the given query options, ordered by position in the chain.
+// Only the entries of the page are read, unless the running balance is
+// requested, which is computed over the whole history.
+func (v *ServiceV2) ListTransactions(ctx context.Context, address string, opts ...svc.QueryOption) (svc.TransactionPage, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return svc.TransactionPage{}, err
+	}
+	return v.page(address, svc.NewQuery(opts...))
+}
+
+func (v *ServiceV2) page(address string, query svc.Query) (svc.TransactionPage, error) {
+	var h history
+	if query.WithBalance {
+		txs, err := v.s.loadTxs(address)
+		if err != nil {
+			return svc.TransactionPage{}, unavailable(err)
+		}
+		l, err := v.s.loadLedger(address)
+		if err != nil {
+			return svc.TransactionPage{}, unavailable(err)
+		}
+		l.applyBalances(address, txs)
+		h = loadedHistory(txs)
+	} else {
+		stored, err := v.s.storedHistory(address)
+		if err != nil {
+			return svc.TransactionPage{}, unavailable(err)
+		}
+		h = stored
+	}
+
+	page, err := h.page(address, query)
+	if err != nil {
+		if errors.Is(err, svc.ErrInvalidCursor) {
+			return svc.TransactionPage{}, err
+		}
+		return svc.TransactionPage{}, unavailable(err)
+	}
+	return page, nil
+}
+
+// GetFees returns the total fees paid by the address on its outgoing
+// transactions matching the given query options, in wei.
+func (v *ServiceV2) GetFees(ctx context.Context, address string, opts ...svc.QueryOption) (*big.Int, error) {
+	address, err := normalize(address)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := v.GetTransactions(ctx, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Int)
+	for _, tx := range txs {
+		if tx.Kind == svc.KindTransaction && tx.Sender() == address && tx.Fee != nil {
+			total.Add(total, tx.Fee.ToInt())
+		}
+	}
+	return total, nil
+}
+
+// GetBalance returns the balance of the address according to its indexed
+// history, anchored on the chain by the last reconciliation.
+func (v *ServiceV2) GetBalance(ctx context.Context, address string) (*big.Int, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	l, err := v.s.loadLedger(address)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	txs, err := v.s.loadTxs(address)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	return l.balance(address, txs), nil
+}
+
+// GetBalanceMismatches returns the reconciliations where the indexed
+// balance of the address differed from its on-chain balance.
+func (v *ServiceV2) GetBalanceMismatches(ctx context.Context, address string) ([]svc.BalanceMismatch, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	l, err := v.s.loadLedger(address)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	return l.Mismatches, nil
+}
+
+// GetNonceStatus returns the outgoing nonces indexed for the address and
+// the gaps found when comparing them with its on-chain transaction count.
+func (v *ServiceV2) GetNonceStatus(ctx context.Context, address string) (svc.NonceStatus, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return svc.NonceStatus{}, err
+	}
+	t, _, err := v.s.loadNonceTracker(address)
+	if err != nil {
+		return svc.NonceStatus{}, unavailable(err)
+	}
+	return svc.NonceStatus{
+		Highest:          t.Highest,
+		TransactionCount: t.Count,
+		CheckedAt:        t.CheckedAt,
+		Gaps:             t.Gaps,
+	}, nil
+}
+
+// GetStats returns the aggregates of the indexed history of the address,
+// maintained as entries are saved.
+func (v *ServiceV2) GetStats(ctx context.Context, address string) (svc.Stats, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return svc.Stats{}, err
+	}
+	stats, err := v.s.loadStats(address)
+	if err != nil {
+		return svc.Stats{}, unavailable(err)
+	}
+	return stats, nil
+}
+
+// GetRollups returns the activity of the address for every bucket of the
+// given size overlapping the time range, from the oldest.
+func (v *ServiceV2) GetRollups(ctx context.Context, address string, bucket svc.Bucket, from, to time.Time) ([]svc.Rollup, error) {
+	address, err := v.known(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return v.rollups(address, bucket, from, to)
+}
+
+// GetTotalRollups returns the activity of every subscribed address for
+// every bucket of the given size overlapping the time range, from the
+// oldest.
+func (v *ServiceV2) GetTotalRollups(ctx context.Context, bucket svc.Bucket, from, to time.Time) ([]svc.Rollup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return v.rollups(allScope, bucket, from, to)
+}
+
+func (v *ServiceV2) rollups(scope string, bucket svc.Bucket, from, to time.Time) ([]svc.Rollup, error) {
+	result, err := v.s.rollups(scope, bucket, from, to)
+	if err != nil {
+		if errors.Is(err, svc.ErrInvalidRange) {
+			return nil, err
+		}
+		return nil, unavailable(err)
+	}
+	return result, nil
+}
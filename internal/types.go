@@ -0,0 +1,264 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// HashLength is the length of a hash in bytes.
+const HashLength = 32
+
+// ErrInvalidHex is returned when decoding a malformed hex string.
+var ErrInvalidHex = errors.New("invalid hex")
+
+// The types below encode in JSON as Ethereum does: quantities as 0x
+// prefixed hex numbers without leading zeros, hashes and data as 0x
+// prefixed hex strings. Decoding is strict about hex strings, but accepts
+// the decimal JSON numbers, and the empty strings for absent hashes,
+// addresses and data, stored by earlier versions.
+
+// Hash is a 32-byte hash, such as a transaction hash.
+type Hash [HashLength]byte
+
+// ParseHash parses a 0x prefixed hex encoded hash.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if err := decodeFixed(h[:], s); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// Hex returns the 0x prefixed lower case hex form of the hash.
+func (h Hash) Hex() string {
+	return "0x" + hex.EncodeToString(h[:])
+}
+
+func (h Hash) String() string {
+	return h.Hex()
+}
+
+// IsZero reports whether h is the zero hash, as for the entries which are
+// not transactions.
+func (h Hash) IsZero() bool {
+	return h == Hash{}
+}
+
+// MarshalText encodes the hash in hex.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// UnmarshalText parses the hash as ParseHash does.
+func (h *Hash) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*h = Hash{}
+		return nil
+	}
+	parsed, err := ParseHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// Uint64 is a 64-bit quantity.
+type Uint64 uint64
+
+// ParseUint64 parses a 0x prefixed hex encoded quantity.
+func ParseUint64(s string) (Uint64, error) {
+	digits, err := quantityDigits(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q does not fit in 64 bits", ErrInvalidHex, s)
+	}
+	return Uint64(n), nil
+}
+
+// MarshalText encodes the quantity in hex.
+func (n Uint64) MarshalText() ([]byte, error) {
+	return []byte("0x" + strconv.FormatUint(uint64(n), 16)), nil
+}
+
+// UnmarshalJSON parses a hex encoded quantity, or a decimal number.
+func (n *Uint64) UnmarshalJSON(input []byte) error {
+	if isNull(input) {
+		return nil
+	}
+	if !isString(input) {
+		v, err := strconv.ParseUint(string(input), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidHex, input)
+		}
+		*n = Uint64(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	v, err := ParseUint64(s)
+	if err != nil {
+		return err
+	}
+	*n = v
+	return nil
+}
+
+// Big is an arbitrary precision quantity. Negative values, which only
+// occur in amounts computed by the parser, are encoded with a leading
+// minus sign.
+type Big big.Int
+
+// NewBig returns x as a quantity, nil if x is nil. The quantity shares the
+// value of x.
+func NewBig(x *big.Int) *Big {
+	return (*Big)(x)
+}
+
+// ParseBig parses a 0x prefixed hex encoded quantity.
+func ParseBig(s string) (*Big, error) {
+	digits, err := quantityDigits(s)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHex, s)
+	}
+	return (*Big)(n), nil
+}
+
+// ToInt returns the quantity as a *big.Int sharing its value, nil if b is
+// nil.
+func (b *Big) ToInt() *big.Int {
+	return (*big.Int)(b)
+}
+
+// String returns the quantity in decimal.
+func (b *Big) String() string {
+	return b.ToInt().String()
+}
+
+// MarshalText encodes the quantity in hex.
+func (b Big) MarshalText() ([]byte, error) {
+	n := (*big.Int)(&b)
+	if n.Sign() < 0 {
+		return []byte("-0x" + new(big.Int).Neg(n).Text(16)), nil
+	}
+	return []byte("0x" + n.Text(16)), nil
+}
+
+// UnmarshalJSON parses a hex encoded quantity, or a decimal number.
+func (b *Big) UnmarshalJSON(input []byte) error {
+	if isNull(input) {
+		return nil
+	}
+	if !isString(input) {
+		if _, ok := (*big.Int)(b).SetString(string(input), 10); !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidHex, input)
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	negative := len(s) > 0 && s[0] == '-'
+	if negative {
+		s = s[1:]
+	}
+	v, err := ParseBig(s)
+	if err != nil {
+		return err
+	}
+	n := (*big.Int)(b).Set(v.ToInt())
+	if negative {
+		n.Neg(n)
+	}
+	return nil
+}
+
+// Bytes is binary data, such as transaction input.
+type Bytes []byte
+
+// ParseBytes parses 0x prefixed hex encoded data.
+func ParseBytes(s string) (Bytes, error) {
+	if len(s) < 2 || (s[:2] != "0x" && s[:2] != "0X") {
+		return nil, fmt.Errorf("%w: %q lacks the 0x prefix", ErrInvalidHex, s)
+	}
+	data, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHex, s)
+	}
+	return data, nil
+}
+
+func (b Bytes) String() string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// MarshalText encodes the data in hex.
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText parses the data as ParseBytes does.
+func (b *Bytes) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = nil
+		return nil
+	}
+	parsed, err := ParseBytes(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// quantityDigits returns the hex digits of a 0x prefixed quantity, which
+// has no leading zeros as in Ethereum JSON: zero is 0x0.
+func quantityDigits(s string) (string, error) {
+	if len(s) < 3 || (s[:2] != "0x" && s[:2] != "0X") {
+		return "", fmt.Errorf("%w: %q is not a 0x prefixed quantity", ErrInvalidHex, s)
+	}
+	digits := s[2:]
+	if len(digits) > 1 && digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q has leading zeros", ErrInvalidHex, s)
+	}
+	for _, c := range digits {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return "", fmt.Errorf("%w: %q", ErrInvalidHex, s)
+		}
+	}
+	return digits, nil
+}
+
+// decodeFixed decodes the 0x prefixed hex string into dst, which it must
+// fill exactly.
+func decodeFixed(dst []byte, s string) error {
+	if len(s) != 2+2*len(dst) || (s[:2] != "0x" && s[:2] != "0X") {
+		return fmt.Errorf("%w: %q is not %d bytes long", ErrInvalidHex, s, len(dst))
+	}
+	if _, err := hex.Decode(dst, []byte(s[2:])); err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidHex, s)
+	}
+	return nil
+}
+
+func isNull(input []byte) bool {
+	return string(input) == "null"
+}
+
+func isString(input []byte) bool {
+	return len(input) > 0 && input[0] == '"'
+}
@@ -0,0 +1,147 @@
+// Package abi decodes Ethereum transaction calldata using Solidity
+// contract ABIs.
+package abi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/keccak"
+)
+
+// Selector is the 4 bytes function identifier that prefixes calldata.
+type Selector [4]byte
+
+// String returns the 0x prefixed hex representation of the selector.
+func (s Selector) String() string {
+	return "0x" + hex.EncodeToString(s[:])
+}
+
+// Method is a contract function that can be matched against calldata.
+type Method struct {
+	Name     string
+	Inputs   []Argument
+	Selector Selector
+}
+
+// NewMethod builds a method and computes its selector.
+func NewMethod(name string, inputs []Argument) Method {
+	m := Method{Name: name, Inputs: inputs}
+	hash := keccak.Sum256([]byte(m.Signature()))
+	copy(m.Selector[:], hash[:4])
+	return m
+}
+
+// ParseSignature parses a human readable function signature such as
+// "transfer(address to,uint256 amount)". Parameter names are optional.
+func ParseSignature(sig string) (Method, error) {
+	sig = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(sig), "function "))
+	open := strings.Index(sig, "(")
+	if open <= 0 || !strings.HasSuffix(sig, ")") {
+		return Method{}, fmt.Errorf("invalid signature %q", sig)
+	}
+	params, err := splitParams(sig[open+1 : len(sig)-1])
+	if err != nil {
+		return Method{}, err
+	}
+	inputs := make([]Argument, len(params))
+	for i, p := range params {
+		arg, err := parseParam(p)
+		if err != nil {
+			return Method{}, fmt.Errorf("invalid signature %q: %w", sig, err)
+		}
+		inputs[i] = arg
+	}
+	return NewMethod(strings.TrimSpace(sig[:open]), inputs), nil
+}
+
+// Signature returns the canonical signature of the method, such as
+// "transfer(address,uint256)".
+func (m Method) Signature() string {
+	parts := make([]string, len(m.Inputs))
+	for i, in := range m.Inputs {
+		parts[i] = in.Type.String()
+	}
+	return m.Name + "(" + strings.Join(parts, ",") + ")"
+}
+
+type jsonArgument struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Components []jsonArgument `json:"components"`
+}
+
+type jsonEntry struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name"`
+	Inputs []jsonArgument `json:"inputs"`
+}
+
+// ParseJSON parses a JSON ABI and returns its functions. Both a bare
+// ABI array and build artifacts holding it under an "abi" field are
+// accepted.
+func ParseJSON(data []byte) ([]Method, error) {
+	var entries []jsonEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var artifact struct {
+			ABI []jsonEntry `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, fmt.Errorf("error decoding abi: %v", err)
+		}
+		entries = artifact.ABI
+	}
+
+	var methods []Method
+	for _, e := range entries {
+		if e.Type != "function" && e.Type != "" {
+			continue
+		}
+		inputs, err := parseJSONArguments(e.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing function %s: %v", e.Name, err)
+		}
+		methods = append(methods, NewMethod(e.Name, inputs))
+	}
+	return methods, nil
+}
+
+func parseJSONArguments(args []jsonArgument) ([]Argument, error) {
+	result := make([]Argument, len(args))
+	for i, a := range args {
+		t, err := parseJSONType(a)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = Argument{Name: a.Name, Type: t}
+	}
+	return result, nil
+}
+
+// parseJSONType resolves "tuple" types, possibly nested in arrays, from
+// the components of the JSON argument.
+func parseJSONType(a jsonArgument) (Type, error) {
+	if !strings.HasPrefix(a.Type, "tuple") {
+		return ParseType(a.Type)
+	}
+	components, err := parseJSONArguments(a.Components)
+	if err != nil {
+		return Type{}, err
+	}
+	t := Type{Kind: TupleKind, Components: components}
+
+	suffix := strings.TrimPrefix(a.Type, "tuple")
+	for suffix != "" {
+		end := strings.Index(suffix, "]")
+		if !strings.HasPrefix(suffix, "[") || end < 0 {
+			return Type{}, fmt.Errorf("invalid type %q", a.Type)
+		}
+		if t, err = arrayOf(t, suffix[1:end]); err != nil {
+			return Type{}, err
+		}
+		suffix = suffix[end+1:]
+	}
+	return t, nil
+}
@@ -0,0 +1,115 @@
+package abi_test
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/abi"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+func word(s string) string {
+	return strings.Repeat("0", 64-len(s)) + s
+}
+
+func TestABI(t *testing.T) {
+	t.Run("Selectors", func(t *testing.T) {
+		testID := 0
+		tt := map[string]string{
+			"transfer(address to,uint256 amount)":                     "0xa9059cbb",
+			"approve(address,uint256)":                                "0x095ea7b3",
+			"multicall(bytes[] data)":                                 "0xac9650d8",
+			"execute(bytes commands,bytes[] inputs,uint256 deadline)": "0x3593564c",
+			"exactInputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))": "0x414bf389",
+		}
+		for sig, want := range tt {
+			m, err := abi.ParseSignature(sig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to parse signature %s : %s", Failed, testID, sig, err)
+			}
+			if got := m.Selector.String(); got != want {
+				t.Fatalf("\t%s\tTest %d:\tShould compute the selector of %s : Expected %s. Got %s", Failed, testID, sig, want, got)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould compute function selectors", Success, testID)
+	})
+
+	t.Run("DecodeStaticArguments", func(t *testing.T) {
+		testID := 1
+		reg := abi.NewRegistry()
+		input, _ := abi.DecodeHex("0xa9059cbb" + word("388c818ca8b9251b393131c08a736a67ccb19297") + word("de0b6b3a7640000"))
+
+		call, err := reg.Decode(input)
+		if err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to decode a built-in call : %s", Failed, testID, err)
+		}
+		if call.Method.Name != "transfer" || len(call.Args) != 2 {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to decode a built-in call : Got %+v", Failed, testID, call)
+		}
+		if call.Args[0].Name != "to" || call.Args[0].Data != "0x388c818ca8b9251b393131c08a736a67ccb19297" {
+			t.Fatalf("\t%s\tTest %d:\tShould decode address arguments : Got %+v", Failed, testID, call.Args[0])
+		}
+		if amount := call.Args[1].Data.(*big.Int); amount.Cmp(big.NewInt(1e18)) != 0 {
+			t.Fatalf("\t%s\tTest %d:\tShould decode uint arguments : Got %s", Failed, testID, amount)
+		}
+		t.Logf("\t%s\tTest %d:\tShould be able to decode a built-in call", Success, testID)
+	})
+
+	t.Run("DecodeDynamicArguments", func(t *testing.T) {
+		testID := 2
+		reg := abi.NewRegistry()
+		input, _ := abi.DecodeHex("0xac9650d8" +
+			word("20") + word("2") + word("40") + word("80") +
+			word("4") + "deadbeef" + strings.Repeat("0", 56) +
+			word("3") + "010203" + strings.Repeat("0", 58))
+
+		call, err := reg.Decode(input)
+		if err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to decode dynamic arguments : %s", Failed, testID, err)
+		}
+		items := call.Args[0].Data.([]abi.Value)
+		if len(items) != 2 || !bytes.Equal(items[0].Data.([]byte), []byte{0xde, 0xad, 0xbe, 0xef}) || !bytes.Equal(items[1].Data.([]byte), []byte{1, 2, 3}) {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to decode dynamic arguments : Got %+v", Failed, testID, items)
+		}
+
+		if _, err := reg.Decode(input[:40]); err == nil {
+			t.Fatalf("\t%s\tTest %d:\tShould reject truncated calldata", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould be able to decode dynamic arguments", Success, testID)
+	})
+
+	t.Run("LoadDir", func(t *testing.T) {
+		testID := 3
+		dir := t.TempDir()
+		doc := `{"abi":[
+			{"type":"function","name":"setOrder","inputs":[{"name":"order","type":"tuple","components":[{"name":"maker","type":"address"},{"name":"amounts","type":"uint256[]"}]}]},
+			{"type":"event","name":"Ignored","inputs":[]}
+		]}`
+		if err := os.WriteFile(filepath.Join(dir, "order.json"), []byte(doc), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		reg := abi.NewRegistry()
+		n, err := reg.LoadDir(dir)
+		if err != nil || n != 1 {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to load ABI files from a directory : %d methods, %v", Failed, testID, n, err)
+		}
+		m, err := abi.ParseSignature("setOrder((address,uint256[]))")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := reg.Lookup(m.Selector); !ok {
+			t.Fatalf("\t%s\tTest %d:\tShould register the loaded methods", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould be able to load ABI files from a directory", Success, testID)
+	})
+}
@@ -0,0 +1,53 @@
+package abi
+
+// builtinSignatures are common function signatures known without any
+// ABI file: token standards, wrapped ether and popular DEX routers.
+var builtinSignatures = []string{
+	// ERC-20
+	"transfer(address to,uint256 amount)",
+	"transferFrom(address from,address to,uint256 amount)",
+	"approve(address spender,uint256 amount)",
+	"increaseAllowance(address spender,uint256 addedValue)",
+	"decreaseAllowance(address spender,uint256 subtractedValue)",
+	"permit(address owner,address spender,uint256 value,uint256 deadline,uint8 v,bytes32 r,bytes32 s)",
+
+	// ERC-721
+	"safeTransferFrom(address from,address to,uint256 tokenId)",
+	"safeTransferFrom(address from,address to,uint256 tokenId,bytes data)",
+	"setApprovalForAll(address operator,bool approved)",
+
+	// ERC-1155
+	"safeTransferFrom(address from,address to,uint256 id,uint256 amount,bytes data)",
+	"safeBatchTransferFrom(address from,address to,uint256[] ids,uint256[] amounts,bytes data)",
+
+	// WETH
+	"deposit()",
+	"withdraw(uint256 amount)",
+
+	// Multicall
+	"multicall(bytes[] data)",
+	"multicall(uint256 deadline,bytes[] data)",
+
+	// Uniswap V2 router
+	"swapExactTokensForTokens(uint256 amountIn,uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"swapTokensForExactTokens(uint256 amountOut,uint256 amountInMax,address[] path,address to,uint256 deadline)",
+	"swapExactETHForTokens(uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"swapETHForExactTokens(uint256 amountOut,address[] path,address to,uint256 deadline)",
+	"swapExactTokensForETH(uint256 amountIn,uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"swapTokensForExactETH(uint256 amountOut,uint256 amountInMax,address[] path,address to,uint256 deadline)",
+	"swapExactTokensForTokensSupportingFeeOnTransferTokens(uint256 amountIn,uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"swapExactETHForTokensSupportingFeeOnTransferTokens(uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"swapExactTokensForETHSupportingFeeOnTransferTokens(uint256 amountIn,uint256 amountOutMin,address[] path,address to,uint256 deadline)",
+	"addLiquidity(address tokenA,address tokenB,uint256 amountADesired,uint256 amountBDesired,uint256 amountAMin,uint256 amountBMin,address to,uint256 deadline)",
+	"addLiquidityETH(address token,uint256 amountTokenDesired,uint256 amountTokenMin,uint256 amountETHMin,address to,uint256 deadline)",
+	"removeLiquidity(address tokenA,address tokenB,uint256 liquidity,uint256 amountAMin,uint256 amountBMin,address to,uint256 deadline)",
+	"removeLiquidityETH(address token,uint256 liquidity,uint256 amountTokenMin,uint256 amountETHMin,address to,uint256 deadline)",
+
+	// Uniswap V3 router
+	"exactInputSingle((address tokenIn,address tokenOut,uint24 fee,address recipient,uint256 deadline,uint256 amountIn,uint256 amountOutMinimum,uint160 sqrtPriceLimitX96) params)",
+	"exactInput((bytes path,address recipient,uint256 deadline,uint256 amountIn,uint256 amountOutMinimum) params)",
+
+	// Uniswap universal router
+	"execute(bytes commands,bytes[] inputs)",
+	"execute(bytes commands,bytes[] inputs,uint256 deadline)",
+}
@@ -0,0 +1,180 @@
+package abi
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrShortData is returned when calldata is smaller than its ABI layout
+// requires.
+var ErrShortData = errors.New("abi: calldata too short")
+
+// maxElements bounds the length prefix of dynamic values, protecting the
+// decoder from malicious calldata.
+const maxElements = 1 << 16
+
+// Call is a decoded contract call.
+type Call struct {
+	Method Method
+	Args   []Value
+}
+
+// Value is a decoded argument. Data holds a *big.Int for integers, a 0x
+// prefixed lowercase hex string for addresses, a bool, a []byte for
+// fixed and dynamic bytes, a string, or a []Value for arrays and tuples.
+type Value struct {
+	Name string
+	Type Type
+	Data interface{}
+}
+
+// Decode decodes the arguments of the method from the calldata, which
+// must start with the method selector.
+func (m Method) Decode(data []byte) (Call, error) {
+	if len(data) < 4 {
+		return Call{}, ErrShortData
+	}
+	if Selector(*(*[4]byte)(data[:4])) != m.Selector {
+		return Call{}, fmt.Errorf("abi: selector mismatch for %s", m.Name)
+	}
+	args, err := decodeTuple(m.Inputs, data[4:])
+	if err != nil {
+		return Call{}, fmt.Errorf("abi: decoding %s: %w", m.Signature(), err)
+	}
+	return Call{Method: m, Args: args}, nil
+}
+
+// DecodeHex decodes a 0x prefixed hex string into bytes.
+func DecodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+}
+
+func decodeTuple(args []Argument, data []byte) ([]Value, error) {
+	values := make([]Value, len(args))
+	offset := 0
+	for i, arg := range args {
+		v, err := decodeAt(arg.Type, data, offset)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = Value{Name: arg.Name, Type: arg.Type, Data: v}
+		offset += arg.Type.headSize()
+	}
+	return values, nil
+}
+
+// decodeAt decodes the value whose head starts at offset within data,
+// data being the encoding of the enclosing tuple.
+func decodeAt(t Type, data []byte, offset int) (interface{}, error) {
+	if t.dynamic() {
+		tail, err := readInt(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		if tail > len(data) {
+			return nil, ErrShortData
+		}
+		return decodeDynamic(t, data[tail:])
+	}
+	return decodeStatic(t, data, offset)
+}
+
+func decodeDynamic(t Type, data []byte) (interface{}, error) {
+	switch t.Kind {
+	case BytesKind, StringKind:
+		n, err := readInt(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if 32+n > len(data) {
+			return nil, ErrShortData
+		}
+		b := make([]byte, n)
+		copy(b, data[32:32+n])
+		if t.Kind == StringKind {
+			return string(b), nil
+		}
+		return b, nil
+	case SliceKind:
+		n, err := readInt(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		return decodeList(*t.Elem, n, data[32:])
+	case ArrayKind:
+		return decodeList(*t.Elem, t.Size, data)
+	case TupleKind:
+		return decodeTuple(t.Components, data)
+	}
+	return nil, fmt.Errorf("unexpected dynamic type %s", t)
+}
+
+func decodeStatic(t Type, data []byte, offset int) (interface{}, error) {
+	switch t.Kind {
+	case ArrayKind, TupleKind:
+		if offset > len(data) {
+			return nil, ErrShortData
+		}
+		if t.Kind == ArrayKind {
+			return decodeList(*t.Elem, t.Size, data[offset:])
+		}
+		return decodeTuple(t.Components, data[offset:])
+	}
+
+	if offset+32 > len(data) {
+		return nil, ErrShortData
+	}
+	word := data[offset : offset+32]
+
+	switch t.Kind {
+	case UintKind:
+		return new(big.Int).SetBytes(word), nil
+	case IntKind:
+		n := new(big.Int).SetBytes(word)
+		if word[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return n, nil
+	case AddressKind:
+		return "0x" + hex.EncodeToString(word[12:]), nil
+	case BoolKind:
+		return word[31] == 1, nil
+	case FixedBytesKind:
+		b := make([]byte, t.Size)
+		copy(b, word[:t.Size])
+		return b, nil
+	}
+	return nil, fmt.Errorf("unexpected static type %s", t)
+}
+
+func decodeList(elem Type, n int, data []byte) ([]Value, error) {
+	if n > maxElements {
+		return nil, fmt.Errorf("too many elements: %d", n)
+	}
+	values := make([]Value, n)
+	offset := 0
+	for i := 0; i < n; i++ {
+		v, err := decodeAt(elem, data, offset)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = Value{Type: elem, Data: v}
+		offset += elem.headSize()
+	}
+	return values, nil
+}
+
+// readInt reads the 32 bytes word at offset as a length or an offset.
+func readInt(data []byte, offset int) (int, error) {
+	if offset+32 > len(data) {
+		return 0, ErrShortData
+	}
+	n := new(big.Int).SetBytes(data[offset : offset+32])
+	if !n.IsInt64() || n.Int64() > int64(len(data)) {
+		return 0, ErrShortData
+	}
+	return int(n.Int64()), nil
+}
@@ -0,0 +1,96 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownSelector is returned when no registered method matches the
+// calldata selector.
+var ErrUnknownSelector = errors.New("abi: unknown selector")
+
+// Registry indexes contract methods by selector.
+type Registry struct {
+	methods map[Selector]Method
+	lock    sync.RWMutex
+}
+
+// NewRegistry returns a registry preloaded with the built-in table of
+// common function signatures.
+func NewRegistry() *Registry {
+	r := &Registry{
+		methods: make(map[Selector]Method),
+	}
+	for _, sig := range builtinSignatures {
+		m, err := ParseSignature(sig)
+		if err != nil {
+			panic(fmt.Sprintf("abi: invalid built-in signature %q: %v", sig, err))
+		}
+		r.Register(m)
+	}
+	return r
+}
+
+// Register adds the method to the registry, replacing any method with
+// the same selector.
+func (r *Registry) Register(m Method) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.methods[m.Selector] = m
+}
+
+// LoadDir registers the functions of every *.json ABI file in the given
+// directory. It returns the number of loaded methods.
+func (r *Registry) LoadDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("error reading abi directory: %v", err)
+	}
+
+	loaded := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return loaded, fmt.Errorf("error reading abi file: %v", err)
+		}
+		methods, err := ParseJSON(data)
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		for _, m := range methods {
+			r.Register(m)
+		}
+		loaded += len(methods)
+	}
+	return loaded, nil
+}
+
+// Lookup returns the method registered for the selector.
+func (r *Registry) Lookup(s Selector) (Method, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	m, ok := r.methods[s]
+	return m, ok
+}
+
+// Decode matches the calldata selector against the registry and decodes
+// the call arguments.
+func (r *Registry) Decode(data []byte) (Call, error) {
+	if len(data) < 4 {
+		return Call{}, ErrShortData
+	}
+	m, ok := r.Lookup(Selector(*(*[4]byte)(data[:4])))
+	if !ok {
+		return Call{}, ErrUnknownSelector
+	}
+	return m.Decode(data)
+}
@@ -0,0 +1,281 @@
+package abi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the family an ABI type belongs to.
+type Kind int
+
+const (
+	UintKind Kind = iota
+	IntKind
+	AddressKind
+	BoolKind
+	FixedBytesKind
+	BytesKind
+	StringKind
+	SliceKind
+	ArrayKind
+	TupleKind
+)
+
+// Type describes a Solidity ABI type.
+type Type struct {
+	Kind Kind
+
+	// Size is the bit size of integers, the byte size of fixed bytes
+	// and the length of fixed arrays.
+	Size int
+
+	// Elem is the element type of slices and arrays.
+	Elem *Type
+
+	// Components are the member types of tuples, with their names.
+	Components []Argument
+}
+
+// Argument is a named ABI value.
+type Argument struct {
+	Name string
+	Type Type
+}
+
+// ParseType parses a canonical type such as "uint256", "address[]" or
+// "(address,uint256)[2]". Tuples described by a JSON ABI are passed with
+// their components instead, see parseJSONType.
+func ParseType(s string) (Type, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Type{}, fmt.Errorf("empty type")
+	}
+
+	// Array suffixes bind to everything on their left.
+	if strings.HasSuffix(s, "]") {
+		open := strings.LastIndex(s, "[")
+		if open < 0 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		elem, err := ParseType(s[:open])
+		if err != nil {
+			return Type{}, err
+		}
+		return arrayOf(elem, s[open+1:len(s)-1])
+	}
+
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		params, err := splitParams(s[1 : len(s)-1])
+		if err != nil {
+			return Type{}, err
+		}
+		components := make([]Argument, len(params))
+		for i, p := range params {
+			arg, err := parseParam(p)
+			if err != nil {
+				return Type{}, err
+			}
+			components[i] = arg
+		}
+		return Type{Kind: TupleKind, Components: components}, nil
+	}
+
+	return parseElementary(s)
+}
+
+func arrayOf(elem Type, size string) (Type, error) {
+	if size == "" {
+		return Type{Kind: SliceKind, Elem: &elem}, nil
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n <= 0 {
+		return Type{}, fmt.Errorf("invalid array size %q", size)
+	}
+	return Type{Kind: ArrayKind, Size: n, Elem: &elem}, nil
+}
+
+func parseElementary(s string) (Type, error) {
+	switch s {
+	case "address":
+		return Type{Kind: AddressKind, Size: 160}, nil
+	case "bool":
+		return Type{Kind: BoolKind}, nil
+	case "string":
+		return Type{Kind: StringKind}, nil
+	case "bytes":
+		return Type{Kind: BytesKind}, nil
+	case "uint", "int":
+		s += "256"
+	case "function":
+		return Type{Kind: FixedBytesKind, Size: 24}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(s, "uint"):
+		n, err := strconv.Atoi(s[4:])
+		if err != nil || n == 0 || n > 256 || n%8 != 0 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		return Type{Kind: UintKind, Size: n}, nil
+	case strings.HasPrefix(s, "int"):
+		n, err := strconv.Atoi(s[3:])
+		if err != nil || n == 0 || n > 256 || n%8 != 0 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		return Type{Kind: IntKind, Size: n}, nil
+	case strings.HasPrefix(s, "bytes"):
+		n, err := strconv.Atoi(s[5:])
+		if err != nil || n == 0 || n > 32 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		return Type{Kind: FixedBytesKind, Size: n}, nil
+	}
+	return Type{}, fmt.Errorf("unsupported type %q", s)
+}
+
+// String returns the canonical representation of the type, as used to
+// compute function selectors.
+func (t Type) String() string {
+	switch t.Kind {
+	case UintKind:
+		return fmt.Sprintf("uint%d", t.Size)
+	case IntKind:
+		return fmt.Sprintf("int%d", t.Size)
+	case AddressKind:
+		return "address"
+	case BoolKind:
+		return "bool"
+	case FixedBytesKind:
+		return fmt.Sprintf("bytes%d", t.Size)
+	case BytesKind:
+		return "bytes"
+	case StringKind:
+		return "string"
+	case SliceKind:
+		return t.Elem.String() + "[]"
+	case ArrayKind:
+		return fmt.Sprintf("%s[%d]", t.Elem.String(), t.Size)
+	case TupleKind:
+		parts := make([]string, len(t.Components))
+		for i, c := range t.Components {
+			parts[i] = c.Type.String()
+		}
+		return "(" + strings.Join(parts, ",") + ")"
+	}
+	return ""
+}
+
+// dynamic reports whether the encoding of the type is stored out of
+// place, following the head/tail layout of the ABI spec.
+func (t Type) dynamic() bool {
+	switch t.Kind {
+	case BytesKind, StringKind, SliceKind:
+		return true
+	case ArrayKind:
+		return t.Elem.dynamic()
+	case TupleKind:
+		for _, c := range t.Components {
+			if c.Type.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize returns the number of bytes the type takes in the head of
+// its enclosing tuple.
+func (t Type) headSize() int {
+	if t.dynamic() {
+		return 32
+	}
+	switch t.Kind {
+	case ArrayKind:
+		return t.Size * t.Elem.headSize()
+	case TupleKind:
+		size := 0
+		for _, c := range t.Components {
+			size += c.Type.headSize()
+		}
+		return size
+	}
+	return 32
+}
+
+// splitParams splits a comma separated parameter list, ignoring commas
+// nested inside tuples.
+func splitParams(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var (
+		params []string
+		depth  int
+		start  int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+			}
+		case ',':
+			if depth == 0 {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+	}
+	return append(params, s[start:]), nil
+}
+
+// parseParam parses a signature parameter with an optional name, such
+// as "address to". Data location keywords are ignored.
+func parseParam(s string) (Argument, error) {
+	var (
+		depth int
+		words []string
+		start int
+	)
+	s = strings.TrimSpace(s)
+	for i, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case (r == ' ' || r == '\t') && depth == 0:
+			if i > start {
+				words = append(words, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	if len(words) == 0 {
+		return Argument{}, fmt.Errorf("empty parameter")
+	}
+
+	t, err := ParseType(words[0])
+	if err != nil {
+		return Argument{}, err
+	}
+	arg := Argument{Type: t}
+	for _, w := range words[1:] {
+		switch w {
+		case "memory", "calldata", "storage", "indexed", "payable":
+		default:
+			arg.Name = w
+		}
+	}
+	return arg, nil
+}
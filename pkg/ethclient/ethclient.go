@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +16,11 @@ const (
 	ApiVersion           = "2.0"
 	GetBlocknumberMethod = "eth_blockNumber"
 	GetBlockByNumber     = "eth_getBlockByNumber"
+	GetBlockReceipts     = "eth_getBlockReceipts"
+	GetTxReceipt         = "eth_getTransactionReceipt"
+	GetBalance           = "eth_getBalance"
+	GetTransactionCount  = "eth_getTransactionCount"
+	TraceBlockByNumber   = "debug_traceBlockByNumber"
 )
 
 type Client struct {
@@ -28,29 +35,53 @@ type RequestBody struct {
 }
 
 type Block struct {
-	Number       string        `json:"number"`
-	Hash         string        `json:"hash"`
-	Transactions []Transaction `json:"transactions"`
+	Number        string        `json:"number"`
+	Hash          string        `json:"hash"`
+	Timestamp     string        `json:"timestamp"`
+	BaseFeePerGas string        `json:"baseFeePerGas"`
+	BlobGasUsed   string        `json:"blobGasUsed"`
+	ExcessBlobGas string        `json:"excessBlobGas"`
+	Transactions  []Transaction `json:"transactions"`
+	Withdrawals   []Withdrawal  `json:"withdrawals"`
 }
 
+// Withdrawal is a beacon chain withdrawal (EIP-4895) credited to an
+// execution layer address. Amount is denominated in gwei.
+type Withdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// Transaction is a transaction of any type. Fee market fields are set for
+// EIP-1559 and later transactions, the access list for every type but
+// legacy ones, blob fields for EIP-4844 transactions only and the
+// authorization list for EIP-7702 transactions only.
 type Transaction struct {
-	ChainID          string            `json:"chainId"`
-	BlockNumber      string            `json:"blockNumber"`
-	BlockHash        string            `json:"-"`
-	Hash             string            `json:"hash"`
-	Nonce            string            `json:"nonce"`
-	From             string            `json:"from"`
-	To               string            `json:"to"`
-	Value            string            `json:"value"`
-	Gas              string            `json:"gas"`
-	GasPrice         string            `json:"gasPrice"`
-	Input            string            `json:"input"`
-	Type             string            `json:"-"`
-	R                string            `json:"-"`
-	S                string            `json:"-"`
-	V                string            `json:"-"`
-	TransactionIndex string            `json:"-"`
-	AccessList       []AccessListEntry `json:"-"`
+	ChainID              string            `json:"chainId"`
+	BlockNumber          string            `json:"blockNumber"`
+	BlockHash            string            `json:"-"`
+	Hash                 string            `json:"hash"`
+	Nonce                string            `json:"nonce"`
+	From                 string            `json:"from"`
+	To                   string            `json:"to"`
+	Value                string            `json:"value"`
+	Gas                  string            `json:"gas"`
+	GasPrice             string            `json:"gasPrice"`
+	MaxFeePerGas         string            `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string            `json:"maxPriorityFeePerGas"`
+	MaxFeePerBlobGas     string            `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []string          `json:"blobVersionedHashes"`
+	Input                string            `json:"input"`
+	Type                 string            `json:"type"`
+	R                    string            `json:"r"`
+	S                    string            `json:"s"`
+	V                    string            `json:"v"`
+	YParity              string            `json:"yParity"`
+	TransactionIndex     string            `json:"transactionIndex"`
+	AccessList           []AccessListEntry `json:"accessList"`
+	AuthorizationList    []Authorization   `json:"authorizationList"`
 }
 
 type AccessListEntry struct {
@@ -58,6 +89,70 @@ type AccessListEntry struct {
 	StorageKeys []string `json:"storageKeys"`
 }
 
+// Authorization is an EIP-7702 authorization tuple delegating the code of
+// its signer, the authority, to the contract at Address.
+type Authorization struct {
+	ChainID string `json:"chainId"`
+	Address string `json:"address"`
+	Nonce   string `json:"nonce"`
+	YParity string `json:"yParity"`
+	R       string `json:"r"`
+	S       string `json:"s"`
+}
+
+// Receipt is the outcome of an executed transaction. Blob fields are set
+// for EIP-4844 transactions only.
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	BlockNumber       string `json:"blockNumber"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	Status            string `json:"status"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	BlobGasUsed       string `json:"blobGasUsed"`
+	BlobGasPrice      string `json:"blobGasPrice"`
+}
+
+// CallFrame is a call made while executing a transaction, as reported by
+// the callTracer: the transaction itself at the top, and the calls it made
+// nested in Calls. Error is set when the call reverted, undoing its calls.
+type CallFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error"`
+	Calls []CallFrame `json:"calls"`
+}
+
+// TransactionTrace is the call trace of a transaction of a block.
+type TransactionTrace struct {
+	TxHash string    `json:"txHash"`
+	Result CallFrame `json:"result"`
+}
+
+// HTTPError is returned when the JSON-RPC endpoint responds with a status
+// code other than 200, such as when it refuses a method.
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("error response status code: %v", e.StatusCode)
+}
+
+// RPCError is an error returned by the JSON-RPC endpoint.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
 func New(endpoint string) *Client {
 	return &Client{
 		endpoint: endpoint,
@@ -77,7 +172,7 @@ func (c Client) BlockNumber() (int, error) {
 		return 0, fmt.Errorf("error making request: %v", err)
 	}
 	if r.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("error response status code: %v", r.StatusCode)
+		return 0, &HTTPError{StatusCode: r.StatusCode}
 	}
 
 	var responseBody struct {
@@ -108,7 +203,7 @@ func (c Client) BlockByNumber(blocknumber int) (Block, error) {
 		return Block{}, fmt.Errorf("error making request: %v", err)
 	}
 	if r.StatusCode != http.StatusOK {
-		return Block{}, fmt.Errorf("error response status code: %v", r.StatusCode)
+		return Block{}, &HTTPError{StatusCode: r.StatusCode}
 	}
 
 	var responseBody struct {
@@ -123,6 +218,105 @@ func (c Client) BlockByNumber(blocknumber int) (Block, error) {
 	return responseBody.Result, nil
 }
 
+// BlockReceipts returns the receipts of every transaction in the block. It
+// will call the eth_getBlockReceipts method, which is not served by every
+// endpoint.
+func (c Client) BlockReceipts(blocknumber int) ([]Receipt, error) {
+	var receipts []Receipt
+	if err := c.call(GetBlockReceipts, []string{fmt.Sprintf("0x%x", blocknumber)}, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// TransactionReceipt returns the receipt of the transaction with the given
+// hash. It will call the eth_getTransactionReceipt method.
+func (c Client) TransactionReceipt(hash string) (Receipt, error) {
+	var receipt *Receipt
+	if err := c.call(GetTxReceipt, []string{hash}, &receipt); err != nil {
+		return Receipt{}, err
+	}
+	if receipt == nil {
+		return Receipt{}, fmt.Errorf("receipt not found for %s", hash)
+	}
+	return *receipt, nil
+}
+
+// BalanceAt returns the wei balance of the address at the given block. It
+// will call the eth_getBalance method of the JSON-RPC API.
+func (c Client) BalanceAt(address string, blocknumber int) (*big.Int, error) {
+	var result string
+	if err := c.call(GetBalance, []string{address, fmt.Sprintf("0x%x", blocknumber)}, &result); err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(strings.TrimPrefix(result, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("error parsing balance %q", result)
+	}
+	return balance, nil
+}
+
+// TransactionCount returns the number of transactions sent by the address
+// up to the given block, which is the next nonce it will use. It will call
+// the eth_getTransactionCount method of the JSON-RPC API.
+func (c Client) TransactionCount(address string, blocknumber int) (uint64, error) {
+	var result string
+	if err := c.call(GetTransactionCount, []string{address, fmt.Sprintf("0x%x", blocknumber)}, &result); err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(strings.TrimPrefix(result, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing transaction count %q: %v", result, err)
+	}
+	return count, nil
+}
+
+// TraceBlock returns the call traces of the transactions of the block, in
+// block order. It will call the debug_traceBlockByNumber method of the
+// JSON-RPC API with the callTracer, which not every endpoint exposes.
+func (c Client) TraceBlock(blocknumber int) ([]TransactionTrace, error) {
+	var traces []TransactionTrace
+	params := []interface{}{fmt.Sprintf("0x%x", blocknumber), map[string]string{"tracer": "callTracer"}}
+	if err := c.call(TraceBlockByNumber, params, &traces); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// call performs a JSON-RPC request and decodes its result into result.
+func (c Client) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(makeRequestBody(method, params))
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %v", err)
+	}
+
+	r, err := http.Post(c.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: r.StatusCode}
+	}
+
+	var responseBody struct {
+		Jsonrpc string          `json:"jsonrpc"`
+		ID      int             `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&responseBody); err != nil {
+		return fmt.Errorf("error decoding response body: %v", err)
+	}
+	if responseBody.Error != nil {
+		return responseBody.Error
+	}
+	if err := json.Unmarshal(responseBody.Result, result); err != nil {
+		return fmt.Errorf("error decoding result: %v", err)
+	}
+	return nil
+}
+
 func makeRequestBody(method string, params interface{}) RequestBody {
 	rand.Seed(time.Now().UnixNano())
 	return RequestBody{
@@ -0,0 +1,138 @@
+// Package keccak implements the legacy Keccak-256 hash function used by
+// Ethereum. It differs from the standardized SHA3-256 only in the padding
+// byte, which is why crypto/sha3 can't be used directly.
+package keccak
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size is the size of a Keccak-256 checksum in bytes.
+	Size = 32
+
+	// rate is the sponge rate of Keccak-256 in bytes.
+	rate = 136
+)
+
+var roundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var rotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+type state struct {
+	a   [25]uint64
+	buf []byte
+}
+
+// New returns a new hash.Hash computing the Keccak-256 checksum.
+func New() hash.Hash {
+	return &state{buf: make([]byte, 0, rate)}
+}
+
+// Sum256 returns the Keccak-256 checksum of the data.
+func Sum256(data ...[]byte) [Size]byte {
+	h := New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	var out [Size]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+func (s *state) Size() int      { return Size }
+func (s *state) BlockSize() int { return rate }
+
+func (s *state) Reset() {
+	s.a = [25]uint64{}
+	s.buf = s.buf[:0]
+}
+
+func (s *state) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := rate - len(s.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		s.buf = append(s.buf, p[:free]...)
+		p = p[free:]
+		if len(s.buf) == rate {
+			s.absorb(s.buf)
+			s.buf = s.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+func (s *state) Sum(b []byte) []byte {
+	// Work on a copy so the caller can keep writing.
+	dup := *s
+	dup.buf = make([]byte, rate)
+	copy(dup.buf, s.buf)
+	for i := len(s.buf); i < rate; i++ {
+		dup.buf[i] = 0
+	}
+	dup.buf[len(s.buf)] ^= 0x01
+	dup.buf[rate-1] ^= 0x80
+	dup.absorb(dup.buf)
+
+	var out [Size]byte
+	for i := 0; i < Size/8; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], dup.a[i])
+	}
+	return append(b, out[:]...)
+}
+
+func (s *state) absorb(block []byte) {
+	for i := 0; i < rate/8; i++ {
+		s.a[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+	}
+	keccakF1600(&s.a)
+}
+
+func keccakF1600(a *[25]uint64) {
+	var b [25]uint64
+	var c [5]uint64
+	for round := 0; round < 24; round++ {
+		// theta
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[y+x] ^= d
+			}
+		}
+		// rho and pi
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], rotations[x+5*y])
+			}
+		}
+		// chi
+		for y := 0; y < 25; y += 5 {
+			for x := 0; x < 5; x++ {
+				a[y+x] = b[y+x] ^ (^b[y+(x+1)%5] & b[y+(x+2)%5])
+			}
+		}
+		// iota
+		a[0] ^= roundConstants[round]
+	}
+}
@@ -0,0 +1,55 @@
+// Package rlp implements the subset of the Recursive Length Prefix
+// encoding needed to rebuild signed Ethereum payloads.
+package rlp
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Encode returns the RLP encoding of v, which must be a []byte, a string,
+// a *big.Int, a uint64 or a []interface{} of those.
+func Encode(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return encodeString(v), nil
+	case string:
+		return encodeString([]byte(v)), nil
+	case uint64:
+		return encodeString(new(big.Int).SetUint64(v).Bytes()), nil
+	case *big.Int:
+		if v == nil {
+			return encodeString(nil), nil
+		}
+		if v.Sign() < 0 {
+			return nil, fmt.Errorf("rlp: negative integer %s", v)
+		}
+		return encodeString(v.Bytes()), nil
+	case []interface{}:
+		var payload []byte
+		for _, item := range v {
+			b, err := Encode(item)
+			if err != nil {
+				return nil, err
+			}
+			payload = append(payload, b...)
+		}
+		return append(header(0xc0, len(payload)), payload...), nil
+	}
+	return nil, fmt.Errorf("rlp: unsupported type %T", v)
+}
+
+func encodeString(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(header(0x80, len(b)), b...)
+}
+
+func header(offset byte, size int) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	n := big.NewInt(int64(size)).Bytes()
+	return append([]byte{offset + 55 + byte(len(n))}, n...)
+}
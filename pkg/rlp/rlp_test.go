@@ -0,0 +1,65 @@
+package rlp_test
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/rlp"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+func TestEncode(t *testing.T) {
+	t.Run("Vectors", func(t *testing.T) {
+		testID := 0
+		lorem := "Lorem ipsum dolor sit amet, consectetur adipisicing elit"
+		tt := []struct {
+			name     string
+			value    interface{}
+			expected string
+		}{
+			{"empty string", "", "80"},
+			{"string", "dog", "83646f67"},
+			{"single low byte", []byte{0x00}, "00"},
+			{"single byte", []byte{0x7f}, "7f"},
+			{"single high byte", []byte{0x80}, "8180"},
+			{"long string", lorem, "b838" + hex.EncodeToString([]byte(lorem))},
+			{"zero", uint64(0), "80"},
+			{"small integer", uint64(15), "0f"},
+			{"integer", uint64(1024), "820400"},
+			{"big integer", new(big.Int).Lsh(big.NewInt(1), 64), "89010000000000000000"},
+			{"nil big integer", (*big.Int)(nil), "80"},
+			{"empty list", []interface{}{}, "c0"},
+			{"list", []interface{}{"cat", "dog"}, "c88363617483646f67"},
+			{"nested lists", []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}, []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}}, "c7c0c1c0c3c0c1c0"},
+			{"long list", []interface{}{lorem}, "f83ab838" + hex.EncodeToString([]byte(lorem))},
+			{"long payload", strings.Repeat("a", 1024), "b90400" + strings.Repeat("61", 1024)},
+		}
+		for _, tc := range tt {
+			got, err := rlp.Encode(tc.value)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the %s : %s", Failed, testID, tc.name, err)
+			}
+			if hex.EncodeToString(got) != tc.expected {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the %s : Expected %s. Got %x", Failed, testID, tc.name, tc.expected, got)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould encode the reference vectors", Success, testID)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		testID := 1
+		for _, v := range []interface{}{big.NewInt(-1), 42, []interface{}{"dog", 3.14}} {
+			if _, err := rlp.Encode(v); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject %v", Failed, testID, v)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould reject negative integers and unsupported types", Success, testID)
+	})
+}
@@ -0,0 +1,147 @@
+// Package secp256k1 implements public key recovery from ECDSA signatures
+// over the secp256k1 curve, as used by Ethereum to authenticate signers.
+// It is written for verification of public data only and is not constant
+// time, so it must never be used with private keys.
+package secp256k1
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ErrInvalidSignature is returned when the signature values are out of
+// range or do not recover to a valid public key.
+var ErrInvalidSignature = errors.New("secp256k1: invalid signature")
+
+var (
+	// P is the order of the underlying field.
+	P, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+
+	// N is the order of the base point.
+	N, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+
+	// Gx and Gy are the coordinates of the base point.
+	Gx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	Gy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+
+	halfN = new(big.Int).Rsh(N, 1)
+	seven = big.NewInt(7)
+)
+
+// point is an affine curve point. The nil x coordinate is the point at
+// infinity.
+type point struct {
+	x, y *big.Int
+}
+
+// PublicKey is an uncompressed curve point.
+type PublicKey struct {
+	X, Y *big.Int
+}
+
+// Bytes returns the 64 bytes X || Y encoding of the public key, without
+// the 0x04 prefix.
+func (k PublicKey) Bytes() []byte {
+	out := make([]byte, 64)
+	k.X.FillBytes(out[:32])
+	k.Y.FillBytes(out[32:])
+	return out
+}
+
+// Recover returns the public key that produced the signature (r, s) with
+// recovery id v (0 or 1) over the 32 bytes message hash. Signatures with
+// a high s value are rejected, as required since EIP-2.
+func Recover(hash []byte, r, s *big.Int, v byte) (PublicKey, error) {
+	if len(hash) != 32 || v > 1 {
+		return PublicKey{}, ErrInvalidSignature
+	}
+	if r.Sign() <= 0 || r.Cmp(N) >= 0 || s.Sign() <= 0 || s.Cmp(halfN) > 0 {
+		return PublicKey{}, ErrInvalidSignature
+	}
+
+	// R is the point whose x coordinate is r and whose y parity is v.
+	y, ok := decompress(r, v)
+	if !ok {
+		return PublicKey{}, ErrInvalidSignature
+	}
+	R := point{new(big.Int).Set(r), y}
+
+	// Q = r^-1 (sR - eG)
+	e := new(big.Int).SetBytes(hash)
+	rInv := new(big.Int).ModInverse(r, N)
+	u1 := new(big.Int).Mul(e, rInv)
+	u1.Neg(u1).Mod(u1, N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, N)
+
+	Q := add(mul(point{Gx, Gy}, u1), mul(R, u2))
+	if Q.x == nil {
+		return PublicKey{}, ErrInvalidSignature
+	}
+	return PublicKey{X: Q.x, Y: Q.y}, nil
+}
+
+// decompress returns the y coordinate of the curve point with the given
+// x coordinate and y parity.
+func decompress(x *big.Int, parity byte) (*big.Int, bool) {
+	// y^2 = x^3 + 7
+	y2 := new(big.Int).Exp(x, big.NewInt(3), P)
+	y2.Add(y2, seven).Mod(y2, P)
+
+	// P = 3 mod 4, so sqrt(a) = a^((P+1)/4)
+	exp := new(big.Int).Add(P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(y2, exp, P)
+	if new(big.Int).Exp(y, big.NewInt(2), P).Cmp(y2) != 0 {
+		return nil, false
+	}
+	if y.Bit(0) != uint(parity) {
+		y.Sub(P, y)
+	}
+	return y, true
+}
+
+func add(a, b point) point {
+	if a.x == nil {
+		return b
+	}
+	if b.x == nil {
+		return a
+	}
+
+	var lambda *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Mod(new(big.Int).Add(a.y, b.y), P).Sign() == 0 {
+			return point{}
+		}
+		// lambda = 3x^2 / 2y
+		num := new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den := new(big.Int).Lsh(a.y, 1)
+		lambda = num.Mul(num, den.ModInverse(den, P))
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		num := new(big.Int).Sub(b.y, a.y)
+		den := new(big.Int).Sub(b.x, a.x)
+		den.Mod(den, P)
+		lambda = num.Mul(num, den.ModInverse(den, P))
+	}
+	lambda.Mod(lambda, P)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, P)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda).Sub(y, a.y).Mod(y, P)
+	return point{x, y}
+}
+
+func mul(p point, k *big.Int) point {
+	var result point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = add(result, result)
+		if k.Bit(i) == 1 {
+			result = add(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package secp256k1
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/danielmbirochi/trustwallet-assignment/pkg/keccak"
+)
+
+// Success and failure markers.
+const (
+	Success = "\u2713"
+	Failed  = "\u2717"
+)
+
+// sign produces a low-s signature of the hash with the private key d and
+// nonce k. It exists for tests only.
+func sign(hash []byte, d, k *big.Int) (r, s *big.Int, v byte) {
+	R := mul(point{Gx, Gy}, k)
+	r = new(big.Int).Mod(R.x, N)
+	v = byte(R.y.Bit(0))
+
+	s = new(big.Int).Mul(r, d)
+	s.Add(s, new(big.Int).SetBytes(hash))
+	s.Mul(s, new(big.Int).ModInverse(k, N)).Mod(s, N)
+	if s.Cmp(halfN) > 0 {
+		s.Sub(N, s)
+		v ^= 1
+	}
+	return r, s, v
+}
+
+func TestRecover(t *testing.T) {
+	hash := keccak.Sum256([]byte("trustwallet"))
+
+	t.Run("RecoverSigner", func(t *testing.T) {
+		testID := 0
+		for _, k := range []int64{7, 1234567, 987654321} {
+			r, s, v := sign(hash[:], big.NewInt(1), big.NewInt(k))
+			pub, err := Recover(hash[:], r, s, v)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould recover the signer : %s", Failed, testID, err)
+			}
+			addr := keccak.Sum256(pub.Bytes())
+			if got := hex.EncodeToString(addr[12:]); got != "7e5f4552091a69125d5dfcb7b8c2659029395bdf" {
+				t.Fatalf("\t%s\tTest %d:\tShould recover the signer : Expected address of key 1. Got 0x%s", Failed, testID, got)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\tShould recover the signer", Success, testID)
+	})
+
+	t.Run("RejectInvalidSignatures", func(t *testing.T) {
+		testID := 1
+		r, s, v := sign(hash[:], big.NewInt(1), big.NewInt(7))
+		if _, err := Recover(hash[:], r, new(big.Int).Sub(N, s), v); err == nil {
+			t.Fatalf("\t%s\tTest %d:\tShould reject high s signatures", Failed, testID)
+		}
+		if _, err := Recover(hash[:], big.NewInt(0), s, v); err == nil {
+			t.Fatalf("\t%s\tTest %d:\tShould reject out of range signatures", Failed, testID)
+		}
+		t.Logf("\t%s\tTest %d:\tShould reject invalid signatures", Success, testID)
+	})
+}